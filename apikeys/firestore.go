@@ -0,0 +1,68 @@
+package apikeys
+
+import (
+	"cloud.google.com/go/firestore"
+	"context"
+	firebase "firebase.google.com/go"
+	"fmt"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// KEYS_COLLECTION The collection keys are stored in, with the hash of the key as the ID of the document
+const KEYS_COLLECTION = "api-keys"
+
+// FirestoreStore finds keys in Firestore, so they can be added and revoked without a restart
+type FirestoreStore struct {
+	ctx    context.Context
+	client *firestore.Client
+}
+
+// The document of a key
+type firestoreKey struct {
+	Owner string `firestore:"Owner"`
+	Role  string `firestore:"Role,omitempty"`
+}
+
+func NewFirestoreStore(credentials string) (*FirestoreStore, error) {
+	ctx := context.Background()
+
+	app, err := firebase.NewApp(ctx, nil, option.WithCredentialsFile(credentials))
+	if err != nil {
+		return nil, fmt.Errorf("could not initialize Firebase: %w", err)
+	}
+
+	client, err := app.Firestore(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to Firestore: %w", err)
+	}
+
+	return &FirestoreStore{ctx: ctx, client: client}, nil
+}
+
+func (s *FirestoreStore) Find(key string) (Key, error) {
+	hash := Hash(key)
+	doc, err := s.client.Collection(KEYS_COLLECTION).Doc(hash).Get(s.ctx)
+	if status.Code(err) == codes.NotFound {
+		return Key{}, ErrUnknownKey
+	}
+	if err != nil {
+		return Key{}, err
+	}
+
+	data := firestoreKey{}
+	err = doc.DataTo(&data)
+	if err != nil {
+		return Key{}, err
+	}
+	found := Key{Owner: data.Owner, Role: data.Role, Hash: hash}
+	if found.Role == "" {
+		found.Role = ROLE_USER
+	}
+	return found, nil
+}
+
+func (s *FirestoreStore) Close() error {
+	return s.client.Close()
+}
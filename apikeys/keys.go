@@ -0,0 +1,103 @@
+// Package apikeys authenticates the users of the API by the keys they have been given.
+// Keys are only ever stored as their SHA-256 hash.
+package apikeys
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Storage backends a key store can be opened with
+const BACKEND_FIRESTORE = "firestore"
+const BACKEND_MEMORY = "memory"
+const BACKEND_FILE = "file"
+
+// Roles of keys. Admins can see and change every webhook, users only their own.
+const ROLE_USER = "user"
+const ROLE_ADMIN = "admin"
+
+// ErrUnknownKey is returned for keys that are not in the store
+var ErrUnknownKey = errors.New("unknown API key")
+
+// Key is a key given to a user of the API
+type Key struct {
+	// The team or user the key belongs to, owning the webhooks registered with it
+	Owner string `json:"owner"`
+	// ROLE_USER (also when empty) or ROLE_ADMIN
+	Role string `json:"role,omitempty"`
+	// Hex encoded SHA-256 hash of the key
+	Hash string `json:"sha256"`
+}
+
+// IsAdmin reports whether the key can see and change every webhook
+func (k Key) IsAdmin() bool {
+	return k.Role == ROLE_ADMIN
+}
+
+// Store finds the keys given to users
+type Store interface {
+	// Find returns the key, ErrUnknownKey if it is not in the store
+	Find(key string) (Key, error)
+	Close() error
+}
+
+// Hash returns the hash keys are stored by
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// ParseKeys reads keys written as "owner:key" or "owner:key:admin"
+func ParseKeys(entries []string) ([]Key, error) {
+	keys := []Key{}
+	for i, entry := range entries {
+		parts := strings.Split(strings.TrimSpace(entry), ":")
+		if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+			// Only the position, as the entry may be a key without its owner
+			return nil, fmt.Errorf("invalid API key number %d, must be owner:key or owner:key:role", i+1)
+		}
+		key := Key{Owner: parts[0], Role: ROLE_USER, Hash: Hash(parts[1])}
+		if len(parts) == 3 {
+			key.Role = parts[2]
+		}
+		if key.Role != ROLE_USER && key.Role != ROLE_ADMIN {
+			return nil, fmt.Errorf("invalid role '%s' of the API key of %s, must be %s or %s", key.Role, key.Owner, ROLE_USER, ROLE_ADMIN)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// Config of the key store to open
+type Config struct {
+	// One of the BACKEND_ constants
+	Backend string
+	// The keys of the memory backend, see ParseKeys
+	Keys []string
+	// The file of the file backend
+	File string
+	// The credentials file of the Firestore backend
+	Credentials string
+}
+
+// Open opens the key store of the backend in the config
+func Open(config Config) (Store, error) {
+	switch config.Backend {
+	case BACKEND_MEMORY:
+		keys, err := ParseKeys(config.Keys)
+		if err != nil {
+			return nil, err
+		}
+		return NewMemoryStore(keys...), nil
+	case BACKEND_FILE:
+		return NewFileStore(config.File)
+	case BACKEND_FIRESTORE:
+		return NewFirestoreStore(config.Credentials)
+	default:
+		return nil, errors.New("unknown API key store '" + config.Backend + "', must be one of: " +
+			strings.Join([]string{BACKEND_FIRESTORE, BACKEND_MEMORY, BACKEND_FILE}, ", "))
+	}
+}
@@ -0,0 +1,72 @@
+package apikeys
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseKeys(t *testing.T) {
+	keys, err := ParseKeys([]string{"team-a:first key", " ops:second key:admin "})
+	assert.NoError(t, err)
+	assert.Equal(t, []Key{
+		{Owner: "team-a", Role: ROLE_USER, Hash: Hash("first key")},
+		{Owner: "ops", Role: ROLE_ADMIN, Hash: Hash("second key")},
+	}, keys)
+
+	for _, invalid := range []string{"no key", ":key", "team-a:", "team-a:key:owner", "a:b:c:d"} {
+		_, err := ParseKeys([]string{invalid})
+		assert.Error(t, err, invalid)
+	}
+
+	// The secret of an entry without an owner is not in the error
+	_, err = ParseKeys([]string{"team-a:first key", "secret-key"})
+	if assert.Error(t, err) {
+		assert.NotContains(t, err.Error(), "secret-key")
+		assert.Contains(t, err.Error(), "2")
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	store, err := Open(Config{Backend: BACKEND_MEMORY, Keys: []string{"team-a:first key", "ops:second key:admin"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := store.Find("first key")
+	assert.NoError(t, err)
+	assert.Equal(t, "team-a", key.Owner)
+	assert.False(t, key.IsAdmin())
+
+	key, _ = store.Find("second key")
+	assert.True(t, key.IsAdmin())
+
+	_, err = store.Find("team-a")
+	assert.ErrorIs(t, err, ErrUnknownKey)
+}
+
+func TestFileStore(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "keys.json")
+	content := `[{"owner": "team-a", "sha256": "` + Hash("first key") + `"}, {"owner": "ops", "role": "admin", "sha256": "` + Hash("second key") + `"}]`
+	if err := os.WriteFile(filename, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := Open(Config{Backend: BACKEND_FILE, File: filename})
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := store.Find("first key")
+	assert.NoError(t, err)
+	assert.Equal(t, Key{Owner: "team-a", Role: ROLE_USER, Hash: Hash("first key")}, key)
+	key, _ = store.Find("second key")
+	assert.True(t, key.IsAdmin())
+
+	// Keys written as they are instead of hashed
+	if err := os.WriteFile(filename, []byte(`[{"owner": "team-a", "sha256": "first key"}]`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, err = Open(Config{Backend: BACKEND_FILE, File: filename})
+	assert.Error(t, err)
+}
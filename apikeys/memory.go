@@ -0,0 +1,58 @@
+package apikeys
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// MemoryStore keeps a fixed set of keys, by their hash
+type MemoryStore struct {
+	keys map[string]Key
+}
+
+func NewMemoryStore(keys ...Key) *MemoryStore {
+	s := &MemoryStore{keys: make(map[string]Key)}
+	for _, key := range keys {
+		if key.Role == "" {
+			key.Role = ROLE_USER
+		}
+		s.keys[key.Hash] = key
+	}
+	return s
+}
+
+func (s *MemoryStore) Find(key string) (Key, error) {
+	found, ok := s.keys[Hash(key)]
+	if !ok {
+		return Key{}, ErrUnknownKey
+	}
+	return found, nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// NewFileStore reads the keys from a JSON array of keys, with the hash of each key in "sha256".
+// The file is read once, the service has to be restarted to use changes to it.
+func NewFileStore(filename string) (*MemoryStore, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("could not read the API key file: %w", err)
+	}
+	keys := []Key{}
+	err = json.Unmarshal(content, &keys)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode the API key file %s: %w", filename, err)
+	}
+	for _, key := range keys {
+		if key.Owner == "" || len(key.Hash) != 64 {
+			return nil, fmt.Errorf("every key in the API key file %s needs an owner and a sha256 hash", filename)
+		}
+		if key.Role != "" && key.Role != ROLE_USER && key.Role != ROLE_ADMIN {
+			return nil, fmt.Errorf("invalid role '%s' of the API key of %s", key.Role, key.Owner)
+		}
+	}
+	return NewMemoryStore(keys...), nil
+}
@@ -1,16 +1,25 @@
 package main
 
 import (
+	"assignment-2/apikeys"
+	"assignment-2/countries"
+	"assignment-2/dataset"
+	"assignment-2/delivery"
 	"assignment-2/handlers"
+	"assignment-2/urlpolicy"
+	"assignment-2/webhooks"
+	"errors"
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 func main() {
-	// Closing the firestore client
-	defer handlers.CloseClient()
-
 	// Find port
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -18,38 +27,126 @@ func main() {
 		port = handlers.DEFAULT_PORT
 	}
 
-	// Setup messaging channel (to have renewable handlers notify the invocation process in the main function)
-	msg := make(chan string)
+	// Setup messaging channel (to have renewable handlers notify the invocation process in the main function).
+	// Buffered, so requests do not wait for the invocation to be counted and the webhooks notified.
+	msg := make(chan string, handlers.INVOCATION_QUEUE_SIZE)
 
-	http.HandleFunc("/", handlers.DefaultHandler)
-	http.HandleFunc(handlers.RENEW_HISTORY_ENDPOINT, handlers.RenewHistoryHandler(msg))
-	http.HandleFunc(handlers.NOTIFICATION_ENDPOINT, handlers.NotificationHandler)
-	http.HandleFunc(handlers.STATUS_ENPOINT, handlers.StatusHandler)
+	// Find the data source
+	location := os.Getenv(handlers.RENEWABLE_DATA_SOURCE_ENV)
+	if location == "" {
+		log.Println("Data source has not been set. Using default data file:", handlers.RENEWABLE_DATA_CSV)
+		location = handlers.RENEWABLE_DATA_CSV
+	}
+	cacheDir := os.Getenv(handlers.RENEWABLE_DATA_CACHE_ENV)
+	if cacheDir == "" {
+		cacheDir = filepath.Join(os.TempDir(), handlers.DEFAULT_DATA_CACHE_DIR)
+	}
+
+	source, err := dataset.NewSource(location, cacheDir)
+	if err != nil {
+		log.Fatalln("Unable to use the data source set in "+handlers.RENEWABLE_DATA_SOURCE_ENV+".", err.Error())
+	}
 
 	// Load and generate needed data
-	// CSV reading
+	// CSV reading, the dataset (with lookup indexes) is shared by the renewables handlers
+	store, err := dataset.NewStore(source)
+	if err != nil {
+		log.Fatalln("Unable to load the dataset from "+source.String()+".", err.Error())
+	}
 
-	data, err := handlers.ReadCSV(handlers.RENEWABLE_DATA_CSV)
+	// Reload the dataset in the background whenever the file changes
+	go store.Watch(handlers.DATASET_WATCH_INTERVAL, nil)
+
+	// Client for the Countries API, shared by the handlers so lookups are cached
+	countriesClient, err := countries.New(countriesConfig())
 	if err != nil {
-		log.Println("There was an error reading the file")
-		return
+		log.Fatalln("Unable to set up the Countries API client.", err.Error())
 	}
 
-	// Get the latest years for each country in the dataset
-	years, err := handlers.GetLatestYears(data)
+	// Open the webhook storage
+	webhookStore, err := webhooks.Open(webhookStoreConfig())
+	if err != nil {
+		log.Fatalln("Unable to open the webhook store set in "+handlers.WEBHOOK_STORE_ENV+".", err.Error())
+	}
+	// Closing the webhook store
+	defer webhookStore.Close()
+
+	// Repair webhooks stored in only some of their collections, in stores that keep them in several
+	if reconciler, ok := webhookStore.(webhooks.Reconciler); ok {
+		go webhooks.ReconcileEvery(reconciler, handlers.WEBHOOK_RECONCILE_INTERVAL, nil)
+	}
+
+	// The notification endpoints need an API key, each key owning the webhooks registered with it
+	keys, err := openKeys()
+	if err != nil {
+		log.Fatalln("Unable to open the API keys set in "+handlers.API_KEY_STORE_ENV+".", err.Error())
+	}
+	if keys == nil {
+		log.Println("W: " + handlers.API_KEY_STORE_ENV + " is " + handlers.API_KEY_STORE_NONE + ", anyone can see and change every webhook")
+	} else {
+		defer keys.Close()
+	}
 
+	// Notifications are sent by a pool of workers, those that keep failing are kept as dead letters
+	deadLetters, err := openDeadLetters()
 	if err != nil {
-		log.Println("There was an error with the data")
-		return
+		log.Fatalln("Unable to open the dead letters set in "+handlers.DEAD_LETTER_FILE_ENV+".", err.Error())
 	}
+	// Webhooks may only be registered with, and notifications only sent to, the URLs the policy allows
+	urls, err := urlpolicy.New(urlPolicyConfig())
+	if err != nil {
+		log.Fatalln("Unable to set up the URL policy of webhooks.", err.Error())
+	}
+	// Every attempt is logged, so users can see what their receivers answered
+	attemptLog, err := openAttemptLog()
+	if err != nil {
+		log.Fatalln("Unable to open the delivery log set in "+handlers.DELIVERY_LOG_FILE_ENV+".", err.Error())
+	}
+	dispatcher := delivery.New(deliveryConfig(urls), deadLetters, attemptLog)
+	defer dispatcher.Close()
+	// Webhooks whose deliveries keep failing are disabled, until they are resumed
+	disableAfter := intEnv(handlers.WEBHOOK_DISABLE_AFTER_ENV)
+	if disableAfter <= 0 {
+		disableAfter = handlers.DEFAULT_DISABLE_AFTER
+	}
+	dispatcher.OnResult(handlers.DeliveryResult(webhookStore, disableAfter))
 
-	http.HandleFunc(handlers.RENEW_CURRENT_ENDPOINT, handlers.RenewCurrentHandler(data, years, msg))
+	// Threshold webhooks are checked against the dataset now, and again every time it is reloaded,
+	// when the webhooks that subscribed to it are also told about the new dataset.
+	// The checks are serialised, as the watcher and the dataset endpoint may reload at the same time.
+	var thresholdMu sync.Mutex
+	checkThresholds := func(c *dataset.Collection) {
+		thresholdMu.Lock()
+		defer thresholdMu.Unlock()
+		handlers.ThresholdInvocation(webhookStore, dispatcher, c)
+	}
+	store.OnReload(func(c *dataset.Collection) {
+		handlers.DatasetInvocation(webhookStore, dispatcher, c, store.LoadedAt())
+		checkThresholds(c)
+	})
+	checkThresholds(store.Get())
 
-	// Get code ---> country name mapping for listener
-	mapping := handlers.GetCountryCodeMapping(data)
+	http.HandleFunc("/", handlers.DefaultHandler)
+	http.HandleFunc(handlers.RENEW_CURRENT_ENDPOINT, handlers.RenewCurrentHandler(store, countriesClient, handlers.ChannelNotifier(msg)))
+	http.HandleFunc(handlers.RENEW_HISTORY_ENDPOINT, handlers.RenewHistoryHandler(store, handlers.ChannelNotifier(msg)))
+	http.HandleFunc(handlers.NOTIFICATION_ENDPOINT, handlers.Authenticate(keys,
+		handlers.NotificationHandler(webhookStore, countriesClient, attemptLog, store, dispatcher, urls)))
+	http.HandleFunc(handlers.DEAD_LETTER_ENDPOINT, handlers.Authenticate(keys,
+		handlers.RequireAdmin(handlers.DeadLetterHandler(deadLetters, webhookStore, dispatcher))))
+	http.HandleFunc(handlers.STATUS_ENPOINT, handlers.StatusHandler(countriesClient, webhookStore))
+	http.HandleFunc(handlers.DATASET_ENDPOINT, handlers.Authenticate(keys,
+		handlers.RequireAdmin(handlers.DatasetHandler(store))))
+	http.HandleFunc(handlers.DATASET_QUALITY_ENDPOINT, handlers.DatasetQualityHandler(store))
 
 	// Start a listener for messages from handler
-	go listener(msg, mapping)
+	go listener(msg, store, webhookStore, dispatcher)
+
+	// Digests are counted in the webhook store and sent to each webhook once its interval has passed
+	digestInterval := durationEnv(handlers.WEBHOOK_DIGEST_INTERVAL_ENV)
+	if digestInterval <= 0 {
+		digestInterval = handlers.DEFAULT_DIGEST_INTERVAL
+	}
+	go handlers.DigestEvery(webhookStore, dispatcher, digestInterval, nil)
 
 	log.Println("Running on port:", port)
 
@@ -59,26 +156,157 @@ func main() {
 	}
 }
 
-// Listener for incoming messages from handlers
-func listener(msg chan string, mapping map[string]string) {
-	// Keeps track of the number of invocations since server start
-	invocations := make(map[string]int64)
+// Settings of the webhook store, from the environment
+func webhookStoreConfig() webhooks.Config {
+	config := webhooks.Config{
+		Backend:     os.Getenv(handlers.WEBHOOK_STORE_ENV),
+		File:        os.Getenv(handlers.WEBHOOK_STORE_FILE_ENV),
+		Credentials: os.Getenv(handlers.FIRESTORE_CREDENTIALS_ENV),
+	}
+	if config.Backend == "" {
+		config.Backend = webhooks.BACKEND_FIRESTORE
+	}
+	if config.File == "" {
+		config.File = handlers.DEFAULT_WEBHOOK_STORE_FILE
+	}
+	if config.Credentials == "" {
+		config.Credentials = handlers.FIRESTORE_ACCOUNT_KEY
+	}
+	log.Println("Storing webhooks in:", config.Backend)
+	return config
+}
+
+// Settings of the delivery of notifications, from the environment
+func deliveryConfig(policy *urlpolicy.Policy) delivery.Config {
+	return delivery.Config{
+		Workers:     intEnv(handlers.DELIVERY_WORKERS_ENV),
+		Timeout:     durationEnv(handlers.DELIVERY_TIMEOUT_ENV),
+		MaxAttempts: intEnv(handlers.DELIVERY_MAX_ATTEMPTS_ENV),
+		Backoff:     durationEnv(handlers.DELIVERY_BACKOFF_ENV),
+		Policy:      policy,
+	}
+}
 
+// Settings of the URL policy of webhooks, from the environment
+func urlPolicyConfig() urlpolicy.Config {
+	return urlpolicy.Config{
+		Schemes: listEnv(handlers.WEBHOOK_URL_SCHEMES_ENV),
+		Allow:   listEnv(handlers.WEBHOOK_URL_ALLOW_ENV),
+		Deny:    listEnv(handlers.WEBHOOK_URL_DENY_ENV),
+	}
+}
+
+// Open the store of API keys, nil if no keys are needed. Keys set in the environment are used unless another store has been set.
+func openKeys() (apikeys.Store, error) {
+	config := apikeys.Config{
+		Backend:     os.Getenv(handlers.API_KEY_STORE_ENV),
+		Keys:        listEnv(handlers.API_KEYS_ENV),
+		File:        os.Getenv(handlers.API_KEY_FILE_ENV),
+		Credentials: os.Getenv(handlers.FIRESTORE_CREDENTIALS_ENV),
+	}
+	if config.Backend == "" && len(config.Keys) > 0 {
+		config.Backend = apikeys.BACKEND_MEMORY
+	}
+	// Without keys anyone is an admin, so that has to be asked for
+	if config.Backend == "" {
+		return nil, errors.New("no API keys have been set, set " + handlers.API_KEYS_ENV + " or " +
+			handlers.API_KEY_STORE_ENV + ", or " + handlers.API_KEY_STORE_ENV + "=" + handlers.API_KEY_STORE_NONE + " to run without keys")
+	}
+	if config.Backend == handlers.API_KEY_STORE_NONE {
+		return nil, nil
+	}
+	if config.Credentials == "" {
+		config.Credentials = handlers.FIRESTORE_ACCOUNT_KEY
+	}
+	return apikeys.Open(config)
+}
+
+// Open the dead letters, kept in a file if one has been set
+func openDeadLetters() (delivery.DeadLetterStore, error) {
+	filename := os.Getenv(handlers.DEAD_LETTER_FILE_ENV)
+	if filename == "" {
+		return delivery.NewMemoryDeadLetters(0), nil
+	}
+	return delivery.NewFileDeadLetters(filename, 0)
+}
+
+// Open the log of delivery attempts, kept in a file if one has been set
+func openAttemptLog() (delivery.Log, error) {
+	filename := os.Getenv(handlers.DELIVERY_LOG_FILE_ENV)
+	if filename == "" {
+		return delivery.NewMemoryLog(0), nil
+	}
+	return delivery.NewFileLog(filename, 0)
+}
+
+// Settings of the Countries API client, from the environment
+func countriesConfig() countries.Config {
+	config := countries.Config{
+		BaseURL:  os.Getenv(handlers.COUNTRIES_API_URL_ENV),
+		Timeout:  durationEnv(handlers.COUNTRIES_API_TIMEOUT_ENV),
+		TTL:      durationEnv(handlers.COUNTRIES_API_CACHE_TTL_ENV),
+		Snapshot: os.Getenv(handlers.COUNTRIES_API_SNAPSHOT_ENV),
+	}
+	if config.BaseURL == "" {
+		config.BaseURL = handlers.COUNTRY_API_BASE_ENDPOINT
+	}
+	return config
+}
+
+// Read a duration (like "10s" or "1h") from an environment variable, 0 if it is not set
+func durationEnv(name string) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalln("Invalid duration in "+name+".", err.Error())
+	}
+	return duration
+}
+
+// Read a comma separated list from an environment variable, empty if it is not set
+func listEnv(name string) []string {
+	list := []string{}
+	for _, value := range strings.Split(os.Getenv(name), ",") {
+		if strings.TrimSpace(value) != "" {
+			list = append(list, strings.TrimSpace(value))
+		}
+	}
+	return list
+}
+
+// Read a whole number from an environment variable, 0 if it is not set
+func intEnv(name string) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatalln("Invalid number in "+name+".", err.Error())
+	}
+	return number
+}
+
+// Listener for incoming messages from handlers
+func listener(msg chan string, store *dataset.Store, webhookStore webhooks.Store, deliverer handlers.Deliverer) {
 	for m := range msg {
 		country := m
-		// Try to see if there is a mapping to a code (name input)
-		name, ok := mapping[country]
+		// Try to see if there is a mapping to a code (name input), using the dataset currently served
+		name, ok := store.Get().CodeMapping()[country]
 		if ok {
 			country = name
 		}
 
-		_, ok = invocations[country]
-		if ok {
-			invocations[country] += 1
-		} else {
-			invocations[country] = 1
+		// Counted in the webhook store, so the count survives restarts and is shared by every instance
+		invocations, err := webhookStore.Increment(country)
+		if err != nil {
+			log.Println("E: Failed to count the invocation of", country, "Error:", err.Error())
+			continue
 		}
 
-		handlers.WebhookInvocation(country, int(invocations[country]))
+		handlers.WebhookInvocation(webhookStore, deliverer, country, invocations)
 	}
 }
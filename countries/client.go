@@ -0,0 +1,267 @@
+package countries
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DEFAULT_TIMEOUT How long a request to the Countries API may take when no timeout has been set
+const DEFAULT_TIMEOUT = 10 * time.Second
+
+// DEFAULT_TTL How long country records are cached when no TTL has been set
+const DEFAULT_TTL = 24 * time.Hour
+
+// Expired entries are only cleared from the cache once it has grown past this size
+const maxCacheEntries = 1000
+
+// Config of a client
+type Config struct {
+	// The base URL of the REST Countries API, e.g. http://host:8080/v3.1/
+	BaseURL string
+	Timeout time.Duration
+	// How long country records are cached
+	TTL time.Duration
+	// Optional JSON file with country records (the output of /all), used when the API is unavailable
+	Snapshot string
+}
+
+// Client looks up countries in the REST Countries API, caching the records it gets
+type Client struct {
+	baseURL string
+	http    *http.Client
+	ttl     time.Duration
+	// Records from the snapshot file, nil if there is none
+	snapshot []Country
+
+	mu sync.Mutex
+	// Cached records, keyed by the kind of lookup and the lower-cased query
+	cache map[string]cacheEntry
+
+	// Replaced in tests
+	now func() time.Time
+}
+
+type cacheEntry struct {
+	country Country
+	// Set when the API did not know the query, so e.g. names are not looked up as codes every time
+	unknown bool
+	expires time.Time
+}
+
+// New creates a client, failing if the snapshot file is set but can not be read
+func New(config Config) (*Client, error) {
+	if config.Timeout <= 0 {
+		config.Timeout = DEFAULT_TIMEOUT
+	}
+	if config.TTL <= 0 {
+		config.TTL = DEFAULT_TTL
+	}
+	if !strings.HasSuffix(config.BaseURL, "/") {
+		config.BaseURL += "/"
+	}
+
+	c := &Client{
+		baseURL: config.BaseURL,
+		http:    &http.Client{Timeout: config.Timeout},
+		ttl:     config.TTL,
+		cache:   make(map[string]cacheEntry),
+		now:     time.Now,
+	}
+
+	if config.Snapshot != "" {
+		snapshot, err := readSnapshot(config.Snapshot)
+		if err != nil {
+			return nil, err
+		}
+		c.snapshot = snapshot
+		log.Printf("Loaded %d countries from the snapshot %s\n", len(snapshot), config.Snapshot)
+	}
+
+	return c, nil
+}
+
+func readSnapshot(filename string) ([]Country, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("could not open the countries snapshot: %w", err)
+	}
+	defer file.Close()
+
+	snapshot := []Country{}
+	err = json.NewDecoder(file).Decode(&snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode the countries snapshot: %w", err)
+	}
+	return snapshot, nil
+}
+
+// ByCode looks up a country by its 2- or 3-letter code
+func (c *Client) ByCode(code string) (Country, error) {
+	return c.lookup("code:"+strings.ToLower(code), "alpha/"+url.PathEscape(code), func(country Country) bool {
+		return country.HasCode(code)
+	})
+}
+
+// ByName looks up a country by its name. The API also matches on parts of names,
+// so a name matching several countries is ambiguous unless one of them has exactly that name.
+func (c *Client) ByName(name string) (Country, error) {
+	return c.lookup("name:"+strings.ToLower(name), "name/"+url.PathEscape(name), func(country Country) bool {
+		return country.HasName(name)
+	})
+}
+
+// Lookup looks up a country by either its code or its name
+func (c *Client) Lookup(country string) (Country, error) {
+	result, err := c.ByCode(country)
+	// While the API is unavailable the name may still be found in the cache or the snapshot
+	if errors.Is(err, ErrUnknownCountry) || unavailable(err) {
+		return c.ByName(country)
+	}
+	return result, err
+}
+
+// Neighbours returns the codes of the countries bordering a country, given by either its code or its name
+func (c *Client) Neighbours(country string) ([]string, error) {
+	result, err := c.Lookup(country)
+	if err != nil {
+		return nil, err
+	}
+	return result.Borders, nil
+}
+
+// Status returns the status code of the Countries API, 503 if it could not be reached
+func (c *Client) Status() int {
+	res, err := c.http.Get(c.baseURL + "all?fields=cca3")
+	if err != nil {
+		log.Println("E: There was an error contacting the Countries API. Error:", err.Error())
+		return http.StatusServiceUnavailable
+	}
+	res.Body.Close()
+	return res.StatusCode
+}
+
+// Look up a country in the cache, then the API, then the stale cache or the snapshot if the API is unavailable.
+// Matches picks the country asked for when the API returns several.
+func (c *Client) lookup(key string, path string, matches func(Country) bool) (Country, error) {
+	c.mu.Lock()
+	entry, cached := c.cache[key]
+	c.mu.Unlock()
+	if cached && c.now().Before(entry.expires) {
+		if entry.unknown {
+			return Country{}, ErrUnknownCountry
+		}
+		return entry.country, nil
+	}
+
+	results, err := c.fetch(path)
+	if err == nil {
+		var country Country
+		country, err = pick(results, matches)
+		if err == nil {
+			c.store(key, cacheEntry{country: country})
+			return country, nil
+		}
+	}
+	if errors.Is(err, ErrUnknownCountry) {
+		c.store(key, cacheEntry{unknown: true})
+	}
+
+	if !unavailable(err) {
+		return Country{}, err
+	}
+
+	// Better an old record than none
+	if cached && !entry.unknown {
+		log.Println("W: The Countries API is unavailable, using an expired record for", key)
+		return entry.country, nil
+	}
+	for _, country := range c.snapshot {
+		if matches(country) {
+			log.Println("W: The Countries API is unavailable, using the snapshot for", key)
+			return country, nil
+		}
+	}
+	return Country{}, err
+}
+
+// Pick the single country asked for from the results of the API
+func pick(results []Country, matches func(Country) bool) (Country, error) {
+	if len(results) == 1 {
+		return results[0], nil
+	}
+
+	found := []Country{}
+	for _, country := range results {
+		if matches(country) {
+			found = append(found, country)
+		}
+	}
+	if len(found) == 1 {
+		return found[0], nil
+	}
+
+	if len(results) == 0 {
+		return Country{}, ErrUnknownCountry
+	}
+	return Country{}, fmt.Errorf("%w: %d countries match", ErrAmbiguousCountry, len(results))
+}
+
+// Cache the result of a lookup under the key it was looked up with, and a country also under its code
+func (c *Client) store(key string, entry cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.cache) >= maxCacheEntries {
+		for k, entry := range c.cache {
+			if !c.now().Before(entry.expires) {
+				delete(c.cache, k)
+			}
+		}
+	}
+
+	entry.expires = c.now().Add(c.ttl)
+	c.cache[key] = entry
+	if !entry.unknown && entry.country.CCA3 != "" {
+		c.cache["code:"+strings.ToLower(entry.country.CCA3)] = entry
+	}
+}
+
+func (c *Client) fetch(path string) ([]Country, error) {
+	res, err := c.http.Get(c.baseURL + path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	defer res.Body.Close()
+
+	// The API answers 400 or 404 for countries it does not know
+	if res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusBadRequest {
+		return nil, ErrUnknownCountry
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, &StatusError{StatusCode: res.StatusCode}
+	}
+
+	results := []Country{}
+	err = json.NewDecoder(res.Body).Decode(&results)
+	if err != nil {
+		return nil, &StatusError{StatusCode: res.StatusCode, Message: err.Error()}
+	}
+	return results, nil
+}
+
+// Whether an error means the API can not be used right now, rather than it not knowing the country
+func unavailable(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= http.StatusInternalServerError
+	}
+	return errors.Is(err, ErrUnavailable)
+}
@@ -0,0 +1,151 @@
+package countries
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const norway = `[{"name":{"common":"Norway","official":"Kingdom of Norway"},"cca2":"NO","cca3":"NOR","borders":["FIN","SWE","RUS"]}]`
+
+// Stand-in for the Countries API, counting the requests it gets
+func newTestServer(t *testing.T, requests *int) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests++
+		switch strings.ToLower(r.URL.Path) {
+		case "/alpha/nor", "/name/norway":
+			w.Write([]byte(norway))
+		case "/name/guinea":
+			w.Write([]byte(`[{"name":{"common":"Guinea"},"cca3":"GIN"},{"name":{"common":"Guinea-Bissau"},"cca3":"GNB"},` +
+				`{"name":{"common":"Equatorial Guinea"},"cca3":"GNQ"},{"name":{"common":"Papua New Guinea"},"cca3":"PNG"}]`))
+		case "/name/sudan":
+			w.Write([]byte(`[{"name":{"common":"Sudan"},"cca3":"SDN"},{"name":{"common":"South Sudan"},"cca3":"SSD"}]`))
+		case "/name/island":
+			w.Write([]byte(`[{"name":{"common":"Iceland"},"cca3":"ISL"},{"name":{"common":"Faroe Islands"},"cca3":"FRO"}]`))
+		case "/alpha/err":
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		default:
+			http.Error(w, "Not Found", http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestLookup(t *testing.T) {
+	requests := 0
+	server := newTestServer(t, &requests)
+	client, err := New(Config{BaseURL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	country, err := client.Lookup("NOR")
+	assert.NoError(t, err)
+	assert.Equal(t, "Norway", country.Name.Common)
+
+	// Falls back to the name when it is not a code
+	neighbours, err := client.Neighbours("norway")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"FIN", "SWE", "RUS"}, neighbours)
+
+	// The exact name is picked among partial matches
+	country, err = client.ByName("Guinea")
+	assert.NoError(t, err)
+	assert.Equal(t, "GIN", country.CCA3)
+	country, err = client.ByName("sudan")
+	assert.NoError(t, err)
+	assert.Equal(t, "SDN", country.CCA3)
+
+	_, err = client.ByName("island")
+	assert.True(t, errors.Is(err, ErrAmbiguousCountry))
+
+	_, err = client.Lookup("atlantis")
+	assert.True(t, errors.Is(err, ErrUnknownCountry))
+
+	// Unknown countries are remembered as well
+	requests = 0
+	_, err = client.Lookup("atlantis")
+	assert.True(t, errors.Is(err, ErrUnknownCountry))
+	assert.Equal(t, 0, requests)
+
+	_, err = client.ByCode("err")
+	var statusErr *StatusError
+	assert.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, http.StatusInternalServerError, statusErr.StatusCode)
+}
+
+func TestCache(t *testing.T) {
+	requests := 0
+	server := newTestServer(t, &requests)
+	client, err := New(Config{BaseURL: server.URL, TTL: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	client.now = func() time.Time { return now }
+
+	_, err = client.Neighbours("norway")
+	assert.NoError(t, err)
+	requests = 0
+
+	// Cached both by the name and the code it turned out to have
+	_, err = client.Neighbours("Norway")
+	assert.NoError(t, err)
+	_, err = client.ByCode("nor")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, requests)
+
+	// Looked up again once expired
+	now = now.Add(2 * time.Hour)
+	_, err = client.ByCode("nor")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, requests)
+
+	// An expired record is used while the API is down
+	now = now.Add(2 * time.Hour)
+	server.Close()
+	country, err := client.ByCode("nor")
+	assert.NoError(t, err)
+	assert.Equal(t, "NOR", country.CCA3)
+
+	_, err = client.ByCode("swe")
+	assert.True(t, errors.Is(err, ErrUnavailable))
+}
+
+func TestSnapshot(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "countries.json")
+	err := os.WriteFile(filename, []byte(norway), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requests := 0
+	server := newTestServer(t, &requests)
+	server.Close()
+
+	client, err := New(Config{BaseURL: server.URL, Snapshot: filename})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	neighbours, err := client.Neighbours("Kingdom of Norway")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"FIN", "SWE", "RUS"}, neighbours)
+
+	_, err = client.ByCode("no")
+	assert.NoError(t, err)
+
+	// Not in the snapshot, so the API being unavailable is reported
+	_, err = client.ByCode("swe")
+	assert.True(t, errors.Is(err, ErrUnavailable))
+
+	_, err = New(Config{BaseURL: server.URL, Snapshot: filepath.Join(t.TempDir(), "missing.json")})
+	assert.Error(t, err)
+}
@@ -0,0 +1,51 @@
+package countries
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Errors returned by the client
+var ErrUnknownCountry = errors.New("unknown country")
+var ErrAmbiguousCountry = errors.New("ambiguous country")
+var ErrUnavailable = errors.New("the Countries API is unavailable")
+
+// StatusError is returned when the Countries API answers with an unexpected status code
+// or a response that can not be decoded
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	if e.Message != "" {
+		return "the Countries API returned an invalid response: " + e.Message
+	}
+	return "the Countries API returned " + strconv.Itoa(e.StatusCode)
+}
+
+// Country is the part of a REST Countries record the service uses
+type Country struct {
+	Name Name   `json:"name"`
+	CCA2 string `json:"cca2"`
+	CCA3 string `json:"cca3"`
+	// ISO 3166-1 alpha-3 codes of the neighbouring countries
+	Borders []string `json:"borders"`
+}
+
+// Name is the common and official name of a country
+type Name struct {
+	Common   string `json:"common"`
+	Official string `json:"official"`
+}
+
+// HasCode reports whether code is the 2- or 3-letter code of the country (case-insensitive)
+func (c Country) HasCode(code string) bool {
+	return strings.EqualFold(c.CCA3, code) || strings.EqualFold(c.CCA2, code)
+}
+
+// HasName reports whether name is the common or official name of the country (case-insensitive)
+func (c Country) HasName(name string) bool {
+	return strings.EqualFold(c.Name.Common, name) || strings.EqualFold(c.Name.Official, name)
+}
@@ -0,0 +1,395 @@
+package dataset
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Observation is a single yearly value for an entity
+type Observation struct {
+	Year  int
+	Value float64
+}
+
+// Entity is a country (or an aggregate like "Europe") with its yearly series
+type Entity struct {
+	Name string
+	Code string
+	// Series sorted by year, oldest first
+	Series []Observation
+	// Mean of all values in the series
+	Mean float64
+
+	// Position of the entity in the source file, used to keep output ordering stable
+	index int
+}
+
+// IsCountry reports whether the entity has a 3-letter ISO code (aggregates do not)
+func (e *Entity) IsCountry() bool {
+	return len(e.Code) == 3
+}
+
+// Latest returns the observation for the most recent year
+func (e *Entity) Latest() (Observation, bool) {
+	if len(e.Series) == 0 {
+		return Observation{}, false
+	}
+	return e.Series[len(e.Series)-1], true
+}
+
+// Year returns the observation for the given year
+func (e *Entity) Year(year int) (Observation, bool) {
+	i := sort.Search(len(e.Series), func(i int) bool { return e.Series[i].Year >= year })
+	if i < len(e.Series) && e.Series[i].Year == year {
+		return e.Series[i], true
+	}
+	return Observation{}, false
+}
+
+// Range returns the observations between begin and end (both inclusive)
+func (e *Entity) Range(begin int, end int) []Observation {
+	from := sort.Search(len(e.Series), func(i int) bool { return e.Series[i].Year >= begin })
+	to := sort.Search(len(e.Series), func(i int) bool { return e.Series[i].Year > end })
+	if from >= to {
+		return nil
+	}
+	return e.Series[from:to]
+}
+
+// Dataset is the parsed data of a single indicator with lookup indexes, it is read-only once built
+type Dataset struct {
+	indicator Indicator
+	entities  []*Entity
+	// Indexes, keys are lower-cased
+	byCode map[string]*Entity
+	byName map[string]*Entity
+	byYear map[int][]*Entity
+
+	// Derived lookups, built together with the indexes so they always match the data
+	latestYears map[string]string
+	// Computed aggregates of the regions, keyed by lower-cased region name
+	aggregates map[string]*Aggregate
+}
+
+func newDataset(indicator Indicator) *Dataset {
+	return &Dataset{
+		indicator: indicator,
+		byCode:    make(map[string]*Entity),
+		byName:    make(map[string]*Entity),
+		byYear:    make(map[int][]*Entity),
+	}
+}
+
+// Collection is every indicator loaded from the data files, it is what the store serves
+type Collection struct {
+	// Datasets in the order of Indicators
+	datasets []*Dataset
+	// Maps lower-cased entity names to lower-cased codes, across all indicators
+	codeMapping map[string]string
+	// Problems found while loading
+	report *Report
+}
+
+// New builds a collection from the raw CSV records, the first record being the header.
+// Files missing any of the required headers are rejected, problems with individual
+// rows are collected in the quality report instead.
+func New(records [][]string) (*Collection, error) {
+	b := newBuilder()
+	err := b.add("", records)
+	if err != nil {
+		return nil, err
+	}
+	return b.build(), nil
+}
+
+// Collects the records of one or more files into a collection
+type builder struct {
+	datasets map[string]*Dataset
+	report   *Report
+	// Entities seen in any file, to report invalid codes once
+	names map[string]bool
+	// Years seen for each entity, to find duplicates
+	seen map[*Entity]map[int]bool
+}
+
+func newBuilder() *builder {
+	return &builder{
+		datasets: make(map[string]*Dataset),
+		report:   newReport(),
+		names:    make(map[string]bool),
+		seen:     make(map[*Entity]map[int]bool),
+	}
+}
+
+// Find or create the entity of a row in the dataset of an indicator
+func (b *builder) entity(indicator Indicator, name string, code string) *Entity {
+	ds, ok := b.datasets[indicator.Name]
+	if !ok {
+		ds = newDataset(indicator)
+		b.datasets[indicator.Name] = ds
+	}
+
+	entity, ok := ds.byName[strings.ToLower(name)]
+	if !ok {
+		entity = &Entity{
+			Name:  name,
+			Code:  code,
+			index: len(ds.entities),
+		}
+		ds.entities = append(ds.entities, entity)
+		ds.byName[strings.ToLower(entity.Name)] = entity
+		if entity.Code != "" {
+			if _, ok := ds.byCode[strings.ToLower(entity.Code)]; !ok {
+				ds.byCode[strings.ToLower(entity.Code)] = entity
+			}
+		}
+		b.seen[entity] = make(map[int]bool)
+	}
+	return entity
+}
+
+// Add the records of a file, the first record being the header
+func (b *builder) add(file string, records [][]string) error {
+	if len(records) < 1 {
+		return errors.New("the data file is empty")
+	}
+
+	cols, err := locateColumns(records[0])
+	if err != nil {
+		return err
+	}
+
+	report := b.report
+
+	for idx, record := range records {
+		// Skip title row
+		if idx == 0 {
+			continue
+		}
+		report.Rows++
+		row := idx + 1
+
+		if len(record) < cols.width() {
+			report.MalformedRows = append(report.MalformedRows, Issue{File: file, Row: row, Entity: strings.Join(record, ",")})
+			continue
+		}
+		issue := Issue{
+			File:   file,
+			Row:    row,
+			Entity: record[cols.entity],
+			Code:   record[cols.code],
+			Year:   record[cols.year],
+		}
+
+		year, err := strconv.Atoi(record[cols.year])
+		if err != nil {
+			report.InvalidYears = append(report.InvalidYears, issue)
+			continue
+		}
+		if year < MIN_YEAR || year > MAX_YEAR {
+			report.YearsOutOfRange = append(report.YearsOutOfRange, issue)
+			continue
+		}
+
+		name, code := record[cols.entity], record[cols.code]
+		if !b.names[strings.ToLower(name)] {
+			b.names[strings.ToLower(name)] = true
+			// Aggregates without a code are expected, anything else should be an ISO code
+			if code != "" && !validCode(code) {
+				report.InvalidCodes = append(report.InvalidCodes, Issue{Entity: name, Code: code})
+			}
+		}
+
+		accepted := false
+		for _, indicator := range Indicators {
+			col, ok := cols.values[indicator.Name]
+			if !ok {
+				continue
+			}
+			entity := b.entity(indicator, name, code)
+
+			valueIssue := issue
+			valueIssue.Indicator = indicator.Name
+			valueIssue.Value = record[col]
+
+			value, err := strconv.ParseFloat(record[col], 64)
+			if err != nil {
+				report.InvalidValues = append(report.InvalidValues, valueIssue)
+				continue
+			}
+
+			if b.seen[entity][year] {
+				report.Duplicates = append(report.Duplicates, valueIssue)
+				continue
+			}
+			b.seen[entity][year] = true
+
+			entity.Series = append(entity.Series, Observation{Year: year, Value: value})
+			accepted = true
+		}
+		if accepted {
+			report.Accepted++
+		}
+	}
+
+	return nil
+}
+
+// Sort the series and build the indexes
+func (b *builder) build() *Collection {
+	c := &Collection{
+		codeMapping: make(map[string]string),
+		report:      b.report,
+	}
+
+	for _, indicator := range Indicators {
+		ds, ok := b.datasets[indicator.Name]
+		if !ok {
+			continue
+		}
+
+		for _, entity := range ds.entities {
+			sort.SliceStable(entity.Series, func(i, j int) bool {
+				return entity.Series[i].Year < entity.Series[j].Year
+			})
+
+			sum := 0.0
+			for _, o := range entity.Series {
+				sum += o.Value
+				ds.byYear[o.Year] = append(ds.byYear[o.Year], entity)
+			}
+			if len(entity.Series) > 0 {
+				entity.Mean = sum / float64(len(entity.Series))
+			}
+
+			// The first code seen for a name wins, like with the code index
+			if _, ok := c.codeMapping[strings.ToLower(entity.Name)]; !ok {
+				c.codeMapping[strings.ToLower(entity.Name)] = strings.ToLower(entity.Code)
+			}
+		}
+
+		ds.latestYears = buildLatestYears(ds)
+		ds.aggregates = buildAggregates(ds)
+		c.datasets = append(c.datasets, ds)
+	}
+
+	return c
+}
+
+// Indicator returns the dataset of an indicator, if it was in the data files
+func (c *Collection) Indicator(name string) (*Dataset, bool) {
+	for _, ds := range c.datasets {
+		if strings.EqualFold(ds.indicator.Name, name) {
+			return ds, true
+		}
+	}
+	return nil, false
+}
+
+// Indicators returns the indicators that were in the data files
+func (c *Collection) Indicators() []Indicator {
+	indicators := []Indicator{}
+	for _, ds := range c.datasets {
+		indicators = append(indicators, ds.indicator)
+	}
+	return indicators
+}
+
+// Report returns the data quality report from when the collection was loaded
+func (c *Collection) Report() *Report {
+	return c.report
+}
+
+// CodeMapping maps lower-cased entity names to lower-cased codes
+func (c *Collection) CodeMapping() map[string]string {
+	return c.codeMapping
+}
+
+// EntityCount is the number of distinct entities across all indicators
+func (c *Collection) EntityCount() int {
+	return len(c.codeMapping)
+}
+
+// CountryCount is the number of distinct entities with a 3-letter ISO code across all indicators
+func (c *Collection) CountryCount() int {
+	count := 0
+	for _, code := range c.codeMapping {
+		if len(code) == 3 {
+			count++
+		}
+	}
+	return count
+}
+
+// Indicator returns which indicator the dataset holds
+func (d *Dataset) Indicator() Indicator {
+	return d.indicator
+}
+
+// Entities returns all entities in the order they appear in the source file
+func (d *Dataset) Entities() []*Entity {
+	return d.entities
+}
+
+// Countries returns all entities with a 3-letter ISO code
+func (d *Dataset) Countries() []*Entity {
+	countries := []*Entity{}
+	for _, entity := range d.entities {
+		if entity.IsCountry() {
+			countries = append(countries, entity)
+		}
+	}
+	return countries
+}
+
+// ByCode finds an entity by its ISO code (case-insensitive)
+func (d *Dataset) ByCode(code string) (*Entity, bool) {
+	entity, ok := d.byCode[strings.ToLower(code)]
+	return entity, ok
+}
+
+// ByName finds an entity by its name (case-insensitive)
+func (d *Dataset) ByName(name string) (*Entity, bool) {
+	entity, ok := d.byName[strings.ToLower(name)]
+	return entity, ok
+}
+
+// Lookup finds an entity by either its ISO code or its name
+func (d *Dataset) Lookup(country string) (*Entity, bool) {
+	if entity, ok := d.ByCode(country); ok {
+		return entity, true
+	}
+	return d.ByName(country)
+}
+
+// Year returns all entities that have a value for the given year
+func (d *Dataset) Year(year int) []*Entity {
+	return d.byYear[year]
+}
+
+// LatestYears maps lower-cased code and name of every country to its latest year
+func (d *Dataset) LatestYears() map[string]string {
+	return d.latestYears
+}
+
+func buildLatestYears(d *Dataset) map[string]string {
+	years := make(map[string]string)
+	for _, entity := range d.Countries() {
+		latest, ok := entity.Latest()
+		if !ok {
+			continue
+		}
+		years[strings.ToLower(entity.Code)] = strconv.Itoa(latest.Year)
+		years[strings.ToLower(entity.Name)] = strconv.Itoa(latest.Year)
+	}
+	return years
+}
+
+// SortEntities sorts entities by their position in the source file
+func SortEntities(entities []*Entity) {
+	sort.SliceStable(entities, func(i, j int) bool {
+		return entities[i].index < entities[j].index
+	})
+}
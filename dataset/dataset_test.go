@@ -0,0 +1,180 @@
+package dataset
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// A small extract in the same layout as the renewables CSV
+var testRecords = [][]string{
+	{"Entity", "Code", "Year", "Renewables (% equivalent primary energy)"},
+	{"Africa", "", "2020", "8.5"},
+	{"Africa", "", "2021", "9.5"},
+	{"Norway", "NOR", "2019", "70"},
+	{"Norway", "NOR", "2020", "72"},
+	{"Norway", "NOR", "2021", "71"},
+	{"Sweden", "SWE", "2020", "50"},
+	{"Sweden", "SWE", "2021", ""},
+}
+
+// Build the test records and get the renewables dataset
+func newTestDataset(t *testing.T, records [][]string) (*Collection, *Dataset) {
+	c, err := New(records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds, ok := c.Indicator(DEFAULT_INDICATOR)
+	if !ok {
+		t.Fatal("No renewables dataset")
+	}
+	return c, ds
+}
+
+func TestNew(t *testing.T) {
+	_, ds := newTestDataset(t, testRecords)
+
+	assert.Len(t, ds.Entities(), 3)
+	assert.Len(t, ds.Countries(), 2)
+
+	norway, ok := ds.Lookup("nor")
+	assert.True(t, ok)
+	assert.Equal(t, "Norway", norway.Name)
+	assert.InDelta(t, 71.0, norway.Mean, 0.0001)
+
+	sweden, ok := ds.Lookup("SWEDEN")
+	assert.True(t, ok)
+	assert.Equal(t, "SWE", sweden.Code)
+
+	// Rows without a value are left out, so the latest year of Sweden is 2020
+	latest, ok := sweden.Latest()
+	assert.True(t, ok)
+	assert.Equal(t, Observation{Year: 2020, Value: 50}, latest)
+
+	_, ok = ds.Lookup("xyz")
+	assert.False(t, ok)
+}
+
+func TestIndexes(t *testing.T) {
+	c, ds := newTestDataset(t, testRecords)
+
+	assert.Len(t, ds.Year(2020), 3)
+	assert.Len(t, ds.Year(2019), 1)
+	assert.Len(t, ds.Year(1900), 0)
+
+	years := ds.LatestYears()
+	assert.Equal(t, "2021", years["nor"])
+	assert.Equal(t, "2021", years["norway"])
+	assert.Equal(t, "2020", years["swe"])
+	_, ok := years["africa"]
+	assert.False(t, ok)
+
+	mapping := c.CodeMapping()
+	assert.Equal(t, "nor", mapping["norway"])
+	assert.Equal(t, "", mapping["africa"])
+}
+
+func TestRange(t *testing.T) {
+	_, ds := newTestDataset(t, testRecords)
+
+	norway, _ := ds.ByCode("NOR")
+	assert.Equal(t, []Observation{{2020, 72}, {2021, 71}}, norway.Range(2020, 2030))
+	assert.Len(t, norway.Range(2000, 2010), 0)
+
+	o, ok := norway.Year(2019)
+	assert.True(t, ok)
+	assert.Equal(t, 70.0, o.Value)
+}
+
+func TestNewMissingHeaders(t *testing.T) {
+	_, err := New([][]string{
+		{"Entity", "Code", "Year", "Electricity (TWh)"},
+		{"Norway", "NOR", "2021", "1"},
+	})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), HEADER_RENEWABLES)
+
+	_, err = New([][]string{
+		{"Entity", "Year", "Renewables (% equivalent primary energy)"},
+		{"Norway", "2021", "1"},
+	})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), HEADER_CODE)
+
+	_, err = New([][]string{})
+	assert.Error(t, err)
+}
+
+func TestNewColumnsByHeader(t *testing.T) {
+	_, ds := newTestDataset(t, [][]string{
+		{"Year", "Renewables (% equivalent primary energy)", "Entity", "Code"},
+		{"2021", "71", "Norway", "NOR"},
+	})
+
+	norway, ok := ds.ByCode("nor")
+	assert.True(t, ok)
+	assert.Equal(t, []Observation{{2021, 71}}, norway.Series)
+}
+
+func TestQualityReport(t *testing.T) {
+	c, ds := newTestDataset(t, [][]string{
+		{"Entity", "Code", "Year", "Renewables (% equivalent primary energy)"},
+		{"Norway", "NOR", "2020", "72"},
+		{"Norway", "NOR", "2020", "73"},
+		{"Norway", "NOR", "twenty", "70"},
+		{"Norway", "NOR", "20210", "70"},
+		{"Norway", "NOR", "2021", "n/a"},
+		{"World", "OWID_WRL", "2021", "13"},
+		{"Sweden", "SWE"},
+	})
+
+	report := c.Report()
+	assert.Equal(t, 7, report.Rows)
+	assert.Equal(t, 2, report.Accepted)
+	assert.Equal(t, 5, report.Rejected())
+	assert.Equal(t, []Issue{{Row: 3, Indicator: "renewables", Entity: "Norway", Code: "NOR", Year: "2020", Value: "73"}}, report.Duplicates)
+	assert.Equal(t, []Issue{{Row: 4, Entity: "Norway", Code: "NOR", Year: "twenty"}}, report.InvalidYears)
+	assert.Equal(t, []Issue{{Row: 5, Entity: "Norway", Code: "NOR", Year: "20210"}}, report.YearsOutOfRange)
+	assert.Equal(t, []Issue{{Row: 6, Indicator: "renewables", Entity: "Norway", Code: "NOR", Year: "2021", Value: "n/a"}}, report.InvalidValues)
+	assert.Equal(t, []Issue{{Entity: "World", Code: "OWID_WRL"}}, report.InvalidCodes)
+	assert.Len(t, report.MalformedRows, 1)
+
+	// The first of the duplicates is kept
+	norway, _ := ds.ByCode("NOR")
+	assert.Equal(t, []Observation{{2020, 72}}, norway.Series)
+}
+
+func TestIndicators(t *testing.T) {
+	c, err := New([][]string{
+		{"Entity", "Code", "Year", "Solar (% equivalent primary energy)", "Wind (% equivalent primary energy)", "Notes"},
+		{"Norway", "NOR", "2020", "0.1", "2.5", ""},
+		{"Norway", "NOR", "2021", "0.2", "", ""},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{}
+	for _, indicator := range c.Indicators() {
+		names = append(names, indicator.Name)
+	}
+	assert.Equal(t, []string{"solar", "wind"}, names)
+
+	_, ok := c.Indicator(DEFAULT_INDICATOR)
+	assert.False(t, ok)
+
+	solar, ok := c.Indicator("Solar")
+	assert.True(t, ok)
+	assert.Equal(t, "% equivalent primary energy", solar.Indicator().Unit)
+	norway, _ := solar.ByCode("NOR")
+	assert.Len(t, norway.Series, 2)
+
+	// A missing wind value only leaves out that value
+	wind, _ := c.Indicator("wind")
+	norway, _ = wind.ByCode("NOR")
+	assert.Equal(t, []Observation{{2020, 2.5}}, norway.Series)
+	assert.Equal(t, 2, c.Report().Accepted)
+	assert.Len(t, c.Report().InvalidValues, 1)
+
+	_, ok = FindIndicator("coal")
+	assert.False(t, ok)
+}
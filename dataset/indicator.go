@@ -0,0 +1,44 @@
+package dataset
+
+import "strings"
+
+// DEFAULT_INDICATOR The indicator used when none is asked for
+const DEFAULT_INDICATOR = "renewables"
+
+// Indicator is one of the energy share columns published by Our World in Data
+type Indicator struct {
+	// Short name used in requests, e.g. "solar"
+	Name string `json:"name"`
+	// Column header in the CSV files
+	Header string `json:"header"`
+	Unit   string `json:"unit"`
+}
+
+// The indicators that are recognised in data files, each file may contain any number of them
+var Indicators = []Indicator{
+	{Name: "renewables", Header: "Renewables (% equivalent primary energy)", Unit: "% equivalent primary energy"},
+	{Name: "solar", Header: "Solar (% equivalent primary energy)", Unit: "% equivalent primary energy"},
+	{Name: "wind", Header: "Wind (% equivalent primary energy)", Unit: "% equivalent primary energy"},
+	{Name: "hydro", Header: "Hydro (% equivalent primary energy)", Unit: "% equivalent primary energy"},
+	{Name: "nuclear", Header: "Nuclear (% equivalent primary energy)", Unit: "% equivalent primary energy"},
+	{Name: "fossil", Header: "Fossil fuels (% equivalent primary energy)", Unit: "% equivalent primary energy"},
+}
+
+// FindIndicator looks up a recognised indicator by its name (case-insensitive)
+func FindIndicator(name string) (Indicator, bool) {
+	for _, indicator := range Indicators {
+		if strings.EqualFold(indicator.Name, name) {
+			return indicator, true
+		}
+	}
+	return Indicator{}, false
+}
+
+// IndicatorNames lists the names of all recognised indicators
+func IndicatorNames() []string {
+	names := []string{}
+	for _, indicator := range Indicators {
+		names = append(names, indicator.Name)
+	}
+	return names
+}
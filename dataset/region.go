@@ -0,0 +1,176 @@
+package dataset
+
+import (
+	"sort"
+	"strings"
+)
+
+// How an aggregate was made
+const AGGREGATE_OWID = "owid"
+const AGGREGATE_COMPUTED = "computed"
+
+// Region is a continent and the ISO codes of its member countries, or another aggregate
+// published in the data file (like World or European Union (27)), which has no members
+type Region struct {
+	Name    string
+	Members []string
+}
+
+// IsContinent reports whether the region is one of the Regions, the only ones that can be computed
+func (r Region) IsContinent() bool {
+	return len(r.Members) > 0
+}
+
+// The continents, following the Our World in Data continent definitions
+var Regions = []Region{
+	{Name: "Africa", Members: strings.Fields(`DZA AGO BEN BWA BFA BDI CPV CMR CAF TCD COM COG COD CIV DJI EGY GNQ ERI SWZ
+		ETH GAB GMB GHA GIN GNB KEN LSO LBR LBY MDG MWI MLI MRT MUS MAR MOZ NAM NER NGA RWA STP SEN SYC SLE SOM ZAF SSD
+		SDN TZA TGO TUN UGA ZMB ZWE ESH`)},
+	{Name: "Asia", Members: strings.Fields(`AFG ARM AZE BHR BGD BTN BRN KHM CHN CYP GEO HKG IND IDN IRN IRQ ISR JPN JOR KAZ
+		KWT KGZ LAO LBN MAC MYS MDV MNG MMR NPL PRK OMN PAK PSE PHL QAT SAU SGP KOR LKA SYR TWN TJK THA TLS TUR TKM ARE
+		UZB VNM YEM`)},
+	{Name: "Europe", Members: strings.Fields(`ALB AND AUT BLR BEL BIH BGR HRV CZE DNK EST FRO FIN FRA DEU GIB GRC HUN ISL IRL
+		ITA LVA LIE LTU LUX MLT MDA MCO MNE NLD MKD NOR POL PRT ROU RUS SMR SRB SVK SVN ESP SWE CHE UKR GBR VAT`)},
+	{Name: "North America", Members: strings.Fields(`ATG ABW BHS BRB BLZ BMU CAN CYM CRI CUB CUW DMA DOM SLV GRL GRD GLP GTM HTI
+		HND JAM MTQ MEX NIC PAN PRI KNA LCA VCT TTO USA`)},
+	{Name: "South America", Members: strings.Fields(`ARG BOL BRA CHL COL ECU FLK GUF GUY PRY PER SUR URY VEN`)},
+	{Name: "Oceania", Members: strings.Fields(`AUS FJI KIR MHL FSM NRU NZL PLW PNG WSM SLB TON TUV VUT NCL PYF`)},
+}
+
+// FindRegion looks up a region by name, case-insensitive and with '-' or '_' accepted for spaces
+func FindRegion(name string) (Region, bool) {
+	name = strings.NewReplacer("-", " ", "_", " ").Replace(name)
+	for _, region := range Regions {
+		if strings.EqualFold(region.Name, name) {
+			return region, true
+		}
+	}
+	return Region{}, false
+}
+
+// FindRegion looks up a continent by name, or else an aggregate row of the dataset that is not a country by its name
+// (case-insensitive, also with '-' or '_' for spaces), e.g. "world", "european union (27)" or "high-income-countries"
+func (d *Dataset) FindRegion(name string) (Region, bool) {
+	if region, ok := FindRegion(name); ok {
+		return region, true
+	}
+	spaced := strings.NewReplacer("-", " ", "_", " ")
+	for _, entity := range d.Entities() {
+		if !entity.IsCountry() && len(entity.Series) > 0 && strings.EqualFold(spaced.Replace(entity.Name), spaced.Replace(name)) {
+			return Region{Name: entity.Name}, true
+		}
+	}
+	return Region{}, false
+}
+
+// RegionNames lists the names of all regions, as they are written in requests
+func RegionNames() []string {
+	names := []string{}
+	for _, region := range Regions {
+		names = append(names, strings.ReplaceAll(strings.ToLower(region.Name), " ", "-"))
+	}
+	return names
+}
+
+// AggregateObservation is the value of a region for a single year
+type AggregateObservation struct {
+	Year  int
+	Value float64
+	// Number of member countries the value is computed from, 0 for OWID aggregates
+	Countries int
+}
+
+// Aggregate is the yearly series of a region
+type Aggregate struct {
+	Name string
+	Code string
+	// AGGREGATE_OWID for rows published in the data file, AGGREGATE_COMPUTED for our own
+	Kind   string
+	Series []AggregateObservation
+}
+
+// Latest returns the most recent year that is representative for the region.
+// For computed aggregates that is the latest year with values for at least half of the
+// countries in the best covered year, so a few early reporters do not stand in for a continent.
+func (a *Aggregate) Latest() (AggregateObservation, bool) {
+	most := 0
+	for _, o := range a.Series {
+		if o.Countries > most {
+			most = o.Countries
+		}
+	}
+
+	for i := len(a.Series) - 1; i >= 0; i-- {
+		if a.Series[i].Countries*2 >= most {
+			return a.Series[i], true
+		}
+	}
+	return AggregateObservation{}, false
+}
+
+// Range returns the observations between begin and end (both inclusive)
+func (a *Aggregate) Range(begin int, end int) []AggregateObservation {
+	observations := []AggregateObservation{}
+	for _, o := range a.Series {
+		if o.Year >= begin && o.Year <= end {
+			observations = append(observations, o)
+		}
+	}
+	return observations
+}
+
+// Aggregate returns the series of a region. The OWID aggregate row of the region is used
+// when the data file has one, unless computed is set or it is missing, in which case
+// the unweighted mean of the member countries is computed for every year. Only continents can be computed.
+func (d *Dataset) Aggregate(region Region, computed bool) (*Aggregate, bool) {
+	if !computed {
+		if entity, ok := d.ByName(region.Name); ok && !entity.IsCountry() && len(entity.Series) > 0 {
+			aggregate := &Aggregate{Name: entity.Name, Code: entity.Code, Kind: AGGREGATE_OWID}
+			for _, o := range entity.Series {
+				aggregate.Series = append(aggregate.Series, AggregateObservation{Year: o.Year, Value: o.Value})
+			}
+			return aggregate, true
+		}
+	}
+
+	aggregate, ok := d.aggregates[strings.ToLower(region.Name)]
+	return aggregate, ok
+}
+
+// Compute the mean of the member countries of every region for every year
+func buildAggregates(d *Dataset) map[string]*Aggregate {
+	aggregates := make(map[string]*Aggregate)
+
+	for _, region := range Regions {
+		sums := make(map[int]float64)
+		counts := make(map[int]int)
+		for _, code := range region.Members {
+			entity, ok := d.ByCode(code)
+			if !ok {
+				continue
+			}
+			for _, o := range entity.Series {
+				sums[o.Year] += o.Value
+				counts[o.Year]++
+			}
+		}
+		if len(counts) == 0 {
+			continue
+		}
+
+		aggregate := &Aggregate{Name: region.Name, Kind: AGGREGATE_COMPUTED}
+		for year, count := range counts {
+			aggregate.Series = append(aggregate.Series, AggregateObservation{
+				Year:      year,
+				Value:     sums[year] / float64(count),
+				Countries: count,
+			})
+		}
+		sort.Slice(aggregate.Series, func(i, j int) bool {
+			return aggregate.Series[i].Year < aggregate.Series[j].Year
+		})
+		aggregates[strings.ToLower(region.Name)] = aggregate
+	}
+
+	return aggregates
+}
@@ -0,0 +1,106 @@
+package dataset
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+var regionRecords = [][]string{
+	{"Entity", "Code", "Year", "Renewables (% equivalent primary energy)"},
+	{"Europe", "", "2020", "20"},
+	{"Europe", "", "2021", "21"},
+	{"World", "OWID_WRL", "2021", "13"},
+	{"High-income countries", "", "2021", "15"},
+	{"Norway", "NOR", "2020", "70"},
+	{"Norway", "NOR", "2021", "72"},
+	{"Sweden", "SWE", "2020", "50"},
+	{"Sweden", "SWE", "2021", "52"},
+	{"Germany", "DEU", "2020", "15"},
+	{"Germany", "DEU", "2021", "17"},
+	{"Germany", "DEU", "2022", "30"},
+	{"Brazil", "BRA", "2021", "47"},
+}
+
+func TestFindRegion(t *testing.T) {
+	region, ok := FindRegion("north-america")
+	assert.True(t, ok)
+	assert.Equal(t, "North America", region.Name)
+
+	_, ok = FindRegion("EUROPE")
+	assert.True(t, ok)
+
+	_, ok = FindRegion("atlantis")
+	assert.False(t, ok)
+
+	assert.Contains(t, RegionNames(), "south-america")
+}
+
+func TestDatasetFindRegion(t *testing.T) {
+	_, ds := newTestDataset(t, regionRecords)
+
+	region, ok := ds.FindRegion("europe")
+	assert.True(t, ok)
+	assert.True(t, region.IsContinent())
+
+	for name, expected := range map[string]string{"world": "World", "High-income countries": "High-income countries", "high_income_countries": "High-income countries"} {
+		region, ok = ds.FindRegion(name)
+		assert.True(t, ok, name)
+		assert.Equal(t, Region{Name: expected}, region, name)
+	}
+
+	// Countries are not regions
+	_, ok = ds.FindRegion("norway")
+	assert.False(t, ok)
+
+	world, _ := ds.FindRegion("world")
+	aggregate, ok := ds.Aggregate(world, false)
+	assert.True(t, ok)
+	assert.Equal(t, "OWID_WRL", aggregate.Code)
+	_, ok = ds.Aggregate(world, true)
+	assert.False(t, ok)
+}
+
+func TestAggregateOWID(t *testing.T) {
+	_, ds := newTestDataset(t, regionRecords)
+	europe, _ := FindRegion("europe")
+
+	aggregate, ok := ds.Aggregate(europe, false)
+	assert.True(t, ok)
+	assert.Equal(t, AGGREGATE_OWID, aggregate.Kind)
+
+	latest, ok := aggregate.Latest()
+	assert.True(t, ok)
+	assert.Equal(t, AggregateObservation{Year: 2021, Value: 21}, latest)
+}
+
+func TestAggregateComputed(t *testing.T) {
+	_, ds := newTestDataset(t, regionRecords)
+	europe, _ := FindRegion("europe")
+
+	aggregate, ok := ds.Aggregate(europe, true)
+	assert.True(t, ok)
+	assert.Equal(t, AGGREGATE_COMPUTED, aggregate.Kind)
+	assert.Equal(t, []AggregateObservation{
+		{Year: 2020, Value: 45, Countries: 3},
+		{Year: 2021, Value: 47, Countries: 3},
+		{Year: 2022, Value: 30, Countries: 1},
+	}, aggregate.Series)
+
+	// 2022 only has one of the three countries, so it does not represent the region
+	latest, ok := aggregate.Latest()
+	assert.True(t, ok)
+	assert.Equal(t, 2021, latest.Year)
+
+	assert.Len(t, aggregate.Range(2021, 2030), 2)
+
+	// Without an OWID row the computed aggregate is used
+	southAmerica, _ := FindRegion("south america")
+	aggregate, ok = ds.Aggregate(southAmerica, false)
+	assert.True(t, ok)
+	assert.Equal(t, AGGREGATE_COMPUTED, aggregate.Kind)
+
+	// No member countries in the data
+	oceania, _ := FindRegion("oceania")
+	_, ok = ds.Aggregate(oceania, false)
+	assert.False(t, ok)
+}
@@ -0,0 +1,157 @@
+package dataset
+
+import (
+	"errors"
+	"log"
+	"strings"
+)
+
+// HEADERS
+// The columns are located by these names, so their order in the file does not matter
+const HEADER_ENTITY = "Entity"
+const HEADER_CODE = "Code"
+const HEADER_YEAR = "Year"
+
+// HEADER_RENEWABLES The header of the default indicator column
+const HEADER_RENEWABLES = "Renewables (% equivalent primary energy)"
+
+// Years outside of this range are rejected as typos
+const MIN_YEAR = 1800
+const MAX_YEAR = 2100
+
+// Positions of the required columns in a file
+type columns struct {
+	entity int
+	code   int
+	year   int
+	// Indicator columns found in the file, keyed by indicator name
+	values map[string]int
+}
+
+// Locate the required columns by their header name, fails if any of them is missing.
+// A file needs at least one indicator column.
+func locateColumns(header []string) (columns, error) {
+	positions := make(map[string]int)
+	for idx, name := range header {
+		// Strip a byte order mark some tools put in front of the first header
+		name = strings.TrimPrefix(name, "\ufeff")
+		positions[strings.ToLower(strings.TrimSpace(name))] = idx
+	}
+
+	missing := []string{}
+	find := func(name string) int {
+		idx, ok := positions[strings.ToLower(name)]
+		if !ok {
+			missing = append(missing, "\""+name+"\"")
+			return -1
+		}
+		return idx
+	}
+
+	cols := columns{
+		entity: find(HEADER_ENTITY),
+		code:   find(HEADER_CODE),
+		year:   find(HEADER_YEAR),
+		values: make(map[string]int),
+	}
+	for _, indicator := range Indicators {
+		if idx, ok := positions[strings.ToLower(indicator.Header)]; ok {
+			cols.values[indicator.Name] = idx
+		}
+	}
+	if len(cols.values) == 0 {
+		missing = append(missing, "one of \""+HEADER_RENEWABLES+"\" or the other indicator columns")
+	}
+
+	if len(missing) > 0 {
+		return columns{}, errors.New("the data file is missing the required headers " + strings.Join(missing, ", "))
+	}
+	return cols, nil
+}
+
+// The number of fields a row needs for all required columns to be present
+func (c columns) width() int {
+	width := 0
+	for _, idx := range []int{c.entity, c.code, c.year} {
+		if idx+1 > width {
+			width = idx + 1
+		}
+	}
+	for _, idx := range c.values {
+		if idx+1 > width {
+			width = idx + 1
+		}
+	}
+	return width
+}
+
+// Issue is a single problem found in the data file
+type Issue struct {
+	// File the row is from, when the dataset is made up of several files
+	File string `json:"file,omitempty"`
+	// Row number in the file, the header being row 1
+	Row int `json:"row,omitempty"`
+	// Indicator the value belongs to, for problems with a single value
+	Indicator string `json:"indicator,omitempty"`
+	Entity    string `json:"entity"`
+	Code      string `json:"code,omitempty"`
+	Year      string `json:"year,omitempty"`
+	Value     string `json:"value,omitempty"`
+}
+
+// Report is the data quality report produced when a file is loaded.
+// Everything listed, except InvalidCodes, is left out of the dataset.
+type Report struct {
+	Rows int `json:"rows"`
+	// Rows with at least one value kept
+	Accepted int `json:"accepted"`
+	// Rows with fewer fields than the header
+	MalformedRows []Issue `json:"malformed_rows"`
+	// Values that are not a number, only the value is left out
+	InvalidValues []Issue `json:"invalid_values"`
+	// Years that are not a number
+	InvalidYears []Issue `json:"invalid_years"`
+	// Years outside MIN_YEAR..MAX_YEAR
+	YearsOutOfRange []Issue `json:"years_out_of_range"`
+	// Repeated entity/year pairs for an indicator, the first occurrence is kept
+	Duplicates []Issue `json:"duplicates"`
+	// Entities with a code that is not 3 letters (one issue per entity)
+	InvalidCodes []Issue `json:"invalid_codes"`
+}
+
+func newReport() *Report {
+	return &Report{
+		MalformedRows:   []Issue{},
+		InvalidValues:   []Issue{},
+		InvalidYears:    []Issue{},
+		YearsOutOfRange: []Issue{},
+		Duplicates:      []Issue{},
+		InvalidCodes:    []Issue{},
+	}
+}
+
+// Rejected is the number of rows left out of the dataset
+func (r *Report) Rejected() int {
+	return r.Rows - r.Accepted
+}
+
+// Log a summary of the report
+func (r *Report) log() {
+	log.Printf("Dataset quality: %d rows, %d accepted, %d malformed, %d invalid values, %d invalid years, "+
+		"%d years out of range, %d duplicates, %d entities with invalid codes\n",
+		r.Rows, r.Accepted, len(r.MalformedRows), len(r.InvalidValues), len(r.InvalidYears),
+		len(r.YearsOutOfRange), len(r.Duplicates), len(r.InvalidCodes))
+}
+
+// Check if a code is made up of exactly 3 letters
+func validCode(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, c := range code {
+		if !(c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,212 @@
+package dataset
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Timeout for downloading a remote data file
+const DOWNLOAD_TIMEOUT = 60 * time.Second
+
+// Source is where the data files come from
+type Source interface {
+	// Sync makes sure the local copies of the data files are up to date and returns their paths
+	Sync() ([]string, error)
+	// String describes the source in log and error messages
+	String() string
+}
+
+// NewSource picks the kind of source from the location: an http(s) URL, a directory or a file.
+// Remote files are cached in cacheDir.
+func NewSource(location string, cacheDir string) (Source, error) {
+	if location == "" {
+		return nil, errors.New("no data source given")
+	}
+
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		return NewURLSource(location, cacheDir, &http.Client{Timeout: DOWNLOAD_TIMEOUT}), nil
+	}
+
+	info, err := os.Stat(location)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.New("the data source " + location + " does not exist")
+		}
+		return nil, err
+	}
+	if info.IsDir() {
+		return NewDirSource(location), nil
+	}
+	return NewFileSource(location), nil
+}
+
+// FileSource is a single local CSV file
+type FileSource struct {
+	path string
+}
+
+func NewFileSource(path string) *FileSource {
+	return &FileSource{path: path}
+}
+
+func (s *FileSource) Sync() ([]string, error) {
+	return []string{s.path}, nil
+}
+
+func (s *FileSource) String() string {
+	return s.path
+}
+
+// DirSource is every CSV file in a local directory, merged into one dataset
+type DirSource struct {
+	dir string
+}
+
+func NewDirSource(dir string) *DirSource {
+	return &DirSource{dir: dir}
+}
+
+func (s *DirSource) Sync() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(s.dir, "*.csv"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, errors.New("there are no .csv files in " + s.dir)
+	}
+	// Keep the order stable so entities are listed the same way on every load
+	sort.Strings(files)
+	return files, nil
+}
+
+func (s *DirSource) String() string {
+	return s.dir
+}
+
+// URLSource is a remote CSV file that is downloaded and cached on disk.
+// If the server can not be reached the cached copy is used.
+type URLSource struct {
+	url    string
+	path   string
+	client *http.Client
+
+	// Validators from the last download, to avoid downloading an unchanged file
+	mu           sync.Mutex
+	etag         string
+	lastModified string
+}
+
+func NewURLSource(url string, cacheDir string, client *http.Client) *URLSource {
+	// Name the cached copy after the URL so several sources can share a directory
+	hash := sha1.Sum([]byte(url))
+	return &URLSource{
+		url:    url,
+		path:   filepath.Join(cacheDir, "dataset-"+hex.EncodeToString(hash[:8])+".csv"),
+		client: client,
+	}
+}
+
+func (s *URLSource) Sync() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.download()
+	if err != nil {
+		// Fall back to the copy from an earlier download
+		if _, statErr := os.Stat(s.path); statErr == nil {
+			log.Println("E: Failed to download the dataset, using the cached copy. Error:", err.Error())
+			return []string{s.path}, nil
+		}
+		return nil, err
+	}
+	return []string{s.path}, nil
+}
+
+// Download the file to the cache, unless it has not changed since the last download
+func (s *URLSource) download() error {
+	req, err := http.NewRequest(http.MethodGet, s.url, nil)
+	if err != nil {
+		return err
+	}
+	// Only send validators if the cached copy is still there
+	if _, err := os.Stat(s.path); err == nil {
+		if s.etag != "" {
+			req.Header.Set("If-None-Match", s.etag)
+		}
+		if s.lastModified != "" {
+			req.Header.Set("If-Modified-Since", s.lastModified)
+		}
+	}
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotModified {
+		return nil
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %d", s.url, res.StatusCode)
+	}
+
+	err = os.MkdirAll(filepath.Dir(s.path), 0755)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a failed download never replaces a good copy
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tmp, res.Body)
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	err = os.Rename(tmp.Name(), s.path)
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	s.etag = res.Header.Get("ETag")
+	s.lastModified = res.Header.Get("Last-Modified")
+	log.Println("Downloaded the dataset from", s.url)
+	return nil
+}
+
+func (s *URLSource) String() string {
+	return s.url
+}
+
+// Describe the current version of the files, changes whenever any of them is modified
+func version(files []string) (string, error) {
+	parts := []string{}
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, fmt.Sprintf("%s:%d:%d", file, info.ModTime().UnixNano(), info.Size()))
+	}
+	return strings.Join(parts, ";"), nil
+}
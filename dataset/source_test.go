@@ -0,0 +1,106 @@
+package dataset
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNewSource(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "data.csv")
+	writeTestFile(t, filename, testHeader+"Norway,NOR,2021,71\n", time.Now())
+
+	source, err := NewSource(filename, dir)
+	assert.NoError(t, err)
+	assert.IsType(t, &FileSource{}, source)
+
+	source, err = NewSource(dir, dir)
+	assert.NoError(t, err)
+	assert.IsType(t, &DirSource{}, source)
+
+	source, err = NewSource("https://example.com/data.csv", dir)
+	assert.NoError(t, err)
+	assert.IsType(t, &URLSource{}, source)
+
+	_, err = NewSource(filepath.Join(dir, "missing.csv"), dir)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "does not exist")
+}
+
+func TestDirSource(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "a.csv"), testHeader+"Norway,NOR,2021,71\n", time.Now())
+	writeTestFile(t, filepath.Join(dir, "b.csv"), testHeader+"Sweden,SWE,2021,50\nNorway,NOR,2021,72\n", time.Now())
+	writeTestFile(t, filepath.Join(dir, "notes.txt"), "not data", time.Now())
+
+	store, err := NewStore(NewDirSource(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := store.Get()
+	assert.Equal(t, 2, c.EntityCount())
+	// The duplicate from the second file is reported with the file name
+	assert.Equal(t, []Issue{{File: "b.csv", Row: 3, Indicator: "renewables", Entity: "Norway", Code: "NOR", Year: "2021", Value: "72"}}, c.Report().Duplicates)
+
+	_, err = NewStore(NewDirSource(t.TempDir()))
+	assert.Error(t, err)
+}
+
+func TestURLSource(t *testing.T) {
+	content := testHeader + "Norway,NOR,2021,71\n"
+	downloads := 0
+
+	// Stand-in for the remote server, supporting conditional requests
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == "\"v1\"" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		downloads++
+		w.Header().Set("ETag", "\"v1\"")
+		w.Write([]byte(content))
+	}))
+
+	cacheDir := t.TempDir()
+	source := NewURLSource(server.URL+"/data.csv", cacheDir, server.Client())
+
+	store, err := NewStore(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, store.Get().EntityCount())
+	assert.Equal(t, 1, downloads)
+
+	// Unchanged on the server, so it is not downloaded again
+	assert.False(t, store.changed())
+	assert.Equal(t, 1, downloads)
+
+	// The cached copy is used while the server is down
+	server.Close()
+	files, err := source.Sync()
+	assert.NoError(t, err)
+	_, err = os.Stat(files[0])
+	assert.NoError(t, err)
+	assert.NoError(t, store.Reload())
+
+	// Without a cached copy the source can not be used
+	_, err = NewStore(NewURLSource(server.URL+"/data.csv", t.TempDir(), server.Client()))
+	assert.Error(t, err)
+}
+
+func TestURLSourceError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Not Found", http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	_, err := NewStore(NewURLSource(server.URL+"/data.csv", t.TempDir(), server.Client()))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "404")
+}
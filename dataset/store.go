@@ -0,0 +1,201 @@
+package dataset
+
+import (
+	"encoding/csv"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Load reads and parses one or more CSV files into a single collection
+func Load(filenames ...string) (*Collection, error) {
+	b := newBuilder()
+
+	for _, filename := range filenames {
+		records, err := readCSV(filename)
+		if err != nil {
+			return nil, err
+		}
+
+		// Only name the file in the quality report when there are several of them
+		name := ""
+		if len(filenames) > 1 {
+			name = filepath.Base(filename)
+		}
+		err = b.add(name, records)
+		if err != nil {
+			return nil, errors.New(filepath.Base(filename) + ": " + err.Error())
+		}
+	}
+
+	c := b.build()
+
+	// A file with only a title row is most likely a release that is still being written
+	if c.EntityCount() == 0 {
+		return nil, errors.New("the data file contains no entities")
+	}
+
+	return c, nil
+}
+
+// Read all records of a CSV file
+func readCSV(filename string) ([][]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// Rows with a different number of fields end up in the quality report rather than failing the load
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+
+	return reader.ReadAll()
+}
+
+// Store holds the collection currently being served and swaps it atomically on reload.
+// Requests should call Get once and keep using that collection, so in-flight requests
+// finish on the version they started with.
+type Store struct {
+	source  Source
+	current atomic.Value // *Collection
+
+	// Serialises reloads from the watcher and the admin endpoint
+	mu       sync.Mutex
+	version  string
+	loadedAt time.Time
+	// Called with every collection swapped in by a reload
+	hooks []func(c *Collection)
+}
+
+// NewStore loads the initial dataset from the given source
+func NewStore(source Source) (*Store, error) {
+	s := &Store{source: source}
+	err := s.Reload()
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// NewStaticStore wraps an already built collection, it can not be reloaded
+func NewStaticStore(c *Collection) *Store {
+	s := &Store{loadedAt: time.Now()}
+	s.current.Store(c)
+	return s
+}
+
+// Get returns the collection currently being served
+func (s *Store) Get() *Collection {
+	return s.current.Load().(*Collection)
+}
+
+// LoadedAt returns the time the current collection was loaded
+func (s *Store) LoadedAt() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.loadedAt
+}
+
+// OnReload registers a function to call with the new collection after every successful reload.
+// It is called after the collection has been swapped in, from the goroutine reloading.
+func (s *Store) OnReload(hook func(c *Collection)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hooks = append(s.hooks, hook)
+}
+
+// Reload parses and validates the files, and swaps them in if they are valid.
+// The dataset being served is left untouched if anything goes wrong.
+func (s *Store) Reload() error {
+	c, hooks, err := s.reload()
+	if err != nil {
+		return err
+	}
+	// Outside the lock, so hooks can use the store
+	for _, hook := range hooks {
+		hook(c)
+	}
+	return nil
+}
+
+// Reload and return the new collection with the hooks to call
+func (s *Store) reload() (*Collection, []func(c *Collection), error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.source == nil {
+		return nil, nil, errors.New("the dataset was not loaded from a source")
+	}
+
+	files, err := s.source.Sync()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	v, err := version(files)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Remember the version even if it is invalid, so the watcher only retries once it changes again
+	s.version = v
+
+	c, err := Load(files...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.current.Store(c)
+	s.loadedAt = time.Now()
+	log.Println("Dataset loaded from", s.source, "with", c.EntityCount(), "entities and", len(c.datasets), "indicators")
+	c.report.log()
+
+	return c, append([]func(c *Collection){}, s.hooks...), nil
+}
+
+// Check if the source has changed since it was last loaded
+func (s *Store) changed() bool {
+	files, err := s.source.Sync()
+	if err != nil {
+		log.Println("E: Failed to check the data source for changes. Error:", err.Error())
+		return false
+	}
+	v, err := version(files)
+	if err != nil {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return v != s.version
+}
+
+// Watch polls the source and reloads the dataset when it changes, until stop is closed
+func (s *Store) Watch(interval time.Duration, stop <-chan struct{}) {
+	if s.source == nil {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if !s.changed() {
+				continue
+			}
+			log.Println("Data source changed, reloading", s.source)
+			err := s.Reload()
+			if err != nil {
+				log.Println("E: Failed to reload the dataset, keeping the current version. Error:", err.Error())
+			}
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package dataset
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testHeader = "Entity,Code,Year,Renewables (% equivalent primary energy)\n"
+
+// Write a data file and make sure its modification time differs from the previous version
+func writeTestFile(t *testing.T, filename string, content string, modTime time.Time) {
+	err := os.WriteFile(filename, []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chtimes(filename, modTime, modTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStoreReload(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "data.csv")
+	start := time.Now().Add(-time.Hour)
+	writeTestFile(t, filename, testHeader+"Norway,NOR,2021,71\n", start)
+
+	store, err := NewStore(NewFileSource(filename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := store.Get()
+	assert.Equal(t, 1, old.EntityCount())
+	assert.False(t, store.changed())
+
+	reloaded := []*Collection{}
+	store.OnReload(func(c *Collection) {
+		reloaded = append(reloaded, c)
+	})
+
+	// A new release with an extra country
+	writeTestFile(t, filename, testHeader+"Norway,NOR,2021,71\nSweden,SWE,2021,50\n", start.Add(time.Minute))
+	assert.True(t, store.changed())
+	assert.NoError(t, store.Reload())
+	assert.Equal(t, []*Collection{store.Get()}, reloaded)
+
+	assert.Equal(t, 2, store.Get().EntityCount())
+	assert.Equal(t, "swe", store.Get().CodeMapping()["sweden"])
+	// Requests holding the old version are unaffected
+	assert.Equal(t, 1, old.EntityCount())
+}
+
+func TestStoreReloadInvalid(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "data.csv")
+	start := time.Now().Add(-time.Hour)
+	writeTestFile(t, filename, testHeader+"Norway,NOR,2021,71\n", start)
+
+	store, err := NewStore(NewFileSource(filename))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store.OnReload(func(c *Collection) {
+		t.Error("The hooks are called after an invalid reload")
+	})
+
+	// A file that is only partially written
+	writeTestFile(t, filename, testHeader, start.Add(time.Minute))
+	assert.Error(t, store.Reload())
+	assert.Equal(t, 1, store.Get().EntityCount())
+
+	// The watcher does not retry the same invalid version
+	assert.False(t, store.changed())
+}
+
+func TestStoreWatch(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "data.csv")
+	start := time.Now().Add(-time.Hour)
+	writeTestFile(t, filename, testHeader+"Norway,NOR,2021,71\n", start)
+
+	store, err := NewStore(NewFileSource(filename))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go store.Watch(10*time.Millisecond, stop)
+
+	writeTestFile(t, filename, testHeader+"Norway,NOR,2021,71\nSweden,SWE,2021,50\n", start.Add(time.Minute))
+	assert.Eventually(t, func() bool {
+		return store.Get().EntityCount() == 2
+	}, time.Second, 10*time.Millisecond)
+}
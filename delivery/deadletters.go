@@ -0,0 +1,190 @@
+package delivery
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// DEFAULT_MAX_DEAD_LETTERS Dead letters kept when no limit has been set, the oldest are dropped first
+const DEFAULT_MAX_DEAD_LETTERS = 1000
+
+// ErrNotFound is returned when there is no dead letter with the ID asked for
+var ErrNotFound = errors.New("dead letter not found")
+
+// DeadLetterStore keeps the deliveries that could not be sent
+type DeadLetterStore interface {
+	Add(delivery Delivery) error
+	// List returns all dead letters, oldest first
+	List() ([]Delivery, error)
+	Get(id string) (Delivery, error)
+	Remove(id string) error
+}
+
+// MemoryDeadLetters keeps dead letters in memory, they are lost when the service stops
+type MemoryDeadLetters struct {
+	mu      sync.RWMutex
+	max     int
+	letters map[string]Delivery
+}
+
+// NewMemoryDeadLetters keeps up to max dead letters, DEFAULT_MAX_DEAD_LETTERS if max is 0
+func NewMemoryDeadLetters(max int) *MemoryDeadLetters {
+	if max <= 0 {
+		max = DEFAULT_MAX_DEAD_LETTERS
+	}
+	return &MemoryDeadLetters{max: max, letters: make(map[string]Delivery)}
+}
+
+// Sort deliveries by when they failed, by ID when at the same time
+func sortDeliveries(deliveries []Delivery) {
+	sort.Slice(deliveries, func(i, j int) bool {
+		if !deliveries[i].Failed.Equal(deliveries[j].Failed) {
+			return deliveries[i].Failed.Before(deliveries[j].Failed)
+		}
+		return deliveries[i].ID < deliveries[j].ID
+	})
+}
+
+func (s *MemoryDeadLetters) list() []Delivery {
+	letters := []Delivery{}
+	for _, letter := range s.letters {
+		letters = append(letters, letter)
+	}
+	sortDeliveries(letters)
+	return letters
+}
+
+func (s *MemoryDeadLetters) Add(delivery Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.letters[delivery.ID] = delivery
+	if len(s.letters) > s.max {
+		for _, letter := range s.list()[:len(s.letters)-s.max] {
+			delete(s.letters, letter.ID)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryDeadLetters) List() ([]Delivery, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.list(), nil
+}
+
+func (s *MemoryDeadLetters) Get(id string) (Delivery, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	letter, ok := s.letters[id]
+	if !ok {
+		return Delivery{}, ErrNotFound
+	}
+	return letter, nil
+}
+
+func (s *MemoryDeadLetters) Remove(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.letters[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.letters, id)
+	return nil
+}
+
+// FileDeadLetters keeps dead letters in memory and writes all of them to a JSON file on every change
+type FileDeadLetters struct {
+	filename string
+	// Held while changing and saving, so the file always matches the memory
+	mu     sync.Mutex
+	memory *MemoryDeadLetters
+}
+
+// NewFileDeadLetters opens the dead letters of a file, the file is created on the first change if it does not exist
+func NewFileDeadLetters(filename string, max int) (*FileDeadLetters, error) {
+	s := &FileDeadLetters{filename: filename, memory: NewMemoryDeadLetters(max)}
+
+	content, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read the dead letter file: %w", err)
+	}
+
+	letters := []Delivery{}
+	err = json.Unmarshal(content, &letters)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode the dead letter file %s: %w", filename, err)
+	}
+	for _, letter := range letters {
+		s.memory.Add(letter)
+	}
+	return s, nil
+}
+
+// Write all dead letters to a temporary file and move it in place, so a crash never leaves half a file
+func (s *FileDeadLetters) save() error {
+	letters, _ := s.memory.List()
+	content, err := json.MarshalIndent(letters, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.filename), filepath.Base(s.filename)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("could not write the dead letter file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("could not write the dead letter file: %w", err)
+	}
+	return os.Rename(tmp.Name(), s.filename)
+}
+
+func (s *FileDeadLetters) Add(delivery Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.memory.Add(delivery)
+	// Kept in memory even if the file can not be written, a dead letter is better late than lost
+	return s.save()
+}
+
+func (s *FileDeadLetters) List() ([]Delivery, error) {
+	return s.memory.List()
+}
+
+func (s *FileDeadLetters) Get(id string) (Delivery, error) {
+	return s.memory.Get(id)
+}
+
+func (s *FileDeadLetters) Remove(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	letter, err := s.memory.Get(id)
+	if err != nil {
+		return err
+	}
+	s.memory.Remove(id)
+	err = s.save()
+	if err != nil {
+		s.memory.Add(letter)
+		return err
+	}
+	return nil
+}
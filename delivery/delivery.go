@@ -0,0 +1,386 @@
+// Package delivery sends notifications to webhooks with a bounded pool of workers,
+// retrying failed attempts with backoff and keeping those that never succeed as dead letters.
+package delivery
+
+import (
+	"assignment-2/signature"
+	"assignment-2/urlpolicy"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	mathrand "math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Settings used when the config leaves them empty
+const DEFAULT_WORKERS = 4
+const DEFAULT_QUEUE_SIZE = 1000
+const DEFAULT_TIMEOUT = 10 * time.Second
+const DEFAULT_MAX_ATTEMPTS = 5
+const DEFAULT_BACKOFF = time.Second
+const DEFAULT_MAX_BACKOFF = 5 * time.Minute
+
+// MAX_RESPONSE_BODY Bytes of the body of a response that are kept
+const MAX_RESPONSE_BODY = 4096
+
+// ErrQueueFull is returned when a delivery can not be queued, it is kept as a dead letter instead
+var ErrQueueFull = errors.New("the delivery queue is full")
+
+// ErrStopped is returned when a delivery is queued after the dispatcher has been closed
+var ErrStopped = errors.New("the dispatcher has been stopped")
+
+// Delivery is a notification to send to a webhook
+type Delivery struct {
+	ID        string `json:"id"`
+	WebhookID string `json:"webhook_id"`
+	URL       string `json:"url"`
+	// The country and number of calls notified about
+	Country string `json:"country"`
+	Calls   int    `json:"calls"`
+	// Key the body is signed with, never shown. Empty for webhooks registered before notifications were signed.
+	Secret    string          `json:"-"`
+	Body      json.RawMessage `json:"body"`
+	Attempts  int             `json:"attempts"`
+	LastError string          `json:"last_error,omitempty"`
+	Created   time.Time       `json:"created"`
+	// When the delivery was given up and became a dead letter
+	Failed time.Time `json:"failed"`
+}
+
+// Response is what a receiver answered to an attempt
+type Response struct {
+	// 0 if the receiver did not answer
+	StatusCode int
+	// The start of the body, up to MAX_RESPONSE_BODY bytes
+	Body    []byte
+	Latency time.Duration
+}
+
+// StatusError is a response from a webhook that is not 2xx
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("the webhook responded with status %d", e.StatusCode)
+}
+
+// An error that trying again will not fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Network errors and 5xx responses may go away, anything else will not
+func retryable(err error) bool {
+	var permanent *permanentError
+	if errors.As(err, &permanent) || errors.Is(err, urlpolicy.ErrForbidden) {
+		return false
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500
+	}
+	return true
+}
+
+// Config of a dispatcher
+type Config struct {
+	// Number of deliveries sent at the same time
+	Workers int
+	// Number of deliveries that can wait for a worker
+	QueueSize int
+	// How long a single attempt may take
+	Timeout time.Duration
+	// Attempts before a delivery becomes a dead letter
+	MaxAttempts int
+	// Wait before the first retry, doubled for every following retry up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Which URLs and addresses deliveries may be sent to, checked on every attempt. Any if nil.
+	Policy *urlpolicy.Policy
+}
+
+// Dispatcher sends deliveries in the background
+type Dispatcher struct {
+	config      Config
+	client      *http.Client
+	deadLetters DeadLetterStore
+	log         Log
+
+	queue chan Delivery
+	stop  chan struct{}
+	// Held for reading while queuing, so the queue is not sent on after it has been drained
+	mu      sync.RWMutex
+	stopped bool
+	wg      sync.WaitGroup
+
+	resultsMu sync.Mutex
+	results   []func(delivery Delivery, err error)
+}
+
+// New starts a dispatcher, every attempt is recorded in attemptLog and deliveries that fail are added to deadLetters
+func New(config Config, deadLetters DeadLetterStore, attemptLog Log) *Dispatcher {
+	if config.Workers <= 0 {
+		config.Workers = DEFAULT_WORKERS
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = DEFAULT_QUEUE_SIZE
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DEFAULT_TIMEOUT
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = DEFAULT_MAX_ATTEMPTS
+	}
+	if config.Backoff <= 0 {
+		config.Backoff = DEFAULT_BACKOFF
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = DEFAULT_MAX_BACKOFF
+	}
+
+	client := &http.Client{}
+	if config.Policy != nil {
+		// Connections go straight to the checked address, also after redirects
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.Proxy = nil
+		transport.DialContext = config.Policy.DialContext
+		client.Transport = transport
+	}
+
+	d := &Dispatcher{
+		config:      config,
+		client:      client,
+		deadLetters: deadLetters,
+		log:         attemptLog,
+		queue:       make(chan Delivery, config.QueueSize),
+		stop:        make(chan struct{}),
+	}
+	for i := 0; i < config.Workers; i++ {
+		d.wg.Add(1)
+		go d.work()
+	}
+	return d
+}
+
+// OnResult adds a function called when a delivery has succeeded, with a nil error, or has been given up
+// after failing, with the last error. It is not called for deliveries given up because the dispatcher stopped.
+func (d *Dispatcher) OnResult(hook func(delivery Delivery, err error)) {
+	d.resultsMu.Lock()
+	defer d.resultsMu.Unlock()
+	d.results = append(d.results, hook)
+}
+
+// Call the result hooks
+func (d *Dispatcher) result(delivery Delivery, err error) {
+	d.resultsMu.Lock()
+	hooks := append([]func(delivery Delivery, err error){}, d.results...)
+	d.resultsMu.Unlock()
+	for _, hook := range hooks {
+		hook(delivery, err)
+	}
+}
+
+func newID() (string, error) {
+	id := make([]byte, 12)
+	_, err := rand.Read(id)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// Enqueue queues a delivery to be sent. A delivery that can not be queued is kept as a dead letter.
+func (d *Dispatcher) Enqueue(delivery Delivery) error {
+	if delivery.ID == "" {
+		id, err := newID()
+		if err != nil {
+			return err
+		}
+		delivery.ID = id
+	}
+	if delivery.Created.IsZero() {
+		delivery.Created = time.Now().UTC()
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.stopped {
+		return ErrStopped
+	}
+
+	select {
+	case d.queue <- delivery:
+		return nil
+	default:
+		delivery.LastError = ErrQueueFull.Error()
+		d.bury(delivery)
+		return ErrQueueFull
+	}
+}
+
+// Close stops the workers, deliveries still waiting are kept as dead letters
+func (d *Dispatcher) Close() error {
+	d.mu.Lock()
+	if d.stopped {
+		d.mu.Unlock()
+		return nil
+	}
+	d.stopped = true
+	close(d.stop)
+	d.mu.Unlock()
+
+	d.wg.Wait()
+	for {
+		select {
+		case delivery := <-d.queue:
+			delivery.LastError = ErrStopped.Error()
+			d.bury(delivery)
+		default:
+			return nil
+		}
+	}
+}
+
+func (d *Dispatcher) work() {
+	defer d.wg.Done()
+	for {
+		select {
+		case <-d.stop:
+			return
+		case delivery := <-d.queue:
+			d.deliver(delivery)
+		}
+	}
+}
+
+// Try a delivery until it succeeds, fails for good or runs out of attempts
+func (d *Dispatcher) deliver(delivery Delivery) {
+	for {
+		delivery.Attempts++
+		response, err := d.attempt(delivery)
+		d.record(delivery, response, err)
+		if err == nil {
+			d.result(delivery, nil)
+			return
+		}
+		delivery.LastError = err.Error()
+		log.Printf("Delivery %s to webhook %s failed (attempt %d). Error: %s\n",
+			delivery.ID, delivery.WebhookID, delivery.Attempts, err.Error())
+
+		if !retryable(err) || delivery.Attempts >= d.config.MaxAttempts {
+			d.bury(delivery)
+			d.result(delivery, err)
+			return
+		}
+
+		timer := time.NewTimer(d.backoff(delivery.Attempts))
+		select {
+		case <-timer.C:
+		case <-d.stop:
+			timer.Stop()
+			d.bury(delivery)
+			return
+		}
+	}
+}
+
+// Exponential backoff after an attempt, with jitter so receivers coming back up are not hit all at once
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	wait := d.config.Backoff
+	for i := 1; i < attempts && wait < d.config.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > d.config.MaxBackoff {
+		wait = d.config.MaxBackoff
+	}
+	// Somewhere between half and all of it
+	return wait/2 + time.Duration(mathrand.Int63n(int64(wait/2)+1))
+}
+
+// Record an attempt in the log
+func (d *Dispatcher) record(delivery Delivery, response Response, err error) {
+	attempt := Attempt{
+		WebhookID:  delivery.WebhookID,
+		DeliveryID: delivery.ID,
+		Country:    delivery.Country,
+		Calls:      delivery.Calls,
+		Attempt:    delivery.Attempts,
+		StatusCode: response.StatusCode,
+		Latency:    response.Latency,
+		Time:       time.Now().UTC(),
+	}
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+	logErr := d.log.Record(attempt)
+	if logErr != nil {
+		log.Println("E: Could not record the attempt of delivery", delivery.ID, "Error:", logErr.Error())
+	}
+}
+
+// Send tries a delivery once and waits for the answer, an error is returned if it is not 2xx.
+// It is not retried, not recorded in the log and never becomes a dead letter.
+func (d *Dispatcher) Send(delivery Delivery) (Response, error) {
+	return d.attempt(delivery)
+}
+
+// Send a delivery once, signed at the time it is sent
+func (d *Dispatcher) attempt(delivery Delivery) (Response, error) {
+	if d.config.Policy != nil {
+		err := d.config.Policy.CheckURL(delivery.URL)
+		if err != nil {
+			return Response{}, err
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), d.config.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Body))
+	if err != nil {
+		return Response{}, &permanentError{err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if delivery.Secret != "" {
+		req.Header.Set(signature.HEADER, signature.Sign(delivery.Secret, delivery.Body, time.Now()))
+	}
+
+	start := time.Now()
+	res, err := d.client.Do(req)
+	if err != nil {
+		return Response{Latency: time.Since(start)}, err
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(res.Body, MAX_RESPONSE_BODY))
+	response := Response{StatusCode: res.StatusCode, Body: body, Latency: time.Since(start)}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return response, &StatusError{StatusCode: res.StatusCode}
+	}
+	return response, nil
+}
+
+// Keep a delivery that was given up as a dead letter
+func (d *Dispatcher) bury(delivery Delivery) {
+	delivery.Failed = time.Now().UTC()
+	err := d.deadLetters.Add(delivery)
+	if err != nil {
+		log.Println("E: Lost delivery", delivery.ID, "to webhook", delivery.WebhookID, "Error:", err.Error())
+	}
+}
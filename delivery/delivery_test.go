@@ -0,0 +1,317 @@
+package delivery
+
+import (
+	"assignment-2/signature"
+	"assignment-2/urlpolicy"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Settings that retry quickly
+var testConfig = Config{Workers: 2, Timeout: time.Second, MaxAttempts: 3, Backoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond}
+
+// Wait until a dead letter has been added, or fail
+func waitForDeadLetter(t *testing.T, deadLetters DeadLetterStore) Delivery {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		letters, _ := deadLetters.List()
+		if len(letters) > 0 {
+			return letters[0]
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("No dead letter was added")
+	return Delivery{}
+}
+
+func TestDeliverRetries(t *testing.T) {
+	secret := "a secret of the receiver"
+	received := make(chan error, 10)
+	var calls int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The receiver is being redeployed for the first two attempts
+		if atomic.AddInt32(&calls, 1) <= 2 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		received <- signature.Verify(secret, body, r.Header.Get(signature.HEADER), signature.DEFAULT_TOLERANCE)
+	}))
+	defer receiver.Close()
+
+	deadLetters := NewMemoryDeadLetters(0)
+	attemptLog := NewMemoryLog(0)
+	dispatcher := New(testConfig, deadLetters, attemptLog)
+	defer dispatcher.Close()
+
+	assert.NoError(t, dispatcher.Enqueue(Delivery{WebhookID: "a", URL: receiver.URL, Country: "NOR", Calls: 1, Secret: secret, Body: []byte(`{"calls":1}`)}))
+
+	select {
+	case err := <-received:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("The delivery was not received")
+	}
+	assert.EqualValues(t, 3, atomic.LoadInt32(&calls))
+	letters, _ := deadLetters.List()
+	assert.Empty(t, letters)
+
+	// Every attempt is in the log, the last one first. It is recorded after the response has been read.
+	var attempts []Attempt
+	total := 0
+	for deadline := time.Now().Add(5 * time.Second); total < 3 && time.Now().Before(deadline); {
+		time.Sleep(5 * time.Millisecond)
+		attempts, total, _ = attemptLog.Attempts("a", 0, 10)
+	}
+	assert.Equal(t, 3, total)
+	if assert.Len(t, attempts, 3) {
+		assert.Equal(t, 3, attempts[0].Attempt)
+		assert.Equal(t, http.StatusOK, attempts[0].StatusCode)
+		assert.Empty(t, attempts[0].Error)
+		assert.Equal(t, "NOR", attempts[0].Country)
+		assert.Equal(t, http.StatusBadGateway, attempts[2].StatusCode)
+		assert.NotEmpty(t, attempts[2].Error)
+	}
+}
+
+func TestDeliverDeadLetter(t *testing.T) {
+	tests := []struct {
+		description string
+		status      int
+		attempts    int
+	}{
+		{"Server error until the last attempt", http.StatusInternalServerError, 3},
+		{"Client error is not retried", http.StatusGone, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(test.status)
+			}))
+			defer receiver.Close()
+
+			deadLetters := NewMemoryDeadLetters(0)
+			dispatcher := New(testConfig, deadLetters, NewMemoryLog(0))
+			defer dispatcher.Close()
+
+			assert.NoError(t, dispatcher.Enqueue(Delivery{WebhookID: "a", URL: receiver.URL, Body: []byte(`{}`)}))
+			letter := waitForDeadLetter(t, deadLetters)
+			assert.Equal(t, test.attempts, letter.Attempts)
+			assert.Equal(t, "a", letter.WebhookID)
+			assert.Contains(t, letter.LastError, "status")
+			assert.False(t, letter.Failed.IsZero())
+		})
+	}
+}
+
+func TestOnResult(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/gone" {
+			w.WriteHeader(http.StatusGone)
+		}
+	}))
+	defer receiver.Close()
+
+	dispatcher := New(testConfig, NewMemoryDeadLetters(0), NewMemoryLog(0))
+	defer dispatcher.Close()
+	results := make(chan error, 2)
+	dispatcher.OnResult(func(delivery Delivery, err error) {
+		results <- err
+	})
+
+	for _, path := range []string{"/", "/gone"} {
+		assert.NoError(t, dispatcher.Enqueue(Delivery{WebhookID: "a", URL: receiver.URL + path, Body: []byte(`{}`)}))
+		select {
+		case err := <-results:
+			if path == "/" {
+				assert.NoError(t, err)
+			} else {
+				var statusErr *StatusError
+				assert.ErrorAs(t, err, &statusErr)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("No result for", path)
+		}
+	}
+}
+
+func TestDeliverNetworkError(t *testing.T) {
+	// A receiver that is gone
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	receiver.Close()
+
+	deadLetters := NewMemoryDeadLetters(0)
+	dispatcher := New(testConfig, deadLetters, NewMemoryLog(0))
+	defer dispatcher.Close()
+
+	assert.NoError(t, dispatcher.Enqueue(Delivery{WebhookID: "a", URL: receiver.URL, Body: []byte(`{}`)}))
+	assert.Equal(t, testConfig.MaxAttempts, waitForDeadLetter(t, deadLetters).Attempts)
+}
+
+func TestSend(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if string(body) == "fail" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		w.Write([]byte("got " + string(body)))
+	}))
+	defer receiver.Close()
+
+	deadLetters := NewMemoryDeadLetters(0)
+	attemptLog := NewMemoryLog(0)
+	dispatcher := New(testConfig, deadLetters, attemptLog)
+	defer dispatcher.Close()
+
+	response, err := dispatcher.Send(Delivery{WebhookID: "a", URL: receiver.URL, Body: []byte("hello")})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "got hello", string(response.Body))
+
+	// Failures are only returned
+	response, err = dispatcher.Send(Delivery{WebhookID: "a", URL: receiver.URL, Body: []byte("fail")})
+	var statusErr *StatusError
+	assert.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, http.StatusNotFound, response.StatusCode)
+	letters, _ := deadLetters.List()
+	assert.Empty(t, letters)
+	_, total, _ := attemptLog.Attempts("a", 0, 10)
+	assert.Equal(t, 0, total)
+}
+
+func TestDeliverForbidden(t *testing.T) {
+	var calls int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}))
+	defer receiver.Close()
+
+	// The receiver is on the loopback address, which is not allowed
+	config := testConfig
+	config.Policy, _ = urlpolicy.New(urlpolicy.Config{})
+	deadLetters := NewMemoryDeadLetters(0)
+	dispatcher := New(config, deadLetters, NewMemoryLog(0))
+	defer dispatcher.Close()
+
+	assert.NoError(t, dispatcher.Enqueue(Delivery{WebhookID: "a", URL: receiver.URL, Body: []byte(`{}`)}))
+	letter := waitForDeadLetter(t, deadLetters)
+	assert.Equal(t, 1, letter.Attempts)
+	assert.Contains(t, letter.LastError, "internal")
+	assert.EqualValues(t, 0, atomic.LoadInt32(&calls))
+}
+
+func TestBackoff(t *testing.T) {
+	dispatcher := &Dispatcher{config: Config{Backoff: time.Second, MaxBackoff: 10 * time.Second}}
+
+	for attempts, max := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 10: 10 * time.Second} {
+		wait := dispatcher.backoff(attempts)
+		assert.True(t, wait >= max/2 && wait <= max, "Attempt %d waits %s", attempts, wait)
+	}
+}
+
+func TestEnqueueStopped(t *testing.T) {
+	dispatcher := New(testConfig, NewMemoryDeadLetters(0), NewMemoryLog(0))
+	assert.NoError(t, dispatcher.Close())
+	assert.ErrorIs(t, dispatcher.Enqueue(Delivery{URL: "http://example.com"}), ErrStopped)
+}
+
+func TestMemoryDeadLettersLimit(t *testing.T) {
+	deadLetters := NewMemoryDeadLetters(2)
+	start := time.Now()
+	for i, id := range []string{"a", "b", "c"} {
+		assert.NoError(t, deadLetters.Add(Delivery{ID: id, Failed: start.Add(time.Duration(i) * time.Second)}))
+	}
+
+	letters, _ := deadLetters.List()
+	assert.Len(t, letters, 2)
+	assert.Equal(t, "b", letters[0].ID)
+	_, err := deadLetters.Get("a")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestFileDeadLetters(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "dead-letters.json")
+	deadLetters, err := NewFileDeadLetters(filename, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, deadLetters.Add(Delivery{ID: "a", WebhookID: "w", Secret: "not written", Body: []byte(`{"calls":1}`)}))
+	assert.NoError(t, deadLetters.Add(Delivery{ID: "b", WebhookID: "w", Body: []byte(`{"calls":2}`)}))
+	assert.NoError(t, deadLetters.Remove("b"))
+	assert.ErrorIs(t, deadLetters.Remove("b"), ErrNotFound)
+
+	reopened, err := NewFileDeadLetters(filename, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	letters, _ := reopened.List()
+	assert.Len(t, letters, 1)
+	assert.Equal(t, "a", letters[0].ID)
+	assert.Empty(t, letters[0].Secret)
+	assert.JSONEq(t, `{"calls":1}`, string(letters[0].Body))
+}
+
+func TestMemoryLog(t *testing.T) {
+	attemptLog := NewMemoryLog(3)
+	for i := 1; i <= 4; i++ {
+		assert.NoError(t, attemptLog.Record(Attempt{WebhookID: "a", Attempt: i}))
+	}
+	assert.NoError(t, attemptLog.Record(Attempt{WebhookID: "b", Attempt: 1}))
+
+	attempts, total, err := attemptLog.Attempts("a", 0, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, total)
+	assert.Equal(t, []Attempt{{WebhookID: "a", Attempt: 4}, {WebhookID: "a", Attempt: 3}}, attempts)
+
+	attempts, _, _ = attemptLog.Attempts("a", 2, 2)
+	assert.Equal(t, []Attempt{{WebhookID: "a", Attempt: 2}}, attempts)
+
+	attempts, total, _ = attemptLog.Attempts("c", 0, 2)
+	assert.Equal(t, 0, total)
+	assert.Empty(t, attempts)
+}
+
+func TestFileLog(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "attempts.jsonl")
+	attemptLog, err := NewFileLog(filename, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Enough attempts for the file to be rewritten on the way
+	for i := 1; i <= 20; i++ {
+		assert.NoError(t, attemptLog.Record(Attempt{WebhookID: "a", Attempt: i, Error: "timeout"}))
+	}
+	assert.NoError(t, attemptLog.Record(Attempt{WebhookID: "b", Attempt: 1, StatusCode: 200}))
+	assert.NoError(t, attemptLog.Close())
+
+	reopened, err := NewFileLog(filename, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	attempts, total, err := reopened.Attempts("a", 0, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, total)
+	assert.Equal(t, []int{20, 19, 18}, []int{attempts[0].Attempt, attempts[1].Attempt, attempts[2].Attempt})
+	assert.Equal(t, "timeout", attempts[0].Error)
+	attempts, _, _ = reopened.Attempts("b", 0, 10)
+	assert.Equal(t, []Attempt{{WebhookID: "b", Attempt: 1, StatusCode: 200}}, attempts)
+
+	// Only the attempts kept are written back
+	content, err := os.ReadFile(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, strings.Count(string(content), "\n"))
+
+	assert.NoError(t, os.WriteFile(filename, []byte("not json\n"), 0644))
+	_, err = NewFileLog(filename, 3)
+	assert.Error(t, err)
+}
@@ -0,0 +1,212 @@
+package delivery
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DEFAULT_LOG_SIZE Attempts kept per webhook when no limit has been set, the oldest are dropped first
+const DEFAULT_LOG_SIZE = 200
+
+// Attempt is one try at sending a delivery
+type Attempt struct {
+	WebhookID  string `json:"webhook_id"`
+	DeliveryID string `json:"delivery_id"`
+	Country    string `json:"country,omitempty"`
+	Calls      int    `json:"calls,omitempty"`
+	// 1 for the first try of a delivery
+	Attempt int `json:"attempt"`
+	// Status code the receiver answered with, 0 if it did not answer
+	StatusCode int           `json:"status_code"`
+	Latency    time.Duration `json:"latency"`
+	// Why the attempt failed, empty if it succeeded
+	Error string    `json:"error,omitempty"`
+	Time  time.Time `json:"time"`
+}
+
+// Log records the attempts of deliveries
+type Log interface {
+	Record(attempt Attempt) error
+	// Attempts returns a page of the attempts of a webhook, newest first, and the number of attempts there are
+	Attempts(webhookID string, offset int, limit int) ([]Attempt, int, error)
+}
+
+// MemoryLog keeps the latest attempts of every webhook in memory, they are lost when the service stops
+type MemoryLog struct {
+	mu   sync.RWMutex
+	size int
+	// Attempts of each webhook, oldest first
+	attempts map[string][]Attempt
+}
+
+// NewMemoryLog keeps up to size attempts per webhook, DEFAULT_LOG_SIZE if size is 0
+func NewMemoryLog(size int) *MemoryLog {
+	if size <= 0 {
+		size = DEFAULT_LOG_SIZE
+	}
+	return &MemoryLog{size: size, attempts: make(map[string][]Attempt)}
+}
+
+func (l *MemoryLog) Record(attempt Attempt) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	attempts := append(l.attempts[attempt.WebhookID], attempt)
+	if len(attempts) > l.size {
+		attempts = append([]Attempt{}, attempts[len(attempts)-l.size:]...)
+	}
+	l.attempts[attempt.WebhookID] = attempts
+	return nil
+}
+
+// All the attempts kept, of every webhook, oldest first for each webhook
+func (l *MemoryLog) all() []Attempt {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	all := []Attempt{}
+	for _, attempts := range l.attempts {
+		all = append(all, attempts...)
+	}
+	return all
+}
+
+func (l *MemoryLog) Attempts(webhookID string, offset int, limit int) ([]Attempt, int, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	attempts := l.attempts[webhookID]
+	page := []Attempt{}
+	for i := len(attempts) - 1 - offset; i >= 0 && len(page) < limit; i-- {
+		page = append(page, attempts[i])
+	}
+	return page, len(attempts), nil
+}
+
+// FileLog keeps the latest attempts of every webhook in memory and appends every attempt to a file of JSON lines,
+// so they are still there after a restart. The file is rewritten with only the attempts kept when it has grown.
+type FileLog struct {
+	filename string
+	// Held while recording, so lines are not interleaved and the file is not appended to while it is rewritten
+	mu     sync.Mutex
+	memory *MemoryLog
+	file   *os.File
+	// Lines in the file, and the number it may grow to before it is rewritten
+	lines   int
+	compact int
+}
+
+// NewFileLog opens the log of a file, keeping up to size attempts per webhook like NewMemoryLog.
+// The file is created if it does not exist.
+func NewFileLog(filename string, size int) (*FileLog, error) {
+	l := &FileLog{filename: filename, memory: NewMemoryLog(size)}
+
+	file, err := os.Open(filename)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("could not read the delivery log: %w", err)
+	}
+	if err == nil {
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for line := 1; scanner.Scan(); line++ {
+			attempt := Attempt{}
+			err = json.Unmarshal(scanner.Bytes(), &attempt)
+			if err != nil {
+				return nil, fmt.Errorf("could not decode line %d of the delivery log %s: %w", line, filename, err)
+			}
+			l.memory.Record(attempt)
+		}
+		if err = scanner.Err(); err != nil {
+			return nil, fmt.Errorf("could not read the delivery log: %w", err)
+		}
+	}
+
+	err = l.rewrite()
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Write the attempts kept to a temporary file, move it in place so a crash never leaves half a file,
+// and append to it from then on
+func (l *FileLog) rewrite() error {
+	attempts := l.memory.all()
+	tmp, err := os.CreateTemp(filepath.Dir(l.filename), filepath.Base(l.filename)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("could not write the delivery log: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	writer := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(writer)
+	for _, attempt := range attempts {
+		if err = encoder.Encode(attempt); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), l.filename)
+	}
+	if err != nil {
+		return fmt.Errorf("could not write the delivery log: %w", err)
+	}
+
+	file, err := os.OpenFile(l.filename, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("could not open the delivery log: %w", err)
+	}
+	if l.file != nil {
+		l.file.Close()
+	}
+	l.file = file
+	l.lines = len(attempts)
+	// Rewritten when the attempts dropped from memory are as many as those kept, or a full log of one webhook
+	l.compact = 2*len(attempts) + l.memory.size
+	return nil
+}
+
+func (l *FileLog) Record(attempt Attempt) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.memory.Record(attempt)
+	line, err := json.Marshal(attempt)
+	if err != nil {
+		return err
+	}
+	// Kept in memory even if the file can not be written
+	_, err = l.file.Write(append(line, '\n'))
+	if err != nil {
+		return fmt.Errorf("could not write the delivery log: %w", err)
+	}
+	l.lines++
+	if l.lines > l.compact {
+		return l.rewrite()
+	}
+	return nil
+}
+
+func (l *FileLog) Attempts(webhookID string, offset int, limit int) ([]Attempt, int, error) {
+	return l.memory.Attempts(webhookID, offset, limit)
+}
+
+// Close closes the file, attempts can not be recorded after
+func (l *FileLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
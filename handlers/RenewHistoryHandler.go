@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"assignment-2/dataset"
 	"encoding/json"
 	"net/http"
 	"sort"
@@ -8,15 +9,14 @@ import (
 	"strings"
 )
 
-func RenewHistoryHandler(msg chan string) func(w http.ResponseWriter, r *http.Request) {
+func RenewHistoryHandler(data DatasetProvider, notifier Notifier) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
-			RenewHistoryGet(w, r, msg)
+			// Use the same version of the dataset for the whole request
+			RenewHistoryGet(w, r, data.Get(), notifier)
 		default:
-			http.Error(w, "REST Method '"+r.Method+"' not supported. Currently only '"+http.MethodGet+
-				" is supported.", http.StatusNotImplemented)
-
+			methodNotAllowed(w, r, http.MethodGet)
 			return
 		}
 	}
@@ -25,7 +25,7 @@ func RenewHistoryHandler(msg chan string) func(w http.ResponseWriter, r *http.Re
 /*
 Empty handler as default handler
 */
-func RenewHistoryGet(w http.ResponseWriter, r *http.Request, msg chan string) {
+func RenewHistoryGet(w http.ResponseWriter, r *http.Request, c *dataset.Collection, notifier Notifier) {
 	parts := strings.Split(r.URL.Path, "/")
 	//if the length of the split is 6. we add an empty string to ensure the bad request does not go out of bounds
 	if len(parts) == 6 {
@@ -34,7 +34,10 @@ func RenewHistoryGet(w http.ResponseWriter, r *http.Request, msg chan string) {
 
 	//Check for bad requests. Bad request means incorrect path format
 	if !(len(parts) > 5 && (len(parts) <= 7 && parts[6] == "")) {
-		http.Error(w, "unexpected format", http.StatusBadRequest)
+		writeProblem(w, r, Problem{
+			Type:   PROBLEM_INVALID_PARAMETER,
+			Detail: "Unexpected path format, expected " + RENEW_HISTORY_ENDPOINT + "{country}",
+		})
 		return
 
 	}
@@ -50,7 +53,12 @@ func RenewHistoryGet(w http.ResponseWriter, r *http.Request, msg chan string) {
 		var err error
 		begin, err = strconv.Atoi(beginQuery)
 		if err != nil {
-			http.Error(w, "Invalid parameter must be an integer", http.StatusBadRequest)
+			writeProblem(w, r, Problem{
+				Type:   PROBLEM_INVALID_PARAMETER,
+				Detail: "The begin parameter must be an integer",
+				Param:  "begin",
+				Value:  beginQuery,
+			})
 			return
 		}
 	}
@@ -59,7 +67,12 @@ func RenewHistoryGet(w http.ResponseWriter, r *http.Request, msg chan string) {
 		var err error
 		end, err = strconv.Atoi(endQuery)
 		if err != nil {
-			http.Error(w, "Invalid parameter must be an integer", http.StatusBadRequest)
+			writeProblem(w, r, Problem{
+				Type:   PROBLEM_INVALID_PARAMETER,
+				Detail: "The end parameter must be an integer",
+				Param:  "end",
+				Value:  endQuery,
+			})
 			return
 		}
 	}
@@ -73,7 +86,12 @@ func RenewHistoryGet(w http.ResponseWriter, r *http.Request, msg chan string) {
 	} else if end == 0 {
 		end = endYear
 	} else if begin > end {
-		http.Error(w, "unexpected format, year inputed is wrong", http.StatusBadRequest)
+		writeProblem(w, r, Problem{
+			Type:   PROBLEM_INVALID_PARAMETER,
+			Detail: "The begin year must not be later than the end year",
+			Param:  "begin",
+			Value:  r.URL.Query().Get("begin"),
+		})
 		return
 	}
 
@@ -84,70 +102,81 @@ func RenewHistoryGet(w http.ResponseWriter, r *http.Request, msg chan string) {
 	if sortByValueQuery != "" {
 		sortByValue, err = strconv.ParseBool(sortByValueQuery)
 		if err != nil {
-			http.Error(w, "Invalid parameter must be a bool value", http.StatusBadRequest)
+			writeProblem(w, r, Problem{
+				Type:   PROBLEM_INVALID_PARAMETER,
+				Detail: "The sortByValue parameter must be a bool value",
+				Param:  "sortByValue",
+				Value:  sortByValueQuery,
+			})
 			return
 		}
 	}
-	// Open the CSV file
-	csv, err := ReadCSV(RENEWABLE_DATA_CSV)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	// Get the indicator for url
+	ds, ok := selectIndicator(w, r, c)
+	if !ok {
+		return
+	}
+
+	// Get the region for url
+	region, computed, ok := selectRegion(w, r, ds)
+	if !ok {
+		return
+	}
+	if region != nil && isoCode != "" {
+		writeProblem(w, r, Problem{
+			Type:   PROBLEM_INVALID_PARAMETER,
+			Detail: "A country and a region can not be requested at the same time",
+			Param:  "region",
+			Value:  r.URL.Query().Get("region"),
+		})
 		return
 	}
 
 	// renew history struct
 	var rHistory []history
-	//map for storing the sum of renewables for each entity also store IsoCode.
-	EntitySums := make(map[string]map[string]float64)
-	//map for storing the count of columns for each entity also store IsoCode.
-	EntityCounts := make(map[string]map[string]int)
-
-	for _, record := range csv {
-		Entity := record[0]                                // entity column
-		code := record[1]                                  // Code column
-		renewables, _ := strconv.ParseFloat(record[3], 64) // renewables column
-
-		// making sure no countries are repeated
-		if _, ok := EntitySums[Entity]; !ok {
-			EntitySums[Entity] = make(map[string]float64)
-			EntityCounts[Entity] = make(map[string]int)
-		}
 
-		EntitySums[Entity][code] += renewables // sum of renewables for the entity plus storing IsoCode.
-		EntityCounts[Entity][code]++           // incrementing the number of columns for the entity until the next different one
-
-	}
-
-	if isoCode != "" {
-		// going thorugh the csv file
-		for i := range csv {
-			// if the isocode in the csv file is the same as the isocode from the url
-			if csv[i][1] == isoCode {
-				year, _ := strconv.Atoi(csv[i][2])                 // year column
-				renewables, _ := strconv.ParseFloat(csv[i][3], 64) // renewables column
-				// get the years
-				if year <= end && year >= begin {
-					rHistory = append(rHistory, history{
-						Entity:     csv[i][0],
-						Code:       isoCode,
-						Year:       year,
-						Percentage: renewables,
-					})
-				}
+	if region != nil {
+		// the yearly values of the region, labelled as an aggregate
+		if aggregate, ok := ds.Aggregate(*region, computed); ok {
+			for _, o := range aggregate.Range(begin, end) {
+				rHistory = append(rHistory, history{
+					Entity:     aggregate.Name,
+					Code:       aggregate.Code,
+					Year:       o.Year,
+					Percentage: o.Value,
+					Indicator:  ds.Indicator().Name,
+					Unit:       ds.Indicator().Unit,
+					Aggregate:  aggregate.Kind,
+					Countries:  o.Countries,
+				})
 			}
 		}
-	} else {
-		for name, sums := range EntitySums { // going through  Entity and sums of renewables
-			for code, sum := range sums { // going through IsoCode and sums of renewables
-				count := EntityCounts[name][code] // get the number of columns for the Entity and store isoCode
-				meanRenewables := (sum) / float64(count)
+	} else if isoCode != "" {
+		// if the isocode in the dataset is the same as the isocode from the url
+		if entity, ok := ds.ByCode(isoCode); ok {
+			// get the years
+			for _, o := range entity.Range(begin, end) {
 				rHistory = append(rHistory, history{
-					Entity:     name,
-					Code:       code,
-					Percentage: meanRenewables,
+					Entity:     entity.Name,
+					Code:       isoCode,
+					Year:       o.Year,
+					Percentage: o.Value,
+					Indicator:  ds.Indicator().Name,
+					Unit:       ds.Indicator().Unit,
 				})
 			}
 		}
+	} else {
+		// going through every entity and its mean of renewables
+		for _, entity := range ds.Entities() {
+			rHistory = append(rHistory, history{
+				Entity:     entity.Name,
+				Code:       entity.Code,
+				Percentage: entity.Mean,
+				Indicator:  ds.Indicator().Name,
+				Unit:       ds.Indicator().Unit,
+			})
+		}
 	}
 	// sorting by percentage from lowest to highest if " true " is inputted
 	if sortByValue == true {
@@ -155,13 +184,27 @@ func RenewHistoryGet(w http.ResponseWriter, r *http.Request, msg chan string) {
 			return rHistory[i].Percentage < rHistory[j].Percentage
 		})
 	}
+	if region != nil && len(rHistory) == 0 {
+		writeProblem(w, r, Problem{
+			Type:   PROBLEM_NOT_FOUND,
+			Detail: "There are no data available for the region '" + region.Name + "'",
+			Param:  "region",
+			Value:  r.URL.Query().Get("region"),
+		})
+		return
+	}
 	if len(rHistory) == 0 {
-		http.Error(w, "iso code not found", http.StatusBadRequest)
+		writeProblem(w, r, Problem{
+			Type:   PROBLEM_INVALID_PARAMETER,
+			Detail: "ISO code not found",
+			Param:  "country",
+			Value:  isoCode,
+		})
 		return
 	}
 
 	if len(rHistory) != 0 && isoCode != "" {
-		msg <- strings.ToLower(isoCode)
+		notifier.Notify(isoCode)
 	}
 
 	// Set the API response headers
@@ -170,10 +213,8 @@ func RenewHistoryGet(w http.ResponseWriter, r *http.Request, msg chan string) {
 	// Encode rHistory
 	err = json.NewEncoder(w).Encode(rHistory)
 	if err != nil {
-		http.Error(w, "Error during encoding"+err.Error(), http.StatusInternalServerError)
+		writeProblem(w, r, Problem{Type: PROBLEM_INTERNAL, Detail: "Error during encoding: " + err.Error()})
 		return
-	} else {
-		http.Error(w, "", http.StatusNoContent)
 	}
 
 }
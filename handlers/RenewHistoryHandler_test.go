@@ -1,10 +1,10 @@
 package handlers
 
 import (
+	"assignment-2/dataset"
 	"encoding/json"
 	"fmt"
 	"github.com/stretchr/testify/assert"
-	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -25,12 +25,21 @@ func init() {
 	}
 }
 
+// Load the renewables dataset used by the handlers
+func loadTestStore(t *testing.T) *dataset.Store {
+	store, err := dataset.NewStore(dataset.NewFileSource(RENEWABLE_DATA_CSV))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
 func TestRenewHistoryGet(t *testing.T) {
 
-	msg := make(chan string)
+	msg := make(chan string, 10)
 
 	// Initialize handler instance
-	handler := RenewHistoryHandler(msg)
+	handler := RenewHistoryHandler(loadTestStore(t), ChannelNotifier(msg))
 
 	// Set up infrastructure to be used for invocation - important: wrap handler function in http.HandlerFunc()
 	server := httptest.NewServer(http.HandlerFunc(handler))
@@ -58,8 +67,8 @@ func TestRenewHistoryGet(t *testing.T) {
 	}
 	//Expected output
 	expected := []history{
-		{Entity: "Norway", Code: "NOR", Year: 1965, Percentage: 67.87996},
-		{Entity: "Norway", Code: "NOR", Year: 1966, Percentage: 65.3991},
+		{Entity: "Norway", Code: "NOR", Year: 1965, Percentage: 67.87996, Indicator: "renewables", Unit: "% equivalent primary energy"},
+		{Entity: "Norway", Code: "NOR", Year: 1966, Percentage: 65.3991, Indicator: "renewables", Unit: "% equivalent primary energy"},
 	}
 
 	assert.EqualValues(t, expected, testStruct, "The expected and actual output should be the same")
@@ -70,10 +79,10 @@ func TestRenewHistoryGet(t *testing.T) {
 
 func TestMean(t *testing.T) {
 
-	msg := make(chan string)
+	msg := make(chan string, 10)
 
 	// Initialize handler instance
-	handler := RenewHistoryHandler(msg)
+	handler := RenewHistoryHandler(loadTestStore(t), ChannelNotifier(msg))
 
 	// Set up infrastructure to be used for invocation - important: wrap handler function in http.HandlerFunc()
 	server := httptest.NewServer(http.HandlerFunc(handler))
@@ -109,10 +118,10 @@ func TestMean(t *testing.T) {
 
 func TestSortByvalue(t *testing.T) {
 
-	msg := make(chan string)
+	msg := make(chan string, 10)
 
 	// Initialize handler instance
-	handler := RenewHistoryHandler(msg)
+	handler := RenewHistoryHandler(loadTestStore(t), ChannelNotifier(msg))
 	// do something with the reque
 
 	// Set up infrastructure to be used for invocation - important: wrap handler function in http.HandlerFunc()
@@ -147,10 +156,10 @@ func TestSortByvalue(t *testing.T) {
 }
 
 func TestInvalidRequest(t *testing.T) {
-	msg := make(chan string)
+	msg := make(chan string, 10)
 
 	// Initialize handler instance
-	handler := RenewHistoryHandler(msg)
+	handler := RenewHistoryHandler(loadTestStore(t), ChannelNotifier(msg))
 
 	// Set up infrastructure to be used for invocation - important: wrap handler function in http.HandlerFunc()
 	server := httptest.NewServer(http.HandlerFunc(handler))
@@ -161,36 +170,38 @@ func TestInvalidRequest(t *testing.T) {
 		url         string
 		method      string
 		StatusCode  int
-		error       string
+		problem     string
+		param       string
 	}{
 		{
 			description: "Rest method supported method",
 			url:         server.URL + RENEW_HISTORY_ENDPOINT,
 			method:      http.MethodPost,
 			StatusCode:  http.StatusMethodNotAllowed,
-			error: "REST Method '" + http.MethodPost + "' not supported. Currently only '" + http.MethodGet +
-				" is supported.",
+			problem:     PROBLEM_METHOD_NOT_ALLOWED,
 		},
 		{
 			description: "Bad request",
 			url:         server.URL + RENEW_HISTORY_ENDPOINT + "hjk/jkg",
 			method:      http.MethodGet,
 			StatusCode:  http.StatusBadRequest,
-			error:       "unexpected format",
+			problem:     PROBLEM_INVALID_PARAMETER,
 		},
 		{
 			description: "Bad begin query",
 			url:         server.URL + RENEW_HISTORY_ENDPOINT + "?begin=dsas",
 			method:      http.MethodGet,
 			StatusCode:  http.StatusBadRequest,
-			error:       "Invalid parameter must be an integer",
+			problem:     PROBLEM_INVALID_PARAMETER,
+			param:       "begin",
 		},
 		{
 			description: "Bad end query",
 			url:         server.URL + RENEW_HISTORY_ENDPOINT + "?end=dsalk",
 			method:      http.MethodGet,
 			StatusCode:  http.StatusBadRequest,
-			error:       "Invalid parameter must be an integer",
+			problem:     PROBLEM_INVALID_PARAMETER,
+			param:       "end",
 		},
 
 		{
@@ -198,7 +209,8 @@ func TestInvalidRequest(t *testing.T) {
 			url:         server.URL + RENEW_HISTORY_ENDPOINT + "?begin=2000&end=1980",
 			method:      http.MethodGet,
 			StatusCode:  http.StatusBadRequest,
-			error:       "unexpected format, make sure year inputed is valid and begin is < than end",
+			problem:     PROBLEM_INVALID_PARAMETER,
+			param:       "begin",
 		},
 
 		{
@@ -206,14 +218,16 @@ func TestInvalidRequest(t *testing.T) {
 			url:         server.URL + RENEW_HISTORY_ENDPOINT + "?sortByValue=sdad",
 			method:      http.MethodGet,
 			StatusCode:  http.StatusBadRequest,
-			error:       "Invalid parameter must be a bool value",
+			problem:     PROBLEM_INVALID_PARAMETER,
+			param:       "sortByValue",
 		},
 		{
 			description: "invalid isocode",
 			url:         server.URL + RENEW_HISTORY_ENDPOINT + "Norr",
 			method:      http.MethodGet,
 			StatusCode:  http.StatusBadRequest,
-			error:       "iso code not found",
+			problem:     PROBLEM_INVALID_PARAMETER,
+			param:       "country",
 		},
 	}
 	for _, test := range testStruct {
@@ -230,11 +244,15 @@ func TestInvalidRequest(t *testing.T) {
 			}
 
 			assert.Equal(t, test.StatusCode, res.StatusCode)
-			body, err := io.ReadAll(res.Body)
+			assert.Equal(t, "application/problem+json", res.Header.Get("Content-Type"))
+			problem := Problem{}
+			err = json.NewDecoder(res.Body).Decode(&problem)
 			if err != nil {
-				t.Errorf("Test: %s. Error reading response : %s", test.description, err.Error())
+				t.Errorf("Test: %s. Error decoding response : %s", test.description, err.Error())
 			}
-			assert.Equal(t, test.error+"\n", string(body))
+			assert.Equal(t, PROBLEM_BASE_URI+test.problem, problem.Type)
+			assert.Equal(t, test.StatusCode, problem.Status)
+			assert.Equal(t, test.param, problem.Param)
 		})
 	}
 }
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"assignment-2/apikeys"
+	"assignment-2/webhooks"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Key of the caller in the context of a request
+type callerKey struct{}
+
+// Authenticate lets requests through to next only with a known API key, given as "Authorization: Bearer {key}"
+// or in the X-API-Key header. Without a key store every request is let through as an admin.
+func Authenticate(keys KeyFinder, next func(w http.ResponseWriter, r *http.Request)) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if keys == nil {
+			next(w, r.WithContext(context.WithValue(r.Context(), callerKey{}, apikeys.Key{Role: apikeys.ROLE_ADMIN})))
+			return
+		}
+
+		key := r.Header.Get(API_KEY_HEADER)
+		if authorization := r.Header.Get("Authorization"); strings.HasPrefix(authorization, "Bearer ") {
+			key = strings.TrimSpace(strings.TrimPrefix(authorization, "Bearer "))
+		}
+		if key == "" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeProblem(w, r, Problem{Type: PROBLEM_UNAUTHORIZED, Detail: "Give an API key as 'Authorization: Bearer {key}' or in the " + API_KEY_HEADER + " header"})
+			return
+		}
+
+		caller, err := keys.Find(key)
+		if errors.Is(err, apikeys.ErrUnknownKey) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeProblem(w, r, Problem{Type: PROBLEM_UNAUTHORIZED, Detail: "The API key is not known"})
+			return
+		}
+		if err != nil {
+			log.Println("Error looking up an API key. Error:", err.Error())
+			writeProblem(w, r, Problem{Type: PROBLEM_INTERNAL, Detail: "Error looking up the API key"})
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), callerKey{}, caller)))
+	}
+}
+
+// RequireAdmin only lets requests of admins through to next, it has to be inside Authenticate
+func RequireAdmin(next func(w http.ResponseWriter, r *http.Request)) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !caller(r).IsAdmin() {
+			writeProblem(w, r, Problem{Type: PROBLEM_FORBIDDEN, Detail: "Only admins can use " + r.URL.Path})
+			return
+		}
+		next(w, r)
+	}
+}
+
+// The key of the caller of a request. Without one the caller owns only the webhooks registered without a key.
+func caller(r *http.Request) apikeys.Key {
+	key, _ := r.Context().Value(callerKey{}).(apikeys.Key)
+	return key
+}
+
+// Whether the caller of a request can see and change a webhook
+func owns(r *http.Request, webhook webhooks.Webhook) bool {
+	key := caller(r)
+	return key.IsAdmin() || key.Owner == webhook.Owner
+}
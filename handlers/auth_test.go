@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"assignment-2/apikeys"
+	"assignment-2/delivery"
+	"assignment-2/webhooks"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAuthenticate(t *testing.T) {
+	keys, err := apikeys.ParseKeys([]string{"team-a:key of a", "team-b:key of b", "ops:key of ops:admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := webhooks.NewMemoryStore()
+	handler := Authenticate(apikeys.NewMemoryStore(keys...),
+		NotificationHandler(store, testCountries, delivery.NewMemoryLog(0), testDataset(t), testSender(t), testPolicy(t)))
+	legacy, err := store.Create(webhooks.Webhook{URL: "http://example.com/legacy", Calls: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(method string, path string, key string, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		if key != "" {
+			r.Header.Set("Authorization", "Bearer "+key)
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+	listed := func(key string) []string {
+		page := WebhookPage{}
+		assert.NoError(t, json.NewDecoder(request(http.MethodGet, NOTIFICATION_ENDPOINT, key, "").Body).Decode(&page))
+		ids := []string{}
+		for _, webhook := range page.Webhooks {
+			ids = append(ids, webhook.Webhook_id)
+		}
+		return ids
+	}
+
+	w := request(http.MethodGet, NOTIFICATION_ENDPOINT, "", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "Bearer", w.Header().Get("WWW-Authenticate"))
+	assert.Equal(t, http.StatusUnauthorized, request(http.MethodGet, NOTIFICATION_ENDPOINT, "unknown key", "").Code)
+
+	w = request(http.MethodPost, NOTIFICATION_ENDPOINT, "key of a", `{"url": "http://example.com/a", "calls": 1}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	created := map[string]string{}
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&created))
+	id := created["webhook_id"]
+	webhook, _ := store.Get(id)
+	assert.Equal(t, "team-a", webhook.Owner)
+
+	// Each owner only sees their own, admins see every webhook
+	assert.Equal(t, []string{id}, listed("key of a"))
+	assert.Empty(t, listed("key of b"))
+	assert.ElementsMatch(t, []string{legacy.ID, id}, listed("key of ops"))
+
+	// The webhooks of others are not found
+	assert.Equal(t, http.StatusNotFound, request(http.MethodGet, NOTIFICATION_ENDPOINT+id, "key of b", "").Code)
+	assert.Equal(t, http.StatusNotFound, request(http.MethodPatch, NOTIFICATION_ENDPOINT+id, "key of b", `{"calls": 2}`).Code)
+	assert.Equal(t, http.StatusNotFound, request(http.MethodDelete, NOTIFICATION_ENDPOINT+id, "key of b", "").Code)
+	assert.Equal(t, http.StatusNotFound, request(http.MethodGet, NOTIFICATION_ENDPOINT+id+"/deliveries", "key of b", "").Code)
+	assert.Equal(t, http.StatusNotFound, request(http.MethodDelete, NOTIFICATION_ENDPOINT+legacy.ID, "key of a", "").Code)
+
+	// Updates keep the owner
+	r := httptest.NewRequest(http.MethodPatch, NOTIFICATION_ENDPOINT+id, strings.NewReader(`{"calls": 2}`))
+	r.Header.Set(API_KEY_HEADER, "key of a")
+	w = httptest.NewRecorder()
+	handler(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	webhook, _ = store.Get(id)
+	assert.Equal(t, "team-a", webhook.Owner)
+
+	assert.Equal(t, http.StatusOK, request(http.MethodDelete, NOTIFICATION_ENDPOINT+id, "key of ops", "").Code)
+}
+
+func TestRequireAdmin(t *testing.T) {
+	keys, _ := apikeys.ParseKeys([]string{"team-a:key of a", "ops:key of ops:admin"})
+	handler := func(keys KeyFinder) func(w http.ResponseWriter, r *http.Request) {
+		return Authenticate(keys, RequireAdmin(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))
+	}
+
+	for key, status := range map[string]int{"key of a": http.StatusForbidden, "key of ops": http.StatusNoContent} {
+		r := httptest.NewRequest(http.MethodGet, DEAD_LETTER_ENDPOINT, nil)
+		r.Header.Set(API_KEY_HEADER, key)
+		w := httptest.NewRecorder()
+		handler(apikeys.NewMemoryStore(keys...))(w, r)
+		assert.Equal(t, status, w.Code, key)
+	}
+
+	// Without keys everyone is an admin
+	w := httptest.NewRecorder()
+	handler(nil)(w, httptest.NewRequest(http.MethodGet, DEAD_LETTER_ENDPOINT, nil))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+}
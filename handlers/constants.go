@@ -1,19 +1,49 @@
 package handlers
 
+import "time"
+
 // SETTINGS
 
 // CSV FILE SETTINGS
+
+// RENEWABLE_DATA_CSV The data file used when no data source has been set
 const RENEWABLE_DATA_CSV = "../renewable-share-energy.csv"
 
+// RENEWABLE_DATA_SOURCE_ENV The environment variable setting the data source, either a file, a directory of files or an http(s) URL
+const RENEWABLE_DATA_SOURCE_ENV = "RENEWABLE_DATA_SOURCE"
+
+// RENEWABLE_DATA_CACHE_ENV The environment variable setting the directory remote data files are cached in
+const RENEWABLE_DATA_CACHE_ENV = "RENEWABLE_DATA_CACHE"
+
+// DEFAULT_DATA_CACHE_DIR The cache directory (inside the system temp directory) used when none has been set
+const DEFAULT_DATA_CACHE_DIR = "renewables-cache"
+
+// WEBHOOK STORAGE SETTINGS
+
+// WEBHOOK_STORE_ENV The environment variable setting where webhooks are stored, "firestore", "file" or "memory"
+const WEBHOOK_STORE_ENV = "WEBHOOK_STORE"
+
+// WEBHOOK_STORE_FILE_ENV The environment variable setting the file webhooks are stored in by the file store
+const WEBHOOK_STORE_FILE_ENV = "WEBHOOK_STORE_FILE"
+
+// FIRESTORE_CREDENTIALS_ENV The environment variable setting the credentials file of the Firestore store
+const FIRESTORE_CREDENTIALS_ENV = "FIRESTORE_CREDENTIALS"
+
+// DEFAULT_WEBHOOK_STORE_FILE The file used by the file store when none has been set
+const DEFAULT_WEBHOOK_STORE_FILE = "webhooks.json"
+
 // Firestore credentials
 const FIRESTORE_ACCOUNT_KEY = "/credentials/accountkey.json"
 const FIRESTORE_ACCOUNT_KEY_LOCAL = "./.credentials/accountkey.json"
 
-// COLUMNS
-const CSV_COL_ENTITY = 0
-const CSV_COL_CODE = 1
-const CSV_COL_YEAR = 2
-const CSV_COL_RENEWABLES = 3
+// DATASET_WATCH_INTERVAL How often the data file is checked for changes
+const DATASET_WATCH_INTERVAL = 30 * time.Second
+
+// INVOCATION_QUEUE_SIZE How many invocations can wait to be counted, those made while it is full are left out
+const INVOCATION_QUEUE_SIZE = 1000
+
+// WEBHOOK_RECONCILE_INTERVAL How often webhooks left half written in the webhook store are repaired
+const WEBHOOK_RECONCILE_INTERVAL = time.Hour
 
 const beginYear int = 1965
 const endYear int = 2021
@@ -26,24 +56,135 @@ const RENEW_HISTORY_ENDPOINT = "/energy/v1/renewables/history/"
 
 // NOTIFICATION_ENDPOINT The endpoint to register a webhook for notifications on countries
 const NOTIFICATION_ENDPOINT = "/energy/v1/notifications/"
+
+// DELIVERIES_PATH The path after the ID of a webhook, under NOTIFICATION_ENDPOINT, giving its delivery attempts
+const DELIVERIES_PATH = "deliveries"
+
+// PAUSE_PATH and RESUME_PATH Paths under a webhook to stop and start notifying it
+const PAUSE_PATH = "pause"
+const RESUME_PATH = "resume"
+
+// TEST_PATH Path under a webhook to send it a test notification
+const TEST_PATH = "test"
+
+// DEFAULT_PAGE_LIMIT The number of items in a page when no limit is given
+const DEFAULT_PAGE_LIMIT = 20
+
+// MAX_PAGE_LIMIT The highest number of items a page can be asked to have
+const MAX_PAGE_LIMIT = 100
+
+// Orders the list of webhooks can be sorted in with ?sort=, by creation time
+const SORT_OLDEST = "created"
+const SORT_NEWEST = "-created"
+
+// DEAD_LETTER_ENDPOINT The endpoint to list and replay notifications that could not be delivered
+const DEAD_LETTER_ENDPOINT = "/energy/v1/notifications/dead-letters/"
 const STATUS_ENPOINT = "/energy/v1/status/"
 
+// DATASET_ENDPOINT The endpoint to inspect and reload the renewables dataset
+const DATASET_ENDPOINT = "/energy/v1/dataset/"
+
+// DATASET_QUALITY_ENDPOINT The endpoint for the data quality report of the dataset
+const DATASET_QUALITY_ENDPOINT = "/energy/v1/dataset/quality/"
+
+// PROBLEM_BASE_URI The prefix of the type URI of problems in error responses
+const PROBLEM_BASE_URI = "/energy/v1/problems/"
+
 // EXTERNAL REST API ENDPOINTS
 
-// COUNTRY_API_ENDPOINT the URL to the country REST API
+// COUNTRY_API_BASE_ENDPOINT the URL to the country REST API used when none has been set
 const COUNTRY_API_BASE_ENDPOINT = "http://129.241.150.113:8080/v3.1/"
-const COUNTRY_API_ALL_ENDPOINT = "http://129.241.150.113:8080/v3.1/all"
-const COUNTRY_API_ALPHA_ENDPOINT = "http://129.241.150.113:8080/v3.1/alpha/"
 
-// PORTS
+// COUNTRIES_API_URL_ENV The environment variable setting the URL to the country REST API
+const COUNTRIES_API_URL_ENV = "COUNTRIES_API_URL"
 
-// DEFAULT_PORT  The default port given to the web service
-const DEFAULT_PORT = "8080"
+// COUNTRIES_API_TIMEOUT_ENV The environment variable setting the timeout of requests to the country REST API, e.g. "10s"
+const COUNTRIES_API_TIMEOUT_ENV = "COUNTRIES_API_TIMEOUT"
+
+// COUNTRIES_API_CACHE_TTL_ENV The environment variable setting how long countries are cached, e.g. "24h"
+const COUNTRIES_API_CACHE_TTL_ENV = "COUNTRIES_API_CACHE_TTL"
 
-// COLLECTIONS
+// COUNTRIES_API_SNAPSHOT_ENV The environment variable setting the JSON file used when the country REST API is unavailable
+const COUNTRIES_API_SNAPSHOT_ENV = "COUNTRIES_API_SNAPSHOT"
 
-// WEBHOOKS_COLLECTION The collection that stores all registered webhooks
-const WEBHOOKS_COLLECTION = "webhooks"
+// DELIVERY SETTINGS
 
-// ALL_COUNTRIES_COLLECTION The collection that stores the webhooks not registered to any country
-const ALL_COUNTRIES_COLLECTION = "all-countries"
+// DELIVERY_WORKERS_ENV The environment variable setting how many notifications are sent at the same time
+const DELIVERY_WORKERS_ENV = "DELIVERY_WORKERS"
+
+// DELIVERY_TIMEOUT_ENV The environment variable setting how long one attempt to send a notification may take, e.g. "10s"
+const DELIVERY_TIMEOUT_ENV = "DELIVERY_TIMEOUT"
+
+// DELIVERY_MAX_ATTEMPTS_ENV The environment variable setting how many times a notification is tried before it becomes a dead letter
+const DELIVERY_MAX_ATTEMPTS_ENV = "DELIVERY_MAX_ATTEMPTS"
+
+// DELIVERY_BACKOFF_ENV The environment variable setting the wait before the first retry, e.g. "1s", doubled for every retry
+const DELIVERY_BACKOFF_ENV = "DELIVERY_BACKOFF"
+
+// WEBHOOK_URL_SCHEMES_ENV The environment variable setting the schemes webhook URLs may use, comma separated, "http,https" if not set
+const WEBHOOK_URL_SCHEMES_ENV = "WEBHOOK_URL_SCHEMES"
+
+// WEBHOOK_URL_ALLOW_ENV The environment variable setting the internal hosts and networks webhooks may still use, comma separated
+const WEBHOOK_URL_ALLOW_ENV = "WEBHOOK_URL_ALLOW"
+
+// WEBHOOK_URL_DENY_ENV The environment variable setting the hosts and networks webhooks may never use, comma separated
+const WEBHOOK_URL_DENY_ENV = "WEBHOOK_URL_DENY"
+
+// API_KEY_STORE_ENV The environment variable setting where API keys are found, "firestore", "file", "memory" or "none"
+const API_KEY_STORE_ENV = "API_KEY_STORE"
+
+// API_KEY_STORE_NONE No API keys are needed, every request is made as an admin. The service does not start without keys unless this is set.
+const API_KEY_STORE_NONE = "none"
+
+// API_KEYS_ENV The environment variable setting the keys of the memory key store, comma separated "owner:key" or "owner:key:admin"
+const API_KEYS_ENV = "API_KEYS"
+
+// API_KEY_FILE_ENV The environment variable setting the JSON file of the file key store
+const API_KEY_FILE_ENV = "API_KEY_FILE"
+
+// API_KEY_HEADER Header the API key can be given in, besides "Authorization: Bearer"
+const API_KEY_HEADER = "X-API-Key"
+
+// WEBHOOK_DISABLE_AFTER_ENV The environment variable setting how many deliveries to a webhook may fail in a row before it is disabled
+const WEBHOOK_DISABLE_AFTER_ENV = "WEBHOOK_DISABLE_AFTER"
+
+// DEFAULT_DISABLE_AFTER Deliveries to a webhook that fail in a row before it is disabled, when not set
+const DEFAULT_DISABLE_AFTER = 10
+
+// WEBHOOK_DIGEST_INTERVAL_ENV The environment variable setting how often digests are sent to each of the webhooks that asked for them
+const WEBHOOK_DIGEST_INTERVAL_ENV = "WEBHOOK_DIGEST_INTERVAL"
+
+// DEFAULT_DIGEST_INTERVAL How often digests are sent, when not set
+const DEFAULT_DIGEST_INTERVAL = time.Minute
+
+// DEAD_LETTER_FILE_ENV The environment variable setting the file dead letters are kept in, they are only kept in memory if not set
+const DEAD_LETTER_FILE_ENV = "DEAD_LETTER_FILE"
+
+// DELIVERY_LOG_FILE_ENV The environment variable setting the file delivery attempts are kept in, they are only kept in memory if not set
+const DELIVERY_LOG_FILE_ENV = "DELIVERY_LOG_FILE"
+
+// WEBHOOKS
+
+// VERIFICATION_TYPE Type of the challenge sent to verify the URL of a webhook
+const VERIFICATION_TYPE = "webhook.verification"
+
+// EVENT_SCHEMA_VERSION Version of the events sent to webhooks
+const EVENT_SCHEMA_VERSION = 1
+
+// WEBHOOK_SPECIFICATION The required structure of a webhook, given in errors about invalid webhooks
+const WEBHOOK_SPECIFICATION = "A webhook is an object with 'url' (string, the URL to be triggered upon an invoked event), " +
+	"'country' (string, the ISO code of the country the event applies to, empty for any country) and " +
+	"'calls' (int, the number of invocations after which a notification is triggered, 1 or higher), " +
+	"and optionally 'secret' (string, at least 16 characters, the key notifications are signed with). " +
+	"A webhook with 'trigger' set to 'threshold' is instead notified when 'condition' ('above', 'below', 'change_above' or 'change_below') " +
+	"becomes true for the latest value of 'indicator' (default 'renewables') of its 'country' compared with 'threshold' (number). " +
+	"With 'events' (array of 'country.invoked', 'threshold.crossed', 'dataset.reloaded' and 'webhook.test') the webhook is notified " +
+	"about those events instead, each wrapped in an envelope with its id, type, timestamp and schema version. " +
+	"With 'verify' (bool) set, a challenge is sent to the url first, and the webhook is only saved if the response echoes it. " +
+	"With 'digest' (bool) set, the invocations are instead sent as one digest per interval, counting the invocations of each country, " +
+	"and 'calls' is not needed"
+
+// PORTS
+
+// DEFAULT_PORT  The default port given to the web service
+const DEFAULT_PORT = "8080"
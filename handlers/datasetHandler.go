@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"assignment-2/dataset"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Handler for inspecting and reloading the renewables dataset
+func DatasetHandler(store *dataset.Store) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			datasetGet(w, r, store)
+		case http.MethodPost:
+			datasetReload(w, r, store)
+		default:
+			methodNotAllowed(w, r, http.MethodGet, http.MethodPost)
+			return
+		}
+	}
+}
+
+// Information about the dataset currently being served
+func datasetInfo(store *dataset.Store) DatasetInfo {
+	return collectionInfo(store.Get(), store.LoadedAt())
+}
+
+// Information about a collection loaded at a time
+func collectionInfo(c *dataset.Collection, loadedAt time.Time) DatasetInfo {
+	indicators := []string{}
+	for _, indicator := range c.Indicators() {
+		indicators = append(indicators, indicator.Name)
+	}
+
+	return DatasetInfo{
+		Entities:   c.EntityCount(),
+		Countries:  c.CountryCount(),
+		Indicators: indicators,
+		LoadedAt:   loadedAt.Format(time.RFC3339),
+		Rejected:   c.Report().Rejected(),
+	}
+}
+
+func datasetGet(w http.ResponseWriter, r *http.Request, store *dataset.Store) {
+	w.Header().Add("content-type", "application/json")
+	err := json.NewEncoder(w).Encode(datasetInfo(store))
+	if err != nil {
+		writeProblem(w, r, Problem{Type: PROBLEM_INTERNAL, Detail: "Error during encoding: " + err.Error()})
+		return
+	}
+}
+
+// Parse the data file again and swap it in, the current dataset is kept if the new one is invalid
+func datasetReload(w http.ResponseWriter, r *http.Request, store *dataset.Store) {
+	log.Println("Reloading the dataset")
+	err := store.Reload()
+	if err != nil {
+		log.Println("E: Failed to reload the dataset. Error:", err.Error())
+		writeProblem(w, r, Problem{
+			Type:   PROBLEM_INVALID_DATASET,
+			Detail: "Failed to reload the dataset, the current version is still being served. Error: " + err.Error(),
+		})
+		return
+	}
+
+	datasetGet(w, r, store)
+}
+
+// Handler for the data quality report of the dataset currently being served
+func DatasetQualityHandler(store *dataset.Store) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, r, http.MethodGet)
+			return
+		}
+
+		w.Header().Add("content-type", "application/json")
+		err := json.NewEncoder(w).Encode(store.Get().Report())
+		if err != nil {
+			writeProblem(w, r, Problem{Type: PROBLEM_INTERNAL, Detail: "Error during encoding: " + err.Error()})
+			return
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"assignment-2/delivery"
+	"assignment-2/webhooks"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Handler for the notifications that could not be delivered, to list, replay and discard them
+func DeadLetterHandler(deadLetters delivery.DeadLetterStore, store webhooks.Store, deliverer Deliverer) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// The path is either empty, {id} or {id}/replay
+		parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, DEAD_LETTER_ENDPOINT), "/"), "/")
+		id := parts[0]
+		replay := len(parts) > 1 && parts[1] == "replay"
+		if len(parts) > 2 || (len(parts) > 1 && !replay) {
+			writeProblem(w, r, Problem{Type: PROBLEM_NOT_FOUND, Detail: "Use " + DEAD_LETTER_ENDPOINT + "{id} or " + DEAD_LETTER_ENDPOINT + "{id}/replay"})
+			return
+		}
+
+		switch {
+		case r.Method == http.MethodGet && !replay:
+			deadLetterGet(w, r, deadLetters, id)
+		case r.Method == http.MethodPost && (replay || id == ""):
+			deadLetterReplay(w, r, deadLetters, store, deliverer, id)
+		case r.Method == http.MethodDelete && !replay && id != "":
+			deadLetterDelete(w, r, deadLetters, id)
+		case replay:
+			methodNotAllowed(w, r, http.MethodPost)
+		case id == "":
+			methodNotAllowed(w, r, http.MethodGet, http.MethodPost)
+		default:
+			methodNotAllowed(w, r, http.MethodGet, http.MethodDelete)
+		}
+	}
+}
+
+// Create the response entry of a dead letter
+func deadLetter(letter delivery.Delivery) DeadLetter {
+	return DeadLetter{
+		ID:        letter.ID,
+		WebhookID: letter.WebhookID,
+		URL:       letter.URL,
+		Body:      letter.Body,
+		Attempts:  letter.Attempts,
+		LastError: letter.LastError,
+		Created:   letter.Created.Format(time.RFC3339),
+		Failed:    letter.Failed.Format(time.RFC3339),
+	}
+}
+
+// List all dead letters, or those of one webhook with ?webhook={id}, or get one
+func deadLetterGet(w http.ResponseWriter, r *http.Request, deadLetters delivery.DeadLetterStore, id string) {
+	var response interface{}
+	if id == "" {
+		letters, err := deadLetters.List()
+		if err != nil {
+			log.Println("Error listing the dead letters. Error:", err.Error())
+			writeError(w, r, err, "", "")
+			return
+		}
+
+		webhookID := r.URL.Query().Get("webhook")
+		all := []DeadLetter{}
+		for _, letter := range letters {
+			if webhookID == "" || letter.WebhookID == webhookID {
+				all = append(all, deadLetter(letter))
+			}
+		}
+		response = all
+	} else {
+		letter, err := deadLetters.Get(id)
+		if err != nil {
+			writeError(w, r, err, "id", id)
+			return
+		}
+		response = deadLetter(letter)
+	}
+
+	w.Header().Add("content-type", "application/json")
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		writeProblem(w, r, Problem{Type: PROBLEM_INTERNAL, Detail: "Error during encoding: " + err.Error()})
+		return
+	}
+}
+
+// Queue a dead letter again, to the current URL of its webhook and signed with its current secret
+func replayDeadLetter(letter delivery.Delivery, deadLetters delivery.DeadLetterStore, store webhooks.Store, deliverer Deliverer) error {
+	webhook, err := store.Get(letter.WebhookID)
+	if err != nil {
+		return err
+	}
+
+	// Removed before it is queued, as it is added again under the same ID if it fails again
+	err = deadLetters.Remove(letter.ID)
+	if err != nil {
+		return err
+	}
+	err = deliverer.Enqueue(delivery.Delivery{
+		ID:        letter.ID,
+		WebhookID: webhook.ID,
+		URL:       webhook.URL,
+		Country:   letter.Country,
+		Calls:     letter.Calls,
+		Secret:    webhook.Secret,
+		Body:      letter.Body,
+	})
+	// A full queue has already kept it as a dead letter again
+	if err != nil && !errors.Is(err, delivery.ErrQueueFull) {
+		deadLetters.Add(letter)
+	}
+	return err
+}
+
+// Replay one dead letter, or all of them (or all of one webhook with ?webhook={id})
+func deadLetterReplay(w http.ResponseWriter, r *http.Request, deadLetters delivery.DeadLetterStore, store webhooks.Store, deliverer Deliverer, id string) {
+	letters := []delivery.Delivery{}
+	if id == "" {
+		all, err := deadLetters.List()
+		if err != nil {
+			log.Println("Error listing the dead letters. Error:", err.Error())
+			writeError(w, r, err, "", "")
+			return
+		}
+		webhookID := r.URL.Query().Get("webhook")
+		for _, letter := range all {
+			if webhookID == "" || letter.WebhookID == webhookID {
+				letters = append(letters, letter)
+			}
+		}
+	} else {
+		letter, err := deadLetters.Get(id)
+		if err != nil {
+			writeError(w, r, err, "id", id)
+			return
+		}
+		letters = append(letters, letter)
+	}
+
+	replayed := 0
+	for _, letter := range letters {
+		err := replayDeadLetter(letter, deadLetters, store, deliverer)
+		// Dead letters of deleted webhooks are left for the user to discard when replaying all of them
+		if errors.Is(err, webhooks.ErrNotFound) && id == "" {
+			continue
+		}
+		if err != nil {
+			log.Println("Error replaying the dead letter", letter.ID, "Error:", err.Error())
+			writeError(w, r, err, "id", letter.ID)
+			return
+		}
+		replayed++
+	}
+	log.Println("Replayed", replayed, "dead letters")
+
+	w.Header().Add("content-type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	err := json.NewEncoder(w).Encode(Replayed{Replayed: replayed})
+	if err != nil {
+		log.Println("Error during encoding:", err.Error())
+	}
+}
+
+// Discard a dead letter
+func deadLetterDelete(w http.ResponseWriter, r *http.Request, deadLetters delivery.DeadLetterStore, id string) {
+	err := deadLetters.Remove(id)
+	if err != nil {
+		writeError(w, r, err, "id", id)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
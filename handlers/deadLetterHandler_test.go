@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"assignment-2/delivery"
+	"assignment-2/webhooks"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Keeps the deliveries queued, instead of sending them
+type fakeDeliverer struct {
+	queued []delivery.Delivery
+}
+
+func (d *fakeDeliverer) Enqueue(delivery delivery.Delivery) error {
+	d.queued = append(d.queued, delivery)
+	return nil
+}
+
+func TestDeadLetterHandler(t *testing.T) {
+	store := webhooks.NewMemoryStore()
+	webhook, err := store.Create(webhooks.Webhook{URL: "http://example.com/new", Calls: 1, Secret: "a secret of the receiver"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deadLetters := delivery.NewMemoryDeadLetters(0)
+	failed := time.Now().UTC()
+	deadLetters.Add(delivery.Delivery{ID: "a", WebhookID: webhook.ID, URL: "http://example.com/old", Body: []byte(`{"calls":1}`), Attempts: 5, Failed: failed})
+	deadLetters.Add(delivery.Delivery{ID: "b", WebhookID: "deleted", URL: "http://example.com/b", Body: []byte(`{"calls":2}`), Attempts: 5, Failed: failed.Add(time.Second)})
+	deliverer := &fakeDeliverer{}
+	handler := DeadLetterHandler(deadLetters, store, deliverer)
+
+	// List them
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, DEAD_LETTER_ENDPOINT, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	all := []DeadLetter{}
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&all))
+	assert.Len(t, all, 2)
+	assert.Equal(t, "a", all[0].ID)
+	assert.JSONEq(t, `{"calls":1}`, string(all[0].Body))
+
+	// Replay all, the one of the deleted webhook is left
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodPost, DEAD_LETTER_ENDPOINT, nil))
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	replayed := Replayed{}
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&replayed))
+	assert.Equal(t, 1, replayed.Replayed)
+	assert.Len(t, deliverer.queued, 1)
+	assert.Equal(t, "http://example.com/new", deliverer.queued[0].URL)
+	assert.Equal(t, webhook.Secret, deliverer.queued[0].Secret)
+	_, err = deadLetters.Get("a")
+	assert.ErrorIs(t, err, delivery.ErrNotFound)
+
+	// Replaying the one of the deleted webhook on its own tells why it can not be
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodPost, DEAD_LETTER_ENDPOINT+"b/replay", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Discard it
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodDelete, DEAD_LETTER_ENDPOINT+"b", nil))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, DEAD_LETTER_ENDPOINT+"b", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodPut, DEAD_LETTER_ENDPOINT+"b", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"assignment-2/apikeys"
+	"assignment-2/countries"
+	"assignment-2/dataset"
+	"assignment-2/delivery"
+	"log"
+	"strings"
+)
+
+// DatasetProvider gives the version of the dataset to use for a request, implemented by *dataset.Store
+type DatasetProvider interface {
+	Get() *dataset.Collection
+}
+
+// CountryLookup finds countries in the Countries API, implemented by *countries.Client
+type CountryLookup interface {
+	ByCode(code string) (countries.Country, error)
+	Neighbours(country string) ([]string, error)
+	// Status code of the Countries API
+	Status() int
+}
+
+// Notifier is told about every request for a country, so the webhooks registered for it can be invoked
+type Notifier interface {
+	Notify(country string)
+}
+
+// ChannelNotifier sends the lower-cased country of each request on a channel. Requests do not wait for the
+// invocation to be handled, it is left out if the channel is full, so the channel should be buffered.
+type ChannelNotifier chan<- string
+
+func (n ChannelNotifier) Notify(country string) {
+	select {
+	case n <- strings.ToLower(country):
+	default:
+		log.Println("W: Too many invocations waiting to be counted, leaving out the invocation of", country)
+	}
+}
+
+// Deliverer sends notifications to webhooks in the background, implemented by *delivery.Dispatcher
+type Deliverer interface {
+	Enqueue(d delivery.Delivery) error
+}
+
+// KeyFinder finds the API key of a request, implemented by the apikeys stores
+type KeyFinder interface {
+	Find(key string) (apikeys.Key, error)
+}
+
+// URLChecker decides which URLs webhooks may be registered with, implemented by *urlpolicy.Policy
+type URLChecker interface {
+	CheckURL(rawURL string) error
+}
+
+// Sender sends a notification to a webhook once and waits for the answer, implemented by *delivery.Dispatcher
+type Sender interface {
+	Send(d delivery.Delivery) (delivery.Response, error)
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"assignment-2/delivery"
+	"assignment-2/webhooks"
+	"errors"
+	"log"
+	"time"
+)
+
+// DigestInvocation sends every webhook that gets digests the invocations counted for it, once interval has passed since
+// the digest sent to it before. Each webhook has its own window, from its digest before, or its first invocation, until
+// now. The counts are kept in the webhook store, so every instance of the service shares them and each digest is sent
+// once. Webhooks without invocations are not sent anything, nor those deleted, paused or no longer getting digests since.
+func DigestInvocation(store webhooks.Store, deliverer Deliverer, interval time.Duration) {
+	digests, err := store.TakeDigests(time.Now().UTC().Add(-interval))
+	if err != nil {
+		// Those taken before the error are still sent
+		log.Println("Failed to take the digests that are due. Error:", err.Error())
+	}
+	if len(digests) == 0 {
+		return
+	}
+	event, err := newEvent(webhooks.EVENT_COUNTRY_DIGEST)
+	if err != nil {
+		log.Println("Failed to create the event of the digests. Error:", err.Error())
+		return
+	}
+
+	for _, digest := range digests {
+		webhook, err := store.Get(digest.WebhookID)
+		if errors.Is(err, webhooks.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			log.Println("Failed to get webhook", digest.WebhookID, "to send its digest. Error:", err.Error())
+			continue
+		}
+		if !webhook.Active() || !webhook.Digest || !webhook.Subscribes(webhooks.EVENT_COUNTRY_INVOKED) {
+			continue
+		}
+
+		notification := DigestNotification{
+			WebhookID: webhook.ID,
+			From:      digest.Since.Format(time.RFC3339),
+			To:        digest.Until.Format(time.RFC3339),
+			Countries: digest.Countries,
+		}
+		for _, invocations := range digest.Countries {
+			notification.Invocations += invocations
+		}
+		content, _ := notificationBody(webhook, event, notification)
+		err = deliverer.Enqueue(delivery.Delivery{
+			WebhookID: webhook.ID,
+			URL:       webhook.URL,
+			Country:   webhook.Country,
+			Calls:     notification.Invocations,
+			Secret:    webhook.Secret,
+			Body:      content,
+		})
+		if err != nil {
+			log.Println("There was an error queuing the digest of webhook", webhook.ID, "ERROR:", err.Error())
+		}
+	}
+}
+
+// DigestEvery sends the digests that are due until stop is closed. They are checked four times per interval,
+// so a digest is sent at most a quarter of the interval after it is due.
+func DigestEvery(store webhooks.Store, deliverer Deliverer, interval time.Duration, stop <-chan struct{}) {
+	check := interval / 4
+	if check <= 0 {
+		check = interval
+	}
+	ticker := time.NewTicker(check)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			DigestInvocation(store, deliverer, interval)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"assignment-2/delivery"
+	"assignment-2/webhooks"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDigestInvocation(t *testing.T) {
+	store := webhooks.NewMemoryStore()
+	digest, err := store.Create(webhooks.Webhook{URL: "http://example.com/digest", Digest: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	enveloped, err := store.Create(webhooks.Webhook{URL: "http://example.com/enveloped", Country: "NOR", Digest: true, Events: []string{webhooks.EVENT_COUNTRY_INVOKED}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	paused, err := store.Create(webhooks.Webhook{URL: "http://example.com/paused", Digest: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Notified at every invocation, as before
+	_, err = store.Create(webhooks.Webhook{URL: "http://example.com/calls", Country: "NOR", Calls: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deliverer := &fakeDeliverer{}
+
+	for i, country := range []string{"NOR", "SWE", "NOR", "nor"} {
+		WebhookInvocation(store, deliverer, country, i+1)
+	}
+	assert.Len(t, deliverer.queued, 3)
+	for _, queued := range deliverer.queued {
+		assert.NotEqual(t, digest.ID, queued.WebhookID)
+	}
+	// Paused after its invocation was counted
+	paused.Status = webhooks.STATUS_PAUSED
+	_, err = store.Update(paused)
+	assert.NoError(t, err)
+
+	// Not sent before the interval has passed since counting started
+	deliverer.queued = nil
+	DigestInvocation(store, deliverer, time.Hour)
+	assert.Empty(t, deliverer.queued)
+
+	DigestInvocation(store, deliverer, 0)
+	if !assert.Len(t, deliverer.queued, 2) {
+		return
+	}
+	byWebhook := map[string]delivery.Delivery{}
+	for _, queued := range deliverer.queued {
+		byWebhook[queued.WebhookID] = queued
+	}
+
+	notification := DigestNotification{}
+	assert.NoError(t, json.Unmarshal(byWebhook[digest.ID].Body, &notification))
+	assert.Equal(t, 4, notification.Invocations)
+	assert.Equal(t, map[string]int{"NOR": 3, "SWE": 1}, notification.Countries)
+	assert.Equal(t, 4, byWebhook[digest.ID].Calls)
+	assert.NotEmpty(t, notification.From)
+	assert.NotEmpty(t, notification.To)
+
+	event := struct {
+		Type string             `json:"type"`
+		Data DigestNotification `json:"data"`
+	}{}
+	assert.NoError(t, json.Unmarshal(byWebhook[enveloped.ID].Body, &event))
+	assert.Equal(t, webhooks.EVENT_COUNTRY_DIGEST, event.Type)
+	assert.Equal(t, map[string]int{"NOR": 3}, event.Data.Countries)
+
+	// Nothing is sent when there were no invocations since
+	deliverer.queued = nil
+	DigestInvocation(store, deliverer, 0)
+	assert.Empty(t, deliverer.queued)
+
+	// The next digest starts where the one before ended
+	WebhookInvocation(store, deliverer, "SWE", 5)
+	DigestInvocation(store, deliverer, 0)
+	if assert.Len(t, deliverer.queued, 1) {
+		next := DigestNotification{}
+		assert.NoError(t, json.Unmarshal(deliverer.queued[0].Body, &next))
+		assert.Equal(t, notification.To, next.From)
+		assert.Equal(t, map[string]int{"SWE": 1}, next.Countries)
+	}
+}
+
+func TestDigestRegistration(t *testing.T) {
+	handler := NotificationHandler(webhooks.NewMemoryStore(), testCountries, delivery.NewMemoryLog(0), testDataset(t), testSender(t), testPolicy(t))
+	tests := []struct {
+		body   string
+		status int
+	}{
+		{`{"url": "http://example.com/hook", "country": "nor", "digest": true}`, http.StatusCreated},
+		{`{"url": "http://example.com/hook", "events": ["country.invoked"], "digest": true}`, http.StatusCreated},
+		{`{"url": "http://example.com/hook", "events": ["dataset.reloaded"], "digest": true}`, http.StatusBadRequest},
+		{`{"url": "http://example.com/hook", "country": "nor", "trigger": "threshold", "condition": "above", "threshold": 50, "digest": true}`, http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodPost, NOTIFICATION_ENDPOINT, strings.NewReader(test.body)))
+		assert.Equal(t, test.status, w.Code, test.body)
+	}
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"assignment-2/countries"
+	"assignment-2/delivery"
+	"assignment-2/webhooks"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Problem types, the last part of the type URI of a problem
+const PROBLEM_INVALID_PARAMETER = "invalid-parameter"
+const PROBLEM_INVALID_BODY = "invalid-body"
+const PROBLEM_METHOD_NOT_ALLOWED = "method-not-allowed"
+const PROBLEM_NOT_FOUND = "not-found"
+const PROBLEM_UNKNOWN_COUNTRY = "unknown-country"
+const PROBLEM_AMBIGUOUS_COUNTRY = "ambiguous-country"
+const PROBLEM_UPSTREAM_ERROR = "upstream-error"
+const PROBLEM_UPSTREAM_UNAVAILABLE = "upstream-unavailable"
+const PROBLEM_INVALID_DATASET = "invalid-dataset"
+const PROBLEM_QUEUE_FULL = "queue-full"
+const PROBLEM_VERIFICATION_FAILED = "verification-failed"
+const PROBLEM_URL_NOT_ALLOWED = "url-not-allowed"
+const PROBLEM_UNAUTHORIZED = "unauthorized"
+const PROBLEM_FORBIDDEN = "forbidden"
+const PROBLEM_INTERNAL = "internal-error"
+
+// Title and status code of every problem type
+var problemTypes = map[string]struct {
+	Title  string
+	Status int
+}{
+	PROBLEM_INVALID_PARAMETER:    {"Invalid parameter", http.StatusBadRequest},
+	PROBLEM_INVALID_BODY:         {"Invalid request body", http.StatusBadRequest},
+	PROBLEM_METHOD_NOT_ALLOWED:   {"Method not allowed", http.StatusMethodNotAllowed},
+	PROBLEM_NOT_FOUND:            {"Not found", http.StatusNotFound},
+	PROBLEM_UNKNOWN_COUNTRY:      {"Unknown country", http.StatusNotFound},
+	PROBLEM_AMBIGUOUS_COUNTRY:    {"Ambiguous country", http.StatusConflict},
+	PROBLEM_UPSTREAM_ERROR:       {"Invalid response from the Countries API", http.StatusBadGateway},
+	PROBLEM_UPSTREAM_UNAVAILABLE: {"The Countries API is unavailable", http.StatusServiceUnavailable},
+	PROBLEM_INVALID_DATASET:      {"Invalid dataset", http.StatusUnprocessableEntity},
+	PROBLEM_QUEUE_FULL:           {"The delivery queue is full", http.StatusServiceUnavailable},
+	PROBLEM_VERIFICATION_FAILED:  {"The webhook did not echo the challenge", http.StatusUnprocessableEntity},
+	PROBLEM_URL_NOT_ALLOWED:      {"Notifications may not be sent to the URL", http.StatusBadRequest},
+	PROBLEM_UNAUTHORIZED:         {"An API key is required", http.StatusUnauthorized},
+	PROBLEM_FORBIDDEN:            {"Not allowed with this API key", http.StatusForbidden},
+	PROBLEM_INTERNAL:             {"Internal server error", http.StatusInternalServerError},
+}
+
+// Map an error to the problem type of the response, errors from the countries client get their own types
+func problemForError(err error) string {
+	var statusErr *countries.StatusError
+	switch {
+	case errors.Is(err, webhooks.ErrNotFound), errors.Is(err, delivery.ErrNotFound):
+		return PROBLEM_NOT_FOUND
+	case errors.Is(err, delivery.ErrQueueFull):
+		return PROBLEM_QUEUE_FULL
+	case errors.Is(err, countries.ErrUnknownCountry):
+		return PROBLEM_UNKNOWN_COUNTRY
+	case errors.Is(err, countries.ErrAmbiguousCountry):
+		return PROBLEM_AMBIGUOUS_COUNTRY
+	case errors.Is(err, countries.ErrUnavailable):
+		return PROBLEM_UPSTREAM_UNAVAILABLE
+	case errors.As(err, &statusErr):
+		return PROBLEM_UPSTREAM_ERROR
+	default:
+		return PROBLEM_INTERNAL
+	}
+}
+
+// Write a problem as an application/problem+json body (RFC 7807).
+// Type is one of the PROBLEM_ constants, the title and status code are filled in from it.
+func writeProblem(w http.ResponseWriter, r *http.Request, problem Problem) {
+	problemType, ok := problemTypes[problem.Type]
+	if !ok {
+		problem.Type = PROBLEM_INTERNAL
+		problemType = problemTypes[PROBLEM_INTERNAL]
+	}
+	problem.Title = problemType.Title
+	if problem.Status == 0 {
+		problem.Status = problemType.Status
+	}
+	problem.Type = PROBLEM_BASE_URI + problem.Type
+	if r != nil {
+		problem.Instance = r.URL.Path
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(problem.Status)
+
+	err := json.NewEncoder(w).Encode(problem)
+	if err != nil {
+		log.Println("E: There was an error encoding the problem response")
+	}
+}
+
+// Write an error as a problem, with the type chosen by problemForError.
+// Param and value name the request parameter the error is about, if any.
+func writeError(w http.ResponseWriter, r *http.Request, err error, param string, value string) {
+	writeProblem(w, r, Problem{
+		Type:   problemForError(err),
+		Detail: err.Error(),
+		Param:  param,
+		Value:  value,
+	})
+}
+
+// Write a problem for a method the endpoint does not support, listing the ones it does
+func methodNotAllowed(w http.ResponseWriter, r *http.Request, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeProblem(w, r, Problem{
+		Type:   PROBLEM_METHOD_NOT_ALLOWED,
+		Detail: "Method " + r.Method + " not supported, must be one of: " + strings.Join(allowed, ", "),
+	})
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"assignment-2/countries"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProblemForError(t *testing.T) {
+	tests := []struct {
+		err     error
+		problem string
+	}{
+		{fmt.Errorf("%w: atlantis", countries.ErrUnknownCountry), PROBLEM_UNKNOWN_COUNTRY},
+		{fmt.Errorf("%w: guinea", countries.ErrAmbiguousCountry), PROBLEM_AMBIGUOUS_COUNTRY},
+		{fmt.Errorf("%w: timeout", countries.ErrUnavailable), PROBLEM_UPSTREAM_UNAVAILABLE},
+		{&countries.StatusError{StatusCode: http.StatusInternalServerError}, PROBLEM_UPSTREAM_ERROR},
+		{errors.New("something else"), PROBLEM_INTERNAL},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.problem, problemForError(test.err), test.err.Error())
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, RENEW_CURRENT_ENDPOINT+"atlantis", nil)
+	writeError(w, r, fmt.Errorf("%w: atlantis", countries.ErrUnknownCountry), "country", "atlantis")
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+
+	body := Problem{}
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&body))
+	assert.Equal(t, Problem{
+		Type:     PROBLEM_BASE_URI + PROBLEM_UNKNOWN_COUNTRY,
+		Title:    "Unknown country",
+		Status:   http.StatusNotFound,
+		Detail:   "unknown country: atlantis",
+		Instance: RENEW_CURRENT_ENDPOINT + "atlantis",
+		Param:    "country",
+		Value:    "atlantis",
+	}, body)
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPut, DATASET_ENDPOINT, nil)
+	methodNotAllowed(w, r, http.MethodGet, http.MethodPost)
+
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "GET, POST", w.Header().Get("Allow"))
+
+	body := Problem{}
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&body))
+	assert.Equal(t, PROBLEM_BASE_URI+PROBLEM_METHOD_NOT_ALLOWED, body.Type)
+}
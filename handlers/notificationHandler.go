@@ -1,365 +1,1009 @@
 package handlers
 
 import (
-	"bytes"
-	"cloud.google.com/go/firestore"
-	"context"
+	"assignment-2/countries"
+	"assignment-2/dataset"
+	"assignment-2/delivery"
+	"assignment-2/signature"
+	"assignment-2/webhooks"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
-	firebase "firebase.google.com/go"
-	"fmt"
-	"google.golang.org/api/iterator"
-	"google.golang.org/api/option"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
+	"errors"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 )
 
-var ctx context.Context
-var client *firestore.Client
-var app *firebase.App
-
-func init() {
-	log.Println("Initializing Firebase")
-	ctx = context.Background()
+func NotificationHandler(store webhooks.Store, lookup CountryLookup, attemptLog delivery.Log, data DatasetProvider, sender Sender, urls URLChecker) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// The delivery attempts of a webhook, /energy/v1/notifications/{id}/deliveries
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(parts) == 5 && parts[4] == DELIVERIES_PATH {
+			if r.Method != http.MethodGet {
+				methodNotAllowed(w, r, http.MethodGet)
+				return
+			}
+			deliveriesGet(w, r, store, attemptLog, parts[3])
+			return
+		}
+		// A test notification to a webhook, /energy/v1/notifications/{id}/test
+		if len(parts) == 5 && parts[4] == TEST_PATH {
+			if r.Method != http.MethodPost {
+				methodNotAllowed(w, r, http.MethodPost)
+				return
+			}
+			notificationTest(w, r, store, sender, parts[3])
+			return
+		}
+		// Pausing and resuming a webhook, /energy/v1/notifications/{id}/pause and /resume
+		if len(parts) == 5 && (parts[4] == PAUSE_PATH || parts[4] == RESUME_PATH) {
+			if r.Method != http.MethodPost {
+				methodNotAllowed(w, r, http.MethodPost)
+				return
+			}
+			notificationStatus(w, r, store, parts[3], parts[4] == PAUSE_PATH)
+			return
+		}
 
-	sa := option.WithCredentialsFile(FIRESTORE_ACCOUNT_KEY)
-	var err error
-	app, err = firebase.NewApp(ctx, nil, sa)
-	if err != nil {
-		log.Fatalln(err)
+		switch r.Method {
+		case http.MethodPost:
+			log.Println("POST method used with notification endpoint")
+			notificationPost(w, r, store, lookup, data, sender, urls)
+		case http.MethodGet:
+			log.Println("GET method used with notification endpoint")
+			notificationGet(w, r, store)
+		case http.MethodPut, http.MethodPatch:
+			log.Println(r.Method + " method used with notification endpoint")
+			notificationUpdate(w, r, store, lookup, data, sender, urls)
+		case http.MethodDelete:
+			log.Println("DELETE method used with notification endpoint")
+			notificationDelete(w, r, store)
+		default:
+			methodNotAllowed(w, r, http.MethodPost, http.MethodGet, http.MethodPut, http.MethodPatch, http.MethodDelete)
+			return
+		}
 	}
+}
 
-	client, err = app.Firestore(ctx)
+// Get a webhook the caller of the request owns, writing the error if there is none.
+// Webhooks of others are not found, so their IDs are not given away.
+func ownedWebhook(w http.ResponseWriter, r *http.Request, store webhooks.Store, id string) (webhooks.Webhook, bool) {
+	webhook, err := store.Get(id)
+	if err == nil && !owns(r, webhook) {
+		err = webhooks.ErrNotFound
+	}
 	if err != nil {
-		log.Fatalln(err)
+		log.Println("Error retrieving webhook with ID:", id, "ERROR:", err.Error())
+		writeError(w, r, err, "id", id)
+		return webhooks.Webhook{}, false
 	}
+	return webhook, true
 }
 
-func CloseClient() {
-	log.Println("Closing firestore client")
-	err := client.Close()
-	if err != nil {
-		log.Fatal("Closing the firebase client failed. Error:", err)
+// Create the response entry of a stored webhook
+func registeredWebhook(webhook webhooks.Webhook) WebhookRegistered {
+	registered := WebhookRegistered{
+		Webhook_id: webhook.ID,
+		Url:        webhook.URL,
+		Country:    webhook.Country,
+		Calls:      webhook.Calls,
+		Events:     webhook.Events,
+		Digest:     webhook.Digest,
+		Verified:   webhook.Verified,
+		Owner:      webhook.Owner,
+		Active:     webhook.Active(),
+		Status:     webhook.Status,
+		Failures:   webhook.Failures,
 	}
+	if registered.Status == "" {
+		registered.Status = webhooks.STATUS_ACTIVE
+	}
+	if webhook.Disabled != nil {
+		registered.Disabled = &DisabledRecord{
+			Event:    webhook.Disabled.Event,
+			Time:     webhook.Disabled.Time.Format(time.RFC3339),
+			Reason:   webhook.Disabled.Reason,
+			Failures: webhook.Disabled.Failures,
+		}
+	}
+	if webhook.IsThreshold() {
+		threshold := webhook.Threshold
+		registered.Trigger = webhook.Trigger
+		registered.Indicator = webhook.Indicator
+		registered.Condition = webhook.Condition
+		registered.Threshold = &threshold
+	}
+	return registered
 }
 
-func NotificationHandler(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case http.MethodPost:
-		log.Println("POST method used with notification endpoint")
-		notificationPost(w, r)
-	case http.MethodGet:
-		log.Println("GET method used with notification endpoint")
-		notificationGet(w, r)
-	case http.MethodDelete:
-		log.Println("DELETE method used with notification endpoint")
-		notificationDelete(w, r)
-	default:
-		http.Error(w, "Method "+r.Method+" not supported.", http.StatusMethodNotAllowed)
-		return
-	}
+// The events a webhook in a request is to be notified about, by its event types or else its trigger
+func subscriber(webhook Webhook) webhooks.Webhook {
+	return webhooks.Webhook{Trigger: webhook.Trigger, Events: webhook.Events}
 }
 
-func notificationPost(w http.ResponseWriter, r *http.Request) {
-	empty := Webhook{}
-	webhook := decodeBody(w, r)
-	if webhook == empty {
-		return
+// Create the webhook to store from a valid request. The condition of a threshold webhook is checked
+// against the dataset being served, so it is only notified when it becomes true after this.
+func storedWebhook(webhook Webhook, data DatasetProvider) webhooks.Webhook {
+	stored := webhooks.Webhook{
+		URL:     webhook.URL,
+		Country: webhook.Country,
+		Calls:   webhook.Calls,
+		Secret:  webhook.Secret,
+		Digest:  webhook.Digest,
+	}
+	// Each event type once
+	seen := map[string]bool{}
+	for _, eventType := range webhook.Events {
+		if !seen[eventType] {
+			seen[eventType] = true
+			stored.Events = append(stored.Events, eventType)
+		}
 	}
-	if !validateWebhook(w, webhook) {
+	// A webhook that subscribed to events has a condition if it is to be notified when it is crossed
+	if subscriber(webhook).Subscribes(webhooks.EVENT_THRESHOLD_CROSSED) {
+		stored.Trigger = webhooks.TRIGGER_THRESHOLD
+		stored.Indicator = strings.ToLower(webhook.Indicator)
+		if stored.Indicator == "" {
+			stored.Indicator = dataset.DEFAULT_INDICATOR
+		}
+		stored.Condition = webhook.Condition
+		stored.Threshold = webhook.Threshold
+		_, stored.Met = stored.Evaluate(data.Get())
+	}
+	if !stored.Subscribes(webhooks.EVENT_COUNTRY_INVOKED) {
+		stored.Calls = 0
+	}
+	return stored
+}
+
+func notificationPost(w http.ResponseWriter, r *http.Request, store webhooks.Store, lookup CountryLookup, data DatasetProvider, sender Sender, urls URLChecker) {
+	webhook, ok := decodeBody(w, r)
+	if !ok {
 		return
 	}
-	// Change the country code to uppercase
-	webhook.Country = strings.ToUpper(webhook.Country)
-	// Adding the webhook to the 'webhooks' collection which has all registered webhooks.
-	id, _, err := client.Collection(WEBHOOKS_COLLECTION).Add(ctx, webhook)
-	if err != nil {
-		log.Println("Error when adding webhook to the webhook collection. Error: " + err.Error())
-		http.Error(w, "Error when adding webhook to the webhook collection. Error "+err.Error(), http.StatusBadRequest)
+	if !validateWebhook(w, r, lookup, urls, webhook) {
 		return
 	}
-	// If the webhook is not registering to any specific country then store it in the 'all' collection
-	// else store it in the collection belonging to the country it is registering to.
-	if webhook.Country == "" {
-		_, err := client.Collection(ALL_COUNTRIES_COLLECTION).Doc(id.ID).Create(ctx, webhook)
-		if err != nil {
-			log.Println("Error when adding webhook to the all collection. Error: " + err.Error())
-			http.Error(w, "Error when adding webhook to the all collection.  Error: "+err.Error(), http.StatusBadRequest)
-			return
-		}
-	} else {
-		_, err := client.Collection(webhook.Country).Doc(id.ID).Create(ctx, webhook)
+
+	// The secret notifications are signed with, generated unless the user has chosen one
+	if webhook.Secret == "" {
+		secret, err := signature.NewSecret()
 		if err != nil {
-			log.Println("Error when adding webhook to " + webhook.Country + " collection. Error: " + err.Error())
-			http.Error(w, "Error when adding webhook to "+webhook.Country+" collection.  Error: "+err.Error(), http.StatusBadRequest)
+			log.Println("Error generating the secret of a webhook. Error: " + err.Error())
+			writeProblem(w, r, Problem{Type: PROBLEM_INTERNAL, Detail: "Error generating the secret of the webhook"})
 			return
 		}
+		webhook.Secret = secret
+	}
+	if webhook.Verify && !verifyURL(w, r, sender, webhook.URL, webhook.Secret) {
+		return
+	}
+
+	stored := storedWebhook(webhook, data)
+	stored.Verified = webhook.Verify
+	stored.Owner = caller(r).Owner
+	registered, err := store.Create(stored)
+	if err != nil {
+		log.Println("Error when adding webhook. Error: " + err.Error())
+		writeProblem(w, r, Problem{Type: PROBLEM_INTERNAL, Detail: "Error when adding webhook. Error: " + err.Error()})
+		return
 	}
 
 	// The ID
-	log.Println("New webhook added to firestore. ID returned: " + id.ID)
+	log.Println("New webhook added. ID returned: " + registered.ID)
 
-	webhookMarshall, err := json.MarshalIndent(webhook, "", " ")
-	webhookID, err := json.MarshalIndent(map[string]string{"webhook_id": id.ID}, "", " ")
+	webhookMarshall, _ := json.MarshalIndent(registeredWebhook(registered), "", " ")
 	log.Println("Webhook:\n" + string(webhookMarshall) + "\nHas been registered.")
-	http.Error(w, string(webhookID), http.StatusCreated)
+
+	// The secret is only ever given here, it can not be read back later
+	w.Header().Add("content-type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(WebhookCreated{WebhookID: registered.ID, Secret: registered.Secret})
+	if err != nil {
+		log.Println("Error during encoding:", err.Error())
+	}
 }
 
-func notificationGet(w http.ResponseWriter, r *http.Request) {
+func notificationGet(w http.ResponseWriter, r *http.Request, store webhooks.Store) {
 	parts := strings.Split(r.URL.Path, "/")
 	ID := parts[4]
-	// if no id is given then retrieve all the webhooks
+	// if no id is given then retrieve a page of the webhooks
 	if ID == "" {
 		log.Println("Get all Webhooks")
-		iter := client.Collection(WEBHOOKS_COLLECTION).Documents(ctx)
-		var webhooks []WebhookRegistered
-		for {
-			doc, err := iter.Next()
-			if err == iterator.Done {
-				break
-			}
-			if err != nil {
-				log.Fatalf("Failed to iterate: %v", err)
-			}
+		query, ok := webhookQuery(w, r)
+		if !ok {
+			return
+		}
+		page, err := store.Page(query)
+		if errors.Is(err, webhooks.ErrInvalidCursor) {
+			writeProblem(w, r, Problem{Type: PROBLEM_INVALID_PARAMETER, Detail: "The cursor must be one given with a page", Param: "cursor", Value: query.Cursor})
+			return
+		}
+		if err != nil {
+			log.Println("Error listing the webhooks. Error:", err.Error())
+			writeProblem(w, r, Problem{Type: PROBLEM_INTERNAL, Detail: "Error listing the webhooks. Error: " + err.Error()})
+			return
+		}
 
-			m := doc.Data()
-			webh := WebhookRegistered{
-				Webhook_id: doc.Ref.ID,
-				Url:        m["URL"],
-				Country:    m["Country"],
-				Calls:      m["Calls"],
-			}
-			webhooks = append(webhooks, webh)
+		response := WebhookPage{Webhooks: []WebhookRegistered{}, Limit: query.Limit, Cursor: page.Next}
+		for _, webhook := range page.Webhooks {
+			response.Webhooks = append(response.Webhooks, registeredWebhook(webhook))
+		}
+		if page.Next != "" {
+			next := r.URL.Query()
+			next.Set("cursor", page.Next)
+			next.Set("limit", strconv.Itoa(query.Limit))
+			response.Next = r.URL.Path + "?" + next.Encode()
 		}
 
 		w.Header().Add("content-type", "application/json")
-		err := json.NewEncoder(w).Encode(webhooks)
+		err = json.NewEncoder(w).Encode(response)
 		if err != nil {
 			log.Println("Error encoding the array of webhooks. Error: ", err.Error())
-			http.Error(w, "Error encoding the array of webhooks. Error"+err.Error(), http.StatusInternalServerError)
+			writeProblem(w, r, Problem{Type: PROBLEM_INTERNAL, Detail: "Error encoding the array of webhooks. Error: " + err.Error()})
 			return
 		}
 	} else {
-		log.Println("Get webhook with id:", parts[4])
+		log.Println("Get webhook with id:", ID)
 
-		res := client.Collection(WEBHOOKS_COLLECTION).Doc(ID)
-
-		doc, err2 := res.Get(ctx)
-		if err2 != nil {
-			log.Println("Error extracting body of returned document of message " + ID)
-			http.Error(w, "Error extracting body of returned document of message "+ID, http.StatusInternalServerError)
+		webhook, ok := ownedWebhook(w, r, store, ID)
+		if !ok {
 			return
 		}
 
-		m := doc.Data()
-		webhook := WebhookRegistered{
-			Webhook_id: doc.Ref.ID,
-			Url:        m["URL"],
-			Country:    m["Country"],
-			Calls:      m["Calls"],
-		}
-
 		w.Header().Add("content-type", "application/json")
-		err := json.NewEncoder(w).Encode(webhook)
+		err := json.NewEncoder(w).Encode(registeredWebhook(webhook))
 		if err != nil {
-			log.Println("Error encoding the array of webhooks. Error: ", err.Error())
-			http.Error(w, "Error encoding the array of webhooks. Error"+err.Error(), http.StatusInternalServerError)
+			log.Println("Error encoding the webhook. Error: ", err.Error())
+			writeProblem(w, r, Problem{Type: PROBLEM_INTERNAL, Detail: "Error encoding the webhook. Error: " + err.Error()})
 			return
 		}
 	}
 }
 
-func notificationDelete(w http.ResponseWriter, r *http.Request) {
+// Change a webhook, keeping its ID. PUT replaces the whole webhook (the secret is kept if none is given),
+// PATCH only the fields given. The webhook stays verified as long as its URL does not change.
+func notificationUpdate(w http.ResponseWriter, r *http.Request, store webhooks.Store, lookup CountryLookup, data DatasetProvider, sender Sender, urls URLChecker) {
 	parts := strings.Split(r.URL.Path, "/")
 	id := parts[4]
-	if id != "" {
-		log.Println("Attempting to delete webhook with ID:", id)
+	if id == "" {
+		log.Println("An ID to a webhook has to be given")
+		writeProblem(w, r, Problem{Type: PROBLEM_INVALID_PARAMETER, Detail: "An ID to a webhook has to be given", Param: "id"})
+		return
+	}
 
-		// Get the webhook document from the 'webhooks' collection
-		doc := client.Collection(WEBHOOKS_COLLECTION).Doc(id)
-		// Get the snapshot of the document
-		docSnap, err := doc.Get(ctx)
+	stored, ok := ownedWebhook(w, r, store, id)
+	if !ok {
+		return
+	}
+
+	webhook := Webhook{}
+	if r.Method == http.MethodPut {
+		webhook, ok = decodeBody(w, r)
+		if !ok {
+			return
+		}
+	} else {
+		patch := WebhookPatch{}
+		err := json.NewDecoder(r.Body).Decode(&patch)
 		if err != nil {
-			errMsg := fmt.Sprintln("Error retrieving webhook with ID:", id)
-			if status.Code(err) == codes.NotFound {
-				errMsg = fmt.Sprintln(errMsg, "ERROR: There is no webhook with ID:", id)
-			} else {
-				errMsg = fmt.Sprintln(errMsg, "ERROR: ", err.Error())
-			}
-			log.Println(errMsg)
-			http.Error(w, errMsg, http.StatusBadRequest)
+			writeProblem(w, r, Problem{
+				Type:   PROBLEM_INVALID_BODY,
+				Detail: "There was an error decoding the request body: " + err.Error() + ". " + WEBHOOK_SPECIFICATION,
+			})
 			return
 		}
+		webhook = applyPatch(stored, patch)
+	}
+	if webhook.Secret == "" {
+		webhook.Secret = stored.Secret
+	}
+	if !validateWebhook(w, r, lookup, urls, webhook) {
+		return
+	}
+	if webhook.Verify && !verifyURL(w, r, sender, webhook.URL, webhook.Secret) {
+		return
+	}
 
-		log.Println("Found webhook with ID:", doc.ID)
+	changed := storedWebhook(webhook, data)
+	// Only the fields given by the user are changed. The owner and the state, which only pausing, resuming and
+	// deliveries change, are kept as stored, also when they have changed since the webhook was read above.
+	updated, err := store.Modify(id, func(current *webhooks.Webhook) {
+		current.Verified = webhook.Verify || (current.Verified && current.URL == changed.URL)
+		current.URL = changed.URL
+		current.Country = changed.Country
+		current.Calls = changed.Calls
+		current.Secret = changed.Secret
+		current.Trigger = changed.Trigger
+		current.Indicator = changed.Indicator
+		current.Condition = changed.Condition
+		current.Threshold = changed.Threshold
+		current.Met = changed.Met
+		current.Events = changed.Events
+		current.Digest = changed.Digest
+	})
+	if err != nil {
+		log.Println("Error updating webhook with ID:", id, "ERROR:", err.Error())
+		writeError(w, r, err, "id", id)
+		return
+	}
+	log.Println("Webhook", id, "has been updated")
 
-		country := fmt.Sprint(docSnap.Data()["Country"])
-		// Check to see if the webhook was registered to a country
-		if country == "" {
-			// Delete the webhook from the no-country collection
-			doc2 := client.Collection(ALL_COUNTRIES_COLLECTION).Doc(id)
-			_, err2 := doc2.Delete(ctx)
-			if err2 != nil {
-				log.Println("There was an error deleting the webhook from the "+ALL_COUNTRIES_COLLECTION+" collection. ERROR:", err.Error())
-				http.Error(w, "There was an error deleting the webhook from the "+ALL_COUNTRIES_COLLECTION+" collection.. ERROR: "+err.Error(), http.StatusBadRequest)
-				return
-			}
-		} else {
-			// Delete the webhook from the collection belonging to the country it was registered to
-			doc2 := client.Collection(country).Doc(id)
-			_, err2 := doc2.Delete(ctx)
-			if err2 != nil {
-				log.Println("There was an error deleting the webhook from the "+country+" collection. ERROR:", err.Error())
-				http.Error(w, "There was an error deleting the webhook from the "+country+" collection.. ERROR: "+err.Error(), http.StatusBadRequest)
-				return
-			}
+	w.Header().Add("content-type", "application/json")
+	err = json.NewEncoder(w).Encode(registeredWebhook(updated))
+	if err != nil {
+		log.Println("Error encoding the webhook. Error: ", err.Error())
+		writeProblem(w, r, Problem{Type: PROBLEM_INTERNAL, Detail: "Error encoding the webhook. Error: " + err.Error()})
+		return
+	}
+}
+
+// The webhook with the fields of a patch changed
+func applyPatch(stored webhooks.Webhook, patch WebhookPatch) Webhook {
+	webhook := Webhook{
+		URL:       stored.URL,
+		Country:   stored.Country,
+		Calls:     stored.Calls,
+		Secret:    stored.Secret,
+		Trigger:   stored.Trigger,
+		Indicator: stored.Indicator,
+		Condition: stored.Condition,
+		Threshold: stored.Threshold,
+		Events:    stored.Events,
+		Verify:    patch.Verify,
+		Digest:    stored.Digest,
+	}
+	if patch.URL != nil {
+		webhook.URL = *patch.URL
+	}
+	if patch.Country != nil {
+		webhook.Country = *patch.Country
+	}
+	if patch.Calls != nil {
+		webhook.Calls = *patch.Calls
+	}
+	if patch.Secret != nil {
+		webhook.Secret = *patch.Secret
+	}
+	if patch.Trigger != nil {
+		webhook.Trigger = *patch.Trigger
+	}
+	if patch.Indicator != nil {
+		webhook.Indicator = *patch.Indicator
+	}
+	if patch.Condition != nil {
+		webhook.Condition = *patch.Condition
+	}
+	if patch.Threshold != nil {
+		webhook.Threshold = *patch.Threshold
+	}
+	if patch.Events != nil {
+		webhook.Events = *patch.Events
+	}
+	if patch.Digest != nil {
+		webhook.Digest = *patch.Digest
+	}
+	return webhook
+}
+
+func notificationDelete(w http.ResponseWriter, r *http.Request, store webhooks.Store) {
+	parts := strings.Split(r.URL.Path, "/")
+	id := parts[4]
+	if id != "" {
+		log.Println("Attempting to delete webhook with ID:", id)
+		if _, ok := ownedWebhook(w, r, store, id); !ok {
+			return
 		}
-		// Delete the webhook from the 'webhooks' collection
-		_, err = doc.Delete(ctx)
+
+		err := store.Delete(id)
 		if err != nil {
-			log.Println("There was an error deleting the webhook. ERROR:", err.Error())
-			http.Error(w, "There was an error deleting the webhook. ERROR: "+err.Error(), http.StatusBadRequest)
+			log.Println("There was an error deleting the webhook with ID:", id, "ERROR:", err.Error())
+			writeError(w, r, err, "id", id)
 			return
 		}
 		log.Println("Successfully deleted webhook")
-		http.Error(w, "Successfully deleted webhook", http.StatusOK)
+		w.Header().Add("content-type", "application/json")
+		err = json.NewEncoder(w).Encode(WebhookDeleted{WebhookID: id, Deleted: true})
+		if err != nil {
+			log.Println("Error during encoding:", err.Error())
+		}
 	} else {
 		log.Println("An ID to a webhook has to be given")
-		http.Error(w, "An ID to a webhook as to be given.", http.StatusBadRequest)
+		writeProblem(w, r, Problem{Type: PROBLEM_INVALID_PARAMETER, Detail: "An ID to a webhook has to be given", Param: "id"})
 	}
 }
 
-func WebhookInvocation(country string, calls int) {
+// Notify the webhooks registered to a country, and those registered to any country, that should be notified at this number of calls.
+// The invocation is counted in the store for the webhooks that get digests instead, see DigestInvocation.
+func WebhookInvocation(store webhooks.Store, deliverer Deliverer, country string, calls int) {
 	log.Println("Sending notifications on country:", country)
 
 	// Turn the country code to Uppercase
 	country = strings.ToUpper(country)
-	// Get the collection of webhook documents belonging to given country
-	countryDocs := client.Collection(country).Documents(ctx)
-	// Get the collections of webhook documents registered to all countries
-	allCountriesDocs := client.Collection(ALL_COUNTRIES_COLLECTION).Documents(ctx)
+	// Get the webhooks registered to given country
+	countryWebhooks, err := store.ListByCountry(country)
+	if err != nil {
+		log.Println("Failed to get the webhooks of", country, "Error:", err.Error())
+		return
+	}
+	// Get the webhooks registered to all countries
+	allCountriesWebhooks, err := store.ListByCountry("")
+	if err != nil {
+		log.Println("Failed to get the webhooks of all countries. Error:", err.Error())
+		return
+	}
 
-	// See if any webhook registered to given country should get notified based on its call frequency
-	for {
-		doc, err := countryDocs.Next()
-		if err == iterator.Done {
-			break
+	event, err := newEvent(webhooks.EVENT_COUNTRY_INVOKED)
+	if err != nil {
+		log.Println("Failed to create the event of", country, "Error:", err.Error())
+		return
+	}
+
+	// See if any webhook should get notified based on its call frequency
+	for _, webhook := range append(countryWebhooks, allCountriesWebhooks...) {
+		if !webhook.Active() || !webhook.Subscribes(webhooks.EVENT_COUNTRY_INVOKED) {
+			continue
 		}
-		if err != nil {
-			log.Fatalf("Failed to iterate country docs. Error %v", err)
+		if webhook.Digest {
+			err := store.CountDigest(webhook.ID, country)
+			if err != nil && !errors.Is(err, webhooks.ErrNotFound) {
+				log.Println("Failed to count the invocation of", country, "for the digest of webhook", webhook.ID, "Error:", err.Error())
+			}
+			continue
+		}
+		if webhook.Calls < 1 || calls%webhook.Calls != 0 {
+			continue
 		}
 
-		data := doc.Data()
 		notification := Notification{
-			WebhookID: doc.Ref.ID,
+			WebhookID: webhook.ID,
 			Country:   country,
 			Calls:     calls,
 		}
-		callFrequency := int(data["Calls"].(int64))
-		url := fmt.Sprint(data["URL"])
-		if calls%callFrequency == 0 {
-			content, _ := json.MarshalIndent(notification, " ", "")
-			go func() {
-				_, err := http.Post(url, "application/json", bytes.NewBuffer(content))
-				if err != nil {
-					log.Println("There was an error sending a POST call to the URL of webhook. ERROR: ", err.Error())
-					return
-				}
-			}()
+		content, _ := notificationBody(webhook, event, notification)
+		err := deliverer.Enqueue(delivery.Delivery{
+			WebhookID: webhook.ID,
+			URL:       webhook.URL,
+			Country:   country,
+			Calls:     calls,
+			Secret:    webhook.Secret,
+			Body:      content,
+		})
+		if err != nil {
+			log.Println("There was an error queuing the notification of webhook", webhook.ID, "ERROR:", err.Error())
+		}
+	}
+}
+
+// Check the conditions of the threshold webhooks against a newly loaded dataset, and notify those that have become true.
+// Whether a condition is met is kept in the store, so each webhook is notified once every time its condition becomes true.
+func ThresholdInvocation(store webhooks.Store, deliverer Deliverer, c *dataset.Collection) {
+	all, err := store.List()
+	if err != nil {
+		log.Println("Failed to get the webhooks to check the thresholds of. Error:", err.Error())
+		return
+	}
+	event, err := newEvent(webhooks.EVENT_THRESHOLD_CROSSED)
+	if err != nil {
+		log.Println("Failed to create the event of the thresholds. Error:", err.Error())
+		return
+	}
 
-			//log.Println("Webhook invoked:", notification.WebhookID)
-			//fmt.Println("Status message: " + res.Status)
+	for _, webhook := range all {
+		if !webhook.Active() || !webhook.Subscribes(webhooks.EVENT_THRESHOLD_CROSSED) {
+			continue
+		}
+		reading, met := webhook.Evaluate(c)
+		if met == webhook.Met {
+			continue
+		}
+		// Checked again as stored and only Met is changed, in case the webhook was changed or checked by another
+		// instance since it was listed. Only the one that changes it to true notifies it.
+		crossed := false
+		updated, err := store.Modify(webhook.ID, func(stored *webhooks.Webhook) {
+			crossed = false
+			if !stored.Active() || !stored.Subscribes(webhooks.EVENT_THRESHOLD_CROSSED) {
+				return
+			}
+			reading, met = stored.Evaluate(c)
+			crossed = met && !stored.Met
+			stored.Met = met
+		})
+		if errors.Is(err, webhooks.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			log.Println("Failed to save the state of the condition of webhook", webhook.ID, "Error:", err.Error())
+			continue
+		}
+
+		if crossed {
+			log.Println("The condition of webhook", updated.ID, "has become true, sending a notification")
+			notification := ThresholdNotification{
+				WebhookID: updated.ID,
+				Country:   updated.Country,
+				Indicator: updated.Indicator,
+				Condition: updated.Condition,
+				Threshold: updated.Threshold,
+				Year:      reading.Year,
+				Value:     reading.Value,
+			}
+			if updated.Condition == webhooks.CONDITION_CHANGE_ABOVE || updated.Condition == webhooks.CONDITION_CHANGE_BELOW {
+				notification.Change = &reading.Change
+			}
+			content, _ := notificationBody(updated, event, notification)
+			err = deliverer.Enqueue(delivery.Delivery{
+				WebhookID: updated.ID,
+				URL:       updated.URL,
+				Country:   updated.Country,
+				Secret:    updated.Secret,
+				Body:      content,
+			})
+			if err != nil {
+				log.Println("There was an error queuing the notification of webhook", updated.ID, "ERROR:", err.Error())
+			}
 		}
 	}
-	// See if any webhook registered to all countries should get notified based on its call frequency
-	for {
-		doc, err := allCountriesDocs.Next()
-		if err == iterator.Done {
-			break
+}
+
+// Notify the webhooks that subscribed to it that a new dataset has been loaded, whatever country they are registered to
+func DatasetInvocation(store webhooks.Store, deliverer Deliverer, c *dataset.Collection, loadedAt time.Time) {
+	all, err := store.List()
+	if err != nil {
+		log.Println("Failed to get the webhooks to notify about the dataset. Error:", err.Error())
+		return
+	}
+	event, err := newEvent(webhooks.EVENT_DATASET_RELOADED)
+	if err != nil {
+		log.Println("Failed to create the event of the dataset. Error:", err.Error())
+		return
+	}
+
+	info := collectionInfo(c, loadedAt)
+	for _, webhook := range all {
+		if !webhook.Active() || !webhook.Subscribes(webhooks.EVENT_DATASET_RELOADED) {
+			continue
 		}
+		content, _ := notificationBody(webhook, event, info)
+		err := deliverer.Enqueue(delivery.Delivery{
+			WebhookID: webhook.ID,
+			URL:       webhook.URL,
+			Secret:    webhook.Secret,
+			Body:      content,
+		})
 		if err != nil {
-			log.Fatalf("Failed to iterate all countries docs. Error %v", err)
+			log.Println("There was an error queuing the notification of webhook", webhook.ID, "ERROR:", err.Error())
 		}
+	}
+}
 
-		data := doc.Data()
-		notification := Notification{
-			WebhookID: doc.Ref.ID,
-			Country:   country,
-			Calls:     calls,
+// A random hex string, for the IDs of events and challenges
+func randomID() (string, error) {
+	id := make([]byte, 12)
+	_, err := rand.Read(id)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// An event of a type happening now, sent with the same ID to every webhook notified about it
+func newEvent(eventType string) (Event, error) {
+	id, err := randomID()
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{
+		ID:            id,
+		Type:          eventType,
+		Timestamp:     time.Now().UTC().Format(time.RFC3339),
+		SchemaVersion: EVENT_SCHEMA_VERSION,
+	}, nil
+}
+
+// The body of the notification of an event to a webhook. Webhooks registered without events get the data alone, as they always have.
+func notificationBody(webhook webhooks.Webhook, event Event, data interface{}) ([]byte, error) {
+	if !webhook.Enveloped() {
+		return json.MarshalIndent(data, " ", "")
+	}
+	event.Data = data
+	return json.MarshalIndent(event, " ", "")
+}
+
+// Pause a webhook so it is not notified, or resume a paused or disabled webhook
+func notificationStatus(w http.ResponseWriter, r *http.Request, store webhooks.Store, id string, pause bool) {
+	webhook, ok := ownedWebhook(w, r, store, id)
+	if !ok {
+		return
+	}
+	// Only the status is changed, so deliveries failing in the meantime are still counted
+	updated, err := store.Modify(webhook.ID, func(stored *webhooks.Webhook) {
+		if pause {
+			stored.Status = webhooks.STATUS_PAUSED
+		} else {
+			stored.Resume()
 		}
-		callFrequency := int(data["Calls"].(int64))
-		url := fmt.Sprint(data["URL"])
-		if calls%callFrequency == 0 {
-			content, _ := json.MarshalIndent(notification, " ", "")
-			go func() {
-				_, err := http.Post(url, "application/json", bytes.NewBuffer(content))
-				if err != nil {
-					log.Println("There was an error sending a POST call to the URL of webhook. ERROR: ", err.Error())
-					return
-				}
-			}()
-			//log.Println("Webhook invoked:", notification.WebhookID)
-			//fmt.Println("Status message: " + res.Status)
+	})
+	if err != nil {
+		log.Println("Error updating webhook with ID:", id, "ERROR:", err.Error())
+		writeError(w, r, err, "id", id)
+		return
+	}
+	log.Println("Webhook", id, "is now", updated.Status)
+
+	w.Header().Add("content-type", "application/json")
+	err = json.NewEncoder(w).Encode(registeredWebhook(updated))
+	if err != nil {
+		writeProblem(w, r, Problem{Type: PROBLEM_INTERNAL, Detail: "Error during encoding: " + err.Error()})
+		return
+	}
+}
+
+// DeliveryResult counts the deliveries to each webhook that fail in a row, and disables a webhook once
+// disableAfter have. A delivery that succeeds starts the count over. Only the count, status and why the webhook
+// was disabled are changed, so changes made to the webhook in the meantime, like pausing it, are kept.
+func DeliveryResult(store webhooks.Store, disableAfter int) func(d delivery.Delivery, err error) {
+	return func(d delivery.Delivery, err error) {
+		if err == nil {
+			// Most deliveries succeed, the webhook is only changed when there is a count to start over
+			webhook, getErr := store.Get(d.WebhookID)
+			if getErr != nil || webhook.Failures == 0 {
+				return
+			}
+		}
+
+		disabled := false
+		webhook, changeErr := store.Modify(d.WebhookID, func(stored *webhooks.Webhook) {
+			disabled = false
+			if err == nil {
+				stored.Failures = 0
+				return
+			}
+			stored.Failures++
+			if stored.Failures >= disableAfter && stored.Active() {
+				stored.Disable(stored.Failures, err.Error())
+				disabled = true
+			}
+		})
+		if errors.Is(changeErr, webhooks.ErrNotFound) {
+			// Deleted since the delivery was queued
+			return
+		}
+		if changeErr != nil {
+			log.Println("Failed to save the failures of webhook", d.WebhookID, "Error:", changeErr.Error())
+			return
+		}
+		if disabled {
+			log.Println("Disabled webhook", webhook.ID, "after", webhook.Failures, "failed deliveries in a row")
 		}
 	}
 }
 
-func decodeBody(w http.ResponseWriter, r *http.Request) Webhook {
+// Send a test notification to a webhook and give back what the receiver answered. The notification is sent
+// right away, once, and is not in the delivery history of the webhook.
+func notificationTest(w http.ResponseWriter, r *http.Request, store webhooks.Store, sender Sender, id string) {
+	webhook, ok := ownedWebhook(w, r, store, id)
+	if !ok {
+		return
+	}
+	event, err := newEvent(webhooks.EVENT_WEBHOOK_TEST)
+	if err != nil {
+		log.Println("Failed to create the test event. Error:", err.Error())
+		writeProblem(w, r, Problem{Type: PROBLEM_INTERNAL, Detail: "Error creating the test notification"})
+		return
+	}
+
+	content, _ := notificationBody(webhook, event, TestNotification{WebhookID: webhook.ID, Country: webhook.Country, Test: true})
+	response, err := sender.Send(delivery.Delivery{
+		WebhookID: webhook.ID,
+		URL:       webhook.URL,
+		Country:   webhook.Country,
+		Secret:    webhook.Secret,
+		Body:      content,
+	})
+	result := TestResult{
+		WebhookID:  webhook.ID,
+		Delivered:  err == nil,
+		StatusCode: response.StatusCode,
+		LatencyMs:  float64(response.Latency.Microseconds()) / 1000,
+		Response:   string(response.Body),
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	log.Println("Sent a test notification to webhook", id, "delivered:", result.Delivered)
+
+	w.Header().Add("content-type", "application/json")
+	err = json.NewEncoder(w).Encode(result)
+	if err != nil {
+		writeProblem(w, r, Problem{Type: PROBLEM_INTERNAL, Detail: "Error during encoding: " + err.Error()})
+		return
+	}
+}
+
+// Send a challenge to the URL of a webhook, writing a problem unless the receiver answers with it
+func verifyURL(w http.ResponseWriter, r *http.Request, sender Sender, url string, secret string) bool {
+	challenge, err := randomID()
+	if err != nil {
+		log.Println("Failed to create a challenge. Error:", err.Error())
+		writeProblem(w, r, Problem{Type: PROBLEM_INTERNAL, Detail: "Error creating the challenge"})
+		return false
+	}
+
+	content, _ := json.MarshalIndent(Verification{Type: VERIFICATION_TYPE, Challenge: challenge}, " ", "")
+	response, err := sender.Send(delivery.Delivery{URL: url, Secret: secret, Body: content})
+	if err == nil && !echoes(response.Body, challenge) {
+		err = errors.New("the response did not contain the challenge")
+	}
+	if err != nil {
+		log.Println("The URL", url, "failed verification. Error:", err.Error())
+		writeProblem(w, r, Problem{
+			Type:   PROBLEM_VERIFICATION_FAILED,
+			Detail: "The url has to answer the challenge sent to it with the challenge: " + err.Error(),
+			Param:  "url",
+			Value:  url,
+		})
+		return false
+	}
+	return true
+}
+
+// Whether the body of a response is the challenge, alone or as a Verification
+func echoes(body []byte, challenge string) bool {
+	if strings.TrimSpace(string(body)) == challenge {
+		return true
+	}
+	verification := Verification{}
+	return json.Unmarshal(body, &verification) == nil && verification.Challenge == challenge
+}
+
+// Read an integer query parameter for paging, writing a problem if it is not one within min and max
+func pageParameter(w http.ResponseWriter, r *http.Request, name string, fallback int, min int, max int) (int, bool) {
+	query := r.URL.Query().Get(name)
+	if query == "" {
+		return fallback, true
+	}
+	value, err := strconv.Atoi(query)
+	if err != nil || value < min || value > max {
+		writeProblem(w, r, Problem{
+			Type:   PROBLEM_INVALID_PARAMETER,
+			Detail: "The " + name + " parameter must be an integer from " + strconv.Itoa(min) + " to " + strconv.Itoa(max),
+			Param:  name,
+			Value:  query,
+		})
+		return 0, false
+	}
+	return value, true
+}
+
+// Read the page of webhooks asked for from ?limit=, ?cursor=, ?sort=, and the filters ?country=, ?host= and ?status=.
+// Admins page through every webhook, others through their own.
+func webhookQuery(w http.ResponseWriter, r *http.Request) (webhooks.Query, bool) {
+	limit, ok := pageParameter(w, r, "limit", DEFAULT_PAGE_LIMIT, 1, MAX_PAGE_LIMIT)
+	if !ok {
+		return webhooks.Query{}, false
+	}
+	parameters := r.URL.Query()
+	query := webhooks.Query{
+		Host:   parameters.Get("host"),
+		Status: parameters.Get("status"),
+		Cursor: parameters.Get("cursor"),
+		Limit:  limit,
+	}
+
+	if key := caller(r); !key.IsAdmin() {
+		query.Owner = &key.Owner
+	}
+	// An empty country selects the webhooks registered to any country
+	if country, ok := parameters["country"]; ok {
+		query.Country = &country[0]
+	}
+	if query.Status != "" && !webhooks.IsStatus(query.Status) {
+		writeProblem(w, r, Problem{
+			Type:   PROBLEM_INVALID_PARAMETER,
+			Detail: "The status must be one of: " + strings.Join(webhooks.Statuses, ", "),
+			Param:  "status",
+			Value:  query.Status,
+		})
+		return webhooks.Query{}, false
+	}
+	switch sort := parameters.Get("sort"); sort {
+	case "", SORT_OLDEST:
+	case SORT_NEWEST:
+		query.Descending = true
+	default:
+		writeProblem(w, r, Problem{
+			Type:   PROBLEM_INVALID_PARAMETER,
+			Detail: "The sort must be " + SORT_OLDEST + " (oldest first) or " + SORT_NEWEST + " (newest first)",
+			Param:  "sort",
+			Value:  sort,
+		})
+		return webhooks.Query{}, false
+	}
+	return query, true
+}
+
+// The delivery attempts of a webhook, newest first, paged with ?offset= and ?limit=
+func deliveriesGet(w http.ResponseWriter, r *http.Request, store webhooks.Store, attemptLog delivery.Log, id string) {
+	offset, ok := pageParameter(w, r, "offset", 0, 0, math.MaxInt32)
+	if !ok {
+		return
+	}
+	limit, ok := pageParameter(w, r, "limit", DEFAULT_PAGE_LIMIT, 1, MAX_PAGE_LIMIT)
+	if !ok {
+		return
+	}
+
+	if _, ok := ownedWebhook(w, r, store, id); !ok {
+		return
+	}
+
+	attempts, total, err := attemptLog.Attempts(id, offset, limit)
+	if err != nil {
+		log.Println("Error reading the deliveries of webhook", id, "Error:", err.Error())
+		writeError(w, r, err, "id", id)
+		return
+	}
+
+	page := DeliveryPage{WebhookID: id, Total: total, Offset: offset, Limit: limit, Deliveries: []DeliveryAttempt{}}
+	for _, attempt := range attempts {
+		page.Deliveries = append(page.Deliveries, DeliveryAttempt{
+			DeliveryID: attempt.DeliveryID,
+			Country:    attempt.Country,
+			Calls:      attempt.Calls,
+			Attempt:    attempt.Attempt,
+			StatusCode: attempt.StatusCode,
+			LatencyMs:  float64(attempt.Latency.Microseconds()) / 1000,
+			Error:      attempt.Error,
+			Time:       attempt.Time.Format(time.RFC3339Nano),
+		})
+	}
+	if offset+limit < total {
+		page.Next = r.URL.Path + "?offset=" + strconv.Itoa(offset+limit) + "&limit=" + strconv.Itoa(limit)
+	}
+
+	w.Header().Add("content-type", "application/json")
+	err = json.NewEncoder(w).Encode(page)
+	if err != nil {
+		writeProblem(w, r, Problem{Type: PROBLEM_INTERNAL, Detail: "Error during encoding: " + err.Error()})
+		return
+	}
+}
+
+func decodeBody(w http.ResponseWriter, r *http.Request) (Webhook, bool) {
 	webhook := Webhook{}
 	err := json.NewDecoder(r.Body).Decode(&webhook)
 	if err != nil {
-		demoWebhook := map[string]interface{}{
-			"url":     "(string)The URL to be triggered upon an invoked event",
-			"country": "(string)The country for which the triggered event applies to (if empty, i.e. \"\", then it applies to any invocation)",
-			"calls":   "(int)The number of invocations after which a notification is triggered (has to be 1 or higher)",
-		}
-		demoMarshall, err2 := json.MarshalIndent(demoWebhook, "", " ")
-		if err2 != nil {
-			http.Error(w, "Error marshalling the demo webhook", http.StatusInternalServerError)
-			return Webhook{}
-		}
-		http.Error(w, "There was an error decoding the request body: \n\t"+err.Error()+
-			"\n\nThe required structure of the webhook:\n"+
-			string(demoMarshall)+
-			"\nCheck that the structure is correct and resubmit.", http.StatusBadRequest)
-		return Webhook{}
+		writeProblem(w, r, Problem{
+			Type:   PROBLEM_INVALID_BODY,
+			Detail: "There was an error decoding the request body: " + err.Error() + ". " + WEBHOOK_SPECIFICATION,
+		})
+		return Webhook{}, false
 	}
-	return webhook
+	return webhook, true
 }
 
-func validateWebhook(w http.ResponseWriter, webhook Webhook) bool {
-	if webhook.URL == "" || webhook.Calls < 1 {
-		demoWebhook := map[string]interface{}{
-			"url":     "(string)The URL to be triggered upon an invoked event",
-			"country": "(string)The country for which the triggered event applies to (if empty, i.e. \"\", then it applies to any invocation)",
-			"calls":   "(int)The number of invocations after which a notification is triggered (has to be 1 or higher)",
-		}
+// Check the fields of a threshold webhook
+func validateThreshold(w http.ResponseWriter, r *http.Request, webhook Webhook) bool {
+	if webhook.Country == "" {
+		writeProblem(w, r, Problem{
+			Type:   PROBLEM_INVALID_BODY,
+			Detail: "A threshold webhook has to be registered to a country. " + WEBHOOK_SPECIFICATION,
+			Param:  "country",
+		})
+		return false
+	}
+	if !webhooks.IsCondition(webhook.Condition) {
+		writeProblem(w, r, Problem{
+			Type:   PROBLEM_INVALID_BODY,
+			Detail: "The condition of the webhook has to be one of: " + strings.Join(webhooks.Conditions, ", ") + ". " + WEBHOOK_SPECIFICATION,
+			Param:  "condition",
+			Value:  webhook.Condition,
+		})
+		return false
+	}
+	if _, ok := dataset.FindIndicator(webhook.Indicator); webhook.Indicator != "" && !ok {
+		writeProblem(w, r, Problem{
+			Type:   PROBLEM_INVALID_BODY,
+			Detail: "The indicator of the webhook has to be one of: " + strings.Join(dataset.IndicatorNames(), ", ") + ". " + WEBHOOK_SPECIFICATION,
+			Param:  "indicator",
+			Value:  webhook.Indicator,
+		})
+		return false
+	}
+	return true
+}
 
-		demoMarshall, err := json.MarshalIndent(demoWebhook, "", " ")
-		if err != nil {
-			http.Error(w, "Error marshalling the demo webhook", http.StatusInternalServerError)
+func validateWebhook(w http.ResponseWriter, r *http.Request, lookup CountryLookup, urls URLChecker, webhook Webhook) bool {
+	if webhook.URL == "" {
+		writeProblem(w, r, Problem{
+			Type:   PROBLEM_INVALID_BODY,
+			Detail: "The url of the webhook has to be given. " + WEBHOOK_SPECIFICATION,
+			Param:  "url",
+		})
+		return false
+	}
+	// Notifications are not sent to the service itself or to internal networks, it is checked again when they are sent
+	err := urls.CheckURL(webhook.URL)
+	if err != nil {
+		log.Println("The URL of the webhook is not allowed. Error:", err.Error())
+		writeProblem(w, r, Problem{
+			Type:   PROBLEM_URL_NOT_ALLOWED,
+			Detail: "Notifications can not be sent to the url of the webhook: " + err.Error(),
+			Param:  "url",
+			Value:  webhook.URL,
+		})
+		return false
+	}
+	if webhook.Trigger != "" && webhook.Trigger != webhooks.TRIGGER_CALLS && webhook.Trigger != webhooks.TRIGGER_THRESHOLD {
+		writeProblem(w, r, Problem{
+			Type:   PROBLEM_INVALID_BODY,
+			Detail: "The trigger of the webhook has to be '" + webhooks.TRIGGER_CALLS + "' or '" + webhooks.TRIGGER_THRESHOLD + "'. " + WEBHOOK_SPECIFICATION,
+			Param:  "trigger",
+			Value:  webhook.Trigger,
+		})
+		return false
+	}
+	for _, eventType := range webhook.Events {
+		if !webhooks.IsEventType(eventType) {
+			writeProblem(w, r, Problem{
+				Type:   PROBLEM_INVALID_BODY,
+				Detail: "The events of the webhook have to be of: " + strings.Join(webhooks.EventTypes, ", ") + ". " + WEBHOOK_SPECIFICATION,
+				Param:  "events",
+				Value:  eventType,
+			})
 			return false
 		}
-
-		http.Error(w, "The input body does not fulfill the webhook specification\n"+
-			"The required structure of the webhook:\n"+
-			string(demoMarshall)+
-			"\nCheck that the structure is correct and resubmit.", http.StatusBadRequest)
+	}
+	if subscriber(webhook).Subscribes(webhooks.EVENT_THRESHOLD_CROSSED) && !validateThreshold(w, r, webhook) {
+		return false
+	}
+	if webhook.Digest && !subscriber(webhook).Subscribes(webhooks.EVENT_COUNTRY_INVOKED) {
+		writeProblem(w, r, Problem{
+			Type:   PROBLEM_INVALID_BODY,
+			Detail: "Only webhooks notified about invocations ('" + webhooks.EVENT_COUNTRY_INVOKED + "') can get digests. " + WEBHOOK_SPECIFICATION,
+			Param:  "digest",
+		})
+		return false
+	}
+	if subscriber(webhook).Subscribes(webhooks.EVENT_COUNTRY_INVOKED) && !webhook.Digest && webhook.Calls < 1 {
+		writeProblem(w, r, Problem{
+			Type:   PROBLEM_INVALID_BODY,
+			Detail: "The calls of the webhook has to be 1 or higher. " + WEBHOOK_SPECIFICATION,
+			Param:  "calls",
+			Value:  strconv.Itoa(webhook.Calls),
+		})
+		return false
+	}
+	if webhook.Secret != "" && len(webhook.Secret) < signature.MIN_SECRET_LENGTH {
+		writeProblem(w, r, Problem{
+			Type:   PROBLEM_INVALID_BODY,
+			Detail: "The secret of the webhook has to be at least " + strconv.Itoa(signature.MIN_SECRET_LENGTH) + " characters. " + WEBHOOK_SPECIFICATION,
+			Param:  "secret",
+		})
 		return false
 	}
 	// Validate the country code of the country a webhook is registering to.
 	if webhook.Country != "" {
-		res, err := http.Get(COUNTRY_API_ALPHA_ENDPOINT + webhook.Country)
-		if err != nil {
+		_, err := lookup.ByCode(webhook.Country)
+		if err != nil && !errors.Is(err, countries.ErrUnknownCountry) {
 			log.Println("Error validating the country code.\n\tERROR:", err.Error())
-			http.Error(w, "Error validating the country code.\n\tERROR: "+err.Error(), http.StatusBadRequest)
+			writeError(w, r, err, "country", webhook.Country)
 			return false
 		}
-		if res.StatusCode != http.StatusOK {
+		if err != nil {
 			log.Println("ERROR. The country code of the webhook is not a valid country code.")
-			http.Error(w, "ERROR. The country code of the webhook is not a valid country code.", http.StatusBadRequest)
+			writeProblem(w, r, Problem{
+				Type:   PROBLEM_UNKNOWN_COUNTRY,
+				Status: http.StatusBadRequest,
+				Detail: "The country code of the webhook is not a valid country code",
+				Param:  "country",
+				Value:  webhook.Country,
+			})
 			return false
 		}
 	}
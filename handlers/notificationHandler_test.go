@@ -0,0 +1,778 @@
+package handlers
+
+import (
+	"assignment-2/dataset"
+	"assignment-2/delivery"
+	"assignment-2/signature"
+	"assignment-2/urlpolicy"
+	"assignment-2/webhooks"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A dataset with the renewables of Norway in 2020 and 2021
+func testDataset(t *testing.T) *dataset.Store {
+	c, err := dataset.New([][]string{
+		{"Entity", "Code", "Year", "Renewables (% equivalent primary energy)"},
+		{"Norway", "NOR", "2020", "70"},
+		{"Norway", "NOR", "2021", "71.5"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dataset.NewStaticStore(c)
+}
+
+// A dispatcher for sending tests and challenges, closed at the end of the test
+func testSender(t *testing.T) *delivery.Dispatcher {
+	dispatcher := delivery.New(delivery.Config{Timeout: time.Second}, delivery.NewMemoryDeadLetters(0), delivery.NewMemoryLog(0))
+	t.Cleanup(func() { dispatcher.Close() })
+	return dispatcher
+}
+
+// A URL policy allowing the hosts of the tests, without looking them up
+func testPolicy(t *testing.T) *urlpolicy.Policy {
+	policy, err := urlpolicy.New(urlpolicy.Config{Allow: []string{"example.com", "127.0.0.1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return policy
+}
+
+func TestNotificationHandler(t *testing.T) {
+	store := webhooks.NewMemoryStore()
+	server := httptest.NewServer(http.HandlerFunc(NotificationHandler(store, testCountries, delivery.NewMemoryLog(0), testDataset(t), testSender(t), testPolicy(t))))
+	defer server.Close()
+
+	client := http.Client{}
+
+	// Register a webhook
+	res, err := client.Post(server.URL+NOTIFICATION_ENDPOINT, "application/json",
+		strings.NewReader(`{"url": "http://example.com/hook", "country": "nor", "calls": 2}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+	assert.Equal(t, "application/json", res.Header.Get("Content-Type"))
+	created := map[string]string{}
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&created))
+	res.Body.Close()
+	id := created["webhook_id"]
+	assert.NotEmpty(t, id)
+	assert.Len(t, created["secret"], 64)
+
+	// Get it
+	res, err = client.Get(server.URL + NOTIFICATION_ENDPOINT + id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	webhook := WebhookRegistered{}
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&webhook))
+	res.Body.Close()
+	assert.Equal(t, WebhookRegistered{Webhook_id: id, Url: "http://example.com/hook", Country: "NOR", Calls: 2, Active: true, Status: "active"}, webhook)
+
+	// List all
+	res, err = client.Get(server.URL + NOTIFICATION_ENDPOINT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := WebhookPage{}
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&all))
+	res.Body.Close()
+	assert.Equal(t, WebhookPage{Webhooks: []WebhookRegistered{webhook}, Limit: DEFAULT_PAGE_LIMIT}, all)
+
+	// Delete it, twice
+	req, _ := http.NewRequest(http.MethodDelete, server.URL+NOTIFICATION_ENDPOINT+id, nil)
+	res, err = client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleted := WebhookDeleted{}
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&deleted))
+	res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, WebhookDeleted{WebhookID: id, Deleted: true}, deleted)
+
+	res, err = client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	problem := Problem{}
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&problem))
+	res.Body.Close()
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+	assert.Equal(t, PROBLEM_BASE_URI+PROBLEM_NOT_FOUND, problem.Type)
+}
+
+func TestNotificationPostInvalid(t *testing.T) {
+	handler := NotificationHandler(webhooks.NewMemoryStore(), testCountries, delivery.NewMemoryLog(0), testDataset(t), testSender(t), testPolicy(t))
+
+	tests := []struct {
+		description string
+		body        string
+		status      int
+		param       string
+	}{
+		{"Not JSON", "url=http://example.com", http.StatusBadRequest, ""},
+		{"Missing URL", `{"calls": 1}`, http.StatusBadRequest, "url"},
+		{"Invalid calls", `{"url": "http://example.com", "calls": 0}`, http.StatusBadRequest, "calls"},
+		{"Unknown country", `{"url": "http://example.com", "country": "XYZ", "calls": 1}`, http.StatusBadRequest, "country"},
+		{"Short secret", `{"url": "http://example.com", "calls": 1, "secret": "short"}`, http.StatusBadRequest, "secret"},
+		{"Unknown trigger", `{"url": "http://example.com", "calls": 1, "trigger": "sometimes"}`, http.StatusBadRequest, "trigger"},
+		{"Threshold without country", `{"url": "http://example.com", "trigger": "threshold", "condition": "above"}`, http.StatusBadRequest, "country"},
+		{"Unknown condition", `{"url": "http://example.com", "trigger": "threshold", "country": "NOR", "condition": "equal"}`, http.StatusBadRequest, "condition"},
+		{"Unknown indicator", `{"url": "http://example.com", "trigger": "threshold", "country": "NOR", "condition": "above", "indicator": "coal"}`, http.StatusBadRequest, "indicator"},
+		{"Internal URL", `{"url": "http://169.254.169.254/latest/meta-data/", "calls": 1}`, http.StatusBadRequest, "url"},
+		{"Scheme not allowed", `{"url": "ftp://example.com/hook", "calls": 1}`, http.StatusBadRequest, "url"},
+		{"Unknown event", `{"url": "http://example.com", "calls": 1, "events": ["country.deleted"]}`, http.StatusBadRequest, "events"},
+		{"Invocation event without calls", `{"url": "http://example.com", "events": ["dataset.reloaded", "country.invoked"]}`, http.StatusBadRequest, "calls"},
+		{"Threshold event without condition", `{"url": "http://example.com", "country": "NOR", "events": ["threshold.crossed"]}`, http.StatusBadRequest, "condition"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest(http.MethodPost, NOTIFICATION_ENDPOINT, strings.NewReader(test.body)))
+
+			assert.Equal(t, test.status, w.Code)
+			problem := Problem{}
+			assert.NoError(t, json.NewDecoder(w.Body).Decode(&problem))
+			assert.Equal(t, test.param, problem.Param)
+		})
+	}
+}
+
+func TestWebhookInvocationSigned(t *testing.T) {
+	secret := "a secret of the receiver"
+	received := make(chan error, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- signature.Verify(secret, body, r.Header.Get(signature.HEADER), signature.DEFAULT_TOLERANCE)
+	}))
+	defer receiver.Close()
+
+	store := webhooks.NewMemoryStore()
+	_, err := store.Create(webhooks.Webhook{URL: receiver.URL, Country: "NOR", Calls: 1, Secret: secret})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dispatcher := delivery.New(delivery.Config{}, delivery.NewMemoryDeadLetters(0), delivery.NewMemoryLog(0))
+	defer dispatcher.Close()
+	WebhookInvocation(store, dispatcher, "nor", 1)
+
+	select {
+	case err := <-received:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("The webhook was not notified")
+	}
+}
+
+func TestDeliveriesGet(t *testing.T) {
+	store := webhooks.NewMemoryStore()
+	webhook, err := store.Create(webhooks.Webhook{URL: "http://example.com/hook", Country: "NOR", Calls: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	attemptLog := delivery.NewMemoryLog(0)
+	for i := 1; i <= 3; i++ {
+		attemptLog.Record(delivery.Attempt{WebhookID: webhook.ID, DeliveryID: "d", Country: "NOR", Calls: 1, Attempt: i,
+			StatusCode: http.StatusServiceUnavailable, Latency: 1500 * time.Microsecond, Error: "unavailable", Time: time.Now()})
+	}
+	handler := NotificationHandler(store, testCountries, attemptLog, testDataset(t), testSender(t), testPolicy(t))
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, NOTIFICATION_ENDPOINT+webhook.ID+"/deliveries?limit=2", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	page := DeliveryPage{}
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&page))
+	assert.Equal(t, 3, page.Total)
+	assert.Len(t, page.Deliveries, 2)
+	assert.Equal(t, 3, page.Deliveries[0].Attempt)
+	assert.Equal(t, http.StatusServiceUnavailable, page.Deliveries[0].StatusCode)
+	assert.Equal(t, 1.5, page.Deliveries[0].LatencyMs)
+	assert.Equal(t, NOTIFICATION_ENDPOINT+webhook.ID+"/deliveries?offset=2&limit=2", page.Next)
+
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, page.Next, nil))
+	page = DeliveryPage{}
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&page))
+	assert.Len(t, page.Deliveries, 1)
+	assert.Empty(t, page.Next)
+
+	tests := []struct {
+		description string
+		method      string
+		path        string
+		status      int
+	}{
+		{"Unknown webhook", http.MethodGet, NOTIFICATION_ENDPOINT + "unknown/deliveries", http.StatusNotFound},
+		{"Invalid limit", http.MethodGet, NOTIFICATION_ENDPOINT + webhook.ID + "/deliveries?limit=1000", http.StatusBadRequest},
+		{"Invalid offset", http.MethodGet, NOTIFICATION_ENDPOINT + webhook.ID + "/deliveries?offset=-1", http.StatusBadRequest},
+		{"Not GET", http.MethodPost, NOTIFICATION_ENDPOINT + webhook.ID + "/deliveries", http.StatusMethodNotAllowed},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest(test.method, test.path, nil))
+			assert.Equal(t, test.status, w.Code)
+		})
+	}
+}
+
+func TestNotificationUpdate(t *testing.T) {
+	store := webhooks.NewMemoryStore()
+	webhook, err := store.Create(webhooks.Webhook{URL: "http://example.com/hook", Country: "NOR", Calls: 2, Secret: "a secret of the receiver"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := NotificationHandler(store, testCountries, delivery.NewMemoryLog(0), testDataset(t), testSender(t), testPolicy(t))
+
+	// Replace it, moving it to any country
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodPut, NOTIFICATION_ENDPOINT+webhook.ID, strings.NewReader(`{"url": "http://example.com/new", "calls": 5}`)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	updated := WebhookRegistered{}
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&updated))
+	assert.Equal(t, WebhookRegistered{Webhook_id: webhook.ID, Url: "http://example.com/new", Country: "", Calls: 5, Active: true, Status: "active"}, updated)
+	all, _ := store.ListByCountry("")
+	assert.Len(t, all, 1)
+	stored, _ := store.Get(webhook.ID)
+	assert.Equal(t, webhook.Secret, stored.Secret)
+
+	// Change only the country
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodPatch, NOTIFICATION_ENDPOINT+webhook.ID, strings.NewReader(`{"country": "nor"}`)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	updated = WebhookRegistered{}
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&updated))
+	assert.Equal(t, WebhookRegistered{Webhook_id: webhook.ID, Url: "http://example.com/new", Country: "NOR", Calls: 5, Active: true, Status: "active"}, updated)
+	norway, _ := store.ListByCountry("NOR")
+	assert.Len(t, norway, 1)
+
+	tests := []struct {
+		description string
+		method      string
+		id          string
+		body        string
+		status      int
+		param       string
+	}{
+		{"Invalid calls", http.MethodPatch, webhook.ID, `{"calls": 0}`, http.StatusBadRequest, "calls"},
+		{"Unknown country", http.MethodPatch, webhook.ID, `{"country": "XYZ"}`, http.StatusBadRequest, "country"},
+		{"Missing URL", http.MethodPut, webhook.ID, `{"calls": 1}`, http.StatusBadRequest, "url"},
+		{"Not JSON", http.MethodPatch, webhook.ID, `calls=1`, http.StatusBadRequest, ""},
+		{"Unknown webhook", http.MethodPut, "unknown", `{"url": "http://example.com", "calls": 1}`, http.StatusNotFound, "id"},
+		{"No ID", http.MethodPatch, "", `{"calls": 1}`, http.StatusBadRequest, "id"},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest(test.method, NOTIFICATION_ENDPOINT+test.id, strings.NewReader(test.body)))
+			assert.Equal(t, test.status, w.Code)
+			problem := Problem{}
+			assert.NoError(t, json.NewDecoder(w.Body).Decode(&problem))
+			assert.Equal(t, test.param, problem.Param)
+		})
+	}
+
+	// Nothing was changed by the invalid requests
+	stored, _ = store.Get(webhook.ID)
+	assert.Equal(t, 5, stored.Calls)
+	assert.Equal(t, "NOR", stored.Country)
+}
+
+func TestThresholdWebhook(t *testing.T) {
+	store := webhooks.NewMemoryStore()
+	data := testDataset(t)
+	handler := NotificationHandler(store, testCountries, delivery.NewMemoryLog(0), data, testSender(t), testPolicy(t))
+
+	// One condition that is already true, and one that is not yet
+	register := func(body string) string {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodPost, NOTIFICATION_ENDPOINT, strings.NewReader(body)))
+		assert.Equal(t, http.StatusCreated, w.Code)
+		created := map[string]string{}
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&created))
+		return created["webhook_id"]
+	}
+	above := register(`{"url": "http://example.com/above", "country": "nor", "trigger": "threshold", "condition": "above", "threshold": 71}`)
+	change := register(`{"url": "http://example.com/change", "country": "NOR", "trigger": "threshold", "condition": "change_above", "threshold": 2}`)
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, NOTIFICATION_ENDPOINT+change, nil))
+	registered := WebhookRegistered{}
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&registered))
+	threshold := 2.0
+	assert.Equal(t, WebhookRegistered{Webhook_id: change, Url: "http://example.com/change", Country: "NOR",
+		Trigger: "threshold", Indicator: "renewables", Condition: "change_above", Threshold: &threshold, Active: true, Status: "active"}, registered)
+
+	// Loading the same dataset again notifies neither
+	deliverer := &fakeDeliverer{}
+	ThresholdInvocation(store, deliverer, data.Get())
+	assert.Empty(t, deliverer.queued)
+
+	// A new release where Norway grows by 3.5 points
+	c, err := dataset.New([][]string{
+		{"Entity", "Code", "Year", "Renewables (% equivalent primary energy)"},
+		{"Norway", "NOR", "2021", "71.5"},
+		{"Norway", "NOR", "2022", "75"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ThresholdInvocation(store, deliverer, c)
+	if assert.Len(t, deliverer.queued, 1) {
+		assert.Equal(t, change, deliverer.queued[0].WebhookID)
+		notification := ThresholdNotification{}
+		assert.NoError(t, json.Unmarshal(deliverer.queued[0].Body, &notification))
+		assert.Equal(t, 2022, notification.Year)
+		assert.Equal(t, 75.0, notification.Value)
+		if assert.NotNil(t, notification.Change) {
+			assert.InDelta(t, 3.5, *notification.Change, 1e-9)
+		}
+	}
+
+	// Only once while the condition stays true
+	ThresholdInvocation(store, deliverer, c)
+	assert.Len(t, deliverer.queued, 1)
+
+	// Threshold webhooks are not notified on invocations
+	WebhookInvocation(store, deliverer, "NOR", 1)
+	assert.Len(t, deliverer.queued, 1)
+
+	webhook, _ := store.Get(above)
+	assert.True(t, webhook.Met)
+}
+
+// A store where a webhook is changed by another request right after the webhooks are listed
+type changedAfterList struct {
+	*webhooks.MemoryStore
+	change func(webhook *webhooks.Webhook)
+}
+
+func (s changedAfterList) List() ([]webhooks.Webhook, error) {
+	listed, err := s.MemoryStore.List()
+	for _, webhook := range listed {
+		s.MemoryStore.Modify(webhook.ID, s.change)
+	}
+	return listed, err
+}
+
+func TestThresholdKeepsChanges(t *testing.T) {
+	memory := webhooks.NewMemoryStore()
+	webhook, err := memory.Create(webhooks.Webhook{URL: "http://example.com/above", Country: "NOR", Trigger: webhooks.TRIGGER_THRESHOLD,
+		Condition: webhooks.CONDITION_ABOVE, Threshold: 70})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := dataset.New([][]string{
+		{"Entity", "Code", "Year", "Renewables (% equivalent primary energy)"},
+		{"Norway", "NOR", "2022", "75"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The URL changed since the list is kept, and the notification goes to it
+	deliverer := &fakeDeliverer{}
+	ThresholdInvocation(changedAfterList{memory, func(webhook *webhooks.Webhook) {
+		webhook.URL = "http://example.com/moved"
+	}}, deliverer, c)
+	stored, _ := memory.Get(webhook.ID)
+	assert.True(t, stored.Met)
+	assert.Equal(t, "http://example.com/moved", stored.URL)
+	if assert.Len(t, deliverer.queued, 1) {
+		assert.Equal(t, "http://example.com/moved", deliverer.queued[0].URL)
+	}
+
+	// Paused since the list, it is neither notified nor changed
+	stored.Met = false
+	memory.Update(stored)
+	deliverer.queued = nil
+	ThresholdInvocation(changedAfterList{memory, func(webhook *webhooks.Webhook) {
+		webhook.Status = webhooks.STATUS_PAUSED
+	}}, deliverer, c)
+	stored, _ = memory.Get(webhook.ID)
+	assert.Equal(t, webhooks.STATUS_PAUSED, stored.Status)
+	assert.False(t, stored.Met)
+	assert.Empty(t, deliverer.queued)
+}
+
+func TestEvents(t *testing.T) {
+	store := webhooks.NewMemoryStore()
+	data := testDataset(t)
+	handler := NotificationHandler(store, testCountries, delivery.NewMemoryLog(0), data, testSender(t), testPolicy(t))
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodPost, NOTIFICATION_ENDPOINT, strings.NewReader(
+		`{"url": "http://example.com/events", "country": "NOR", "calls": 1, "events": ["country.invoked", "dataset.reloaded", "country.invoked"]}`)))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	created := map[string]string{}
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&created))
+	subscribed, _ := store.Get(created["webhook_id"])
+	assert.Equal(t, []string{webhooks.EVENT_COUNTRY_INVOKED, webhooks.EVENT_DATASET_RELOADED}, subscribed.Events)
+
+	// Registered before events, it keeps getting the notification alone
+	legacy, err := store.Create(webhooks.Webhook{URL: "http://example.com/legacy", Country: "NOR", Calls: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deliverer := &fakeDeliverer{}
+	WebhookInvocation(store, deliverer, "NOR", 3)
+	if assert.Len(t, deliverer.queued, 2) {
+		for _, queued := range deliverer.queued {
+			if queued.WebhookID == legacy.ID {
+				assert.JSONEq(t, `{"webhook_id": "`+legacy.ID+`", "country": "NOR", "calls": 3}`, string(queued.Body))
+				continue
+			}
+			event := map[string]interface{}{}
+			assert.NoError(t, json.Unmarshal(queued.Body, &event))
+			assert.NotEmpty(t, event["id"])
+			assert.NotEmpty(t, event["timestamp"])
+			assert.Equal(t, webhooks.EVENT_COUNTRY_INVOKED, event["type"])
+			assert.EqualValues(t, EVENT_SCHEMA_VERSION, event["schema_version"])
+			assert.Equal(t, map[string]interface{}{"webhook_id": subscribed.ID, "country": "NOR", "calls": 3.0}, event["data"])
+		}
+	}
+
+	// Only the subscribed webhook hears about a new dataset
+	deliverer = &fakeDeliverer{}
+	DatasetInvocation(store, deliverer, data.Get(), time.Now())
+	if assert.Len(t, deliverer.queued, 1) {
+		assert.Equal(t, subscribed.ID, deliverer.queued[0].WebhookID)
+		event := struct {
+			Type string      `json:"type"`
+			Data DatasetInfo `json:"data"`
+		}{}
+		assert.NoError(t, json.Unmarshal(deliverer.queued[0].Body, &event))
+		assert.Equal(t, webhooks.EVENT_DATASET_RELOADED, event.Type)
+		assert.Equal(t, 1, event.Data.Countries)
+	}
+}
+
+func TestNotificationTest(t *testing.T) {
+	secret := "a secret of the receiver"
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if signature.Verify(secret, body, r.Header.Get(signature.HEADER), signature.DEFAULT_TOLERANCE) != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+		w.Write(body)
+	}))
+	defer receiver.Close()
+
+	store := webhooks.NewMemoryStore()
+	webhook, err := store.Create(webhooks.Webhook{URL: receiver.URL, Country: "NOR", Calls: 1, Secret: secret})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := NotificationHandler(store, testCountries, delivery.NewMemoryLog(0), testDataset(t), testSender(t), testPolicy(t))
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodPost, NOTIFICATION_ENDPOINT+webhook.ID+"/test", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	result := TestResult{}
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&result))
+	assert.True(t, result.Delivered)
+	assert.Equal(t, http.StatusOK, result.StatusCode)
+	assert.JSONEq(t, `{"webhook_id": "`+webhook.ID+`", "country": "NOR", "test": true}`, result.Response)
+
+	// A receiver that refuses it
+	webhook.Secret = "another secret of the receiver"
+	store.Update(webhook)
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodPost, NOTIFICATION_ENDPOINT+webhook.ID+"/test", nil))
+	result = TestResult{}
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&result))
+	assert.False(t, result.Delivered)
+	assert.Equal(t, http.StatusUnauthorized, result.StatusCode)
+	assert.NotEmpty(t, result.Error)
+
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodPost, NOTIFICATION_ENDPOINT+"unknown/test", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, NOTIFICATION_ENDPOINT+webhook.ID+"/test", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
+
+func TestNotificationVerify(t *testing.T) {
+	// Echoes the challenge as JSON, the other receiver answers without it
+	echo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		verification := Verification{}
+		json.NewDecoder(r.Body).Decode(&verification)
+		json.NewEncoder(w).Encode(Verification{Challenge: verification.Challenge})
+	}))
+	defer echo.Close()
+	silent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer silent.Close()
+
+	store := webhooks.NewMemoryStore()
+	handler := NotificationHandler(store, testCountries, delivery.NewMemoryLog(0), testDataset(t), testSender(t), testPolicy(t))
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodPost, NOTIFICATION_ENDPOINT, strings.NewReader(`{"url": "`+silent.URL+`", "calls": 1, "verify": true}`)))
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	all, _ := store.List()
+	assert.Empty(t, all)
+
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodPost, NOTIFICATION_ENDPOINT, strings.NewReader(`{"url": "`+echo.URL+`", "calls": 1, "verify": true}`)))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	created := map[string]string{}
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&created))
+	webhook, _ := store.Get(created["webhook_id"])
+	assert.True(t, webhook.Verified)
+
+	// Still verified with the same URL, but not with a new one
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodPatch, NOTIFICATION_ENDPOINT+webhook.ID, strings.NewReader(`{"calls": 3}`)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	webhook, _ = store.Get(webhook.ID)
+	assert.True(t, webhook.Verified)
+
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodPatch, NOTIFICATION_ENDPOINT+webhook.ID, strings.NewReader(`{"url": "`+silent.URL+`"}`)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	webhook, _ = store.Get(webhook.ID)
+	assert.False(t, webhook.Verified)
+}
+
+func TestNotificationPauseResume(t *testing.T) {
+	store := webhooks.NewMemoryStore()
+	webhook, err := store.Create(webhooks.Webhook{URL: "http://example.com/hook", Country: "NOR", Calls: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := NotificationHandler(store, testCountries, delivery.NewMemoryLog(0), testDataset(t), testSender(t), testPolicy(t))
+	deliverer := &fakeDeliverer{}
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodPost, NOTIFICATION_ENDPOINT+webhook.ID+"/pause", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	registered := WebhookRegistered{}
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&registered))
+	assert.False(t, registered.Active)
+	assert.Equal(t, webhooks.STATUS_PAUSED, registered.Status)
+
+	// Paused webhooks are not notified, and stay paused when changed
+	WebhookInvocation(store, deliverer, "NOR", 1)
+	assert.Empty(t, deliverer.queued)
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodPatch, NOTIFICATION_ENDPOINT+webhook.ID, strings.NewReader(`{"calls": 2}`)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	stored, _ := store.Get(webhook.ID)
+	assert.Equal(t, webhooks.STATUS_PAUSED, stored.Status)
+
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodPost, NOTIFICATION_ENDPOINT+webhook.ID+"/resume", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	WebhookInvocation(store, deliverer, "NOR", 2)
+	assert.Len(t, deliverer.queued, 1)
+
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, NOTIFICATION_ENDPOINT+webhook.ID+"/pause", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
+
+// A store whose listing fails
+type failingStore struct {
+	*webhooks.MemoryStore
+}
+
+func (s failingStore) Page(query webhooks.Query) (webhooks.Page, error) {
+	return webhooks.Page{}, errors.New("the storage can not be reached")
+}
+
+func TestNotificationList(t *testing.T) {
+	store := webhooks.NewMemoryStore()
+	for _, webhook := range []webhooks.Webhook{
+		{URL: "http://example.com/a", Country: "NOR", Calls: 1},
+		{URL: "http://example.com/b", Country: "NOR", Calls: 1, Status: webhooks.STATUS_PAUSED},
+		{URL: "http://other.example.com/c", Calls: 1},
+		{URL: "http://example.com/d", Country: "SWE", Calls: 1},
+		{URL: "http://example.com/e", Country: "NOR", Calls: 1},
+	} {
+		if _, err := store.Create(webhook); err != nil {
+			t.Fatal(err)
+		}
+	}
+	all, _ := store.List()
+	handler := NotificationHandler(store, testCountries, delivery.NewMemoryLog(0), testDataset(t), testSender(t), testPolicy(t))
+
+	list := func(path string) (WebhookPage, int) {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodGet, path, nil))
+		page := WebhookPage{}
+		json.NewDecoder(w.Body).Decode(&page)
+		return page, w.Code
+	}
+	urls := func(page WebhookPage) []string {
+		listed := []string{}
+		for _, webhook := range page.Webhooks {
+			listed = append(listed, webhook.Url)
+		}
+		return listed
+	}
+
+	// Following the next pages gives every webhook once, oldest first
+	listed := []string{}
+	pages := 0
+	for path := NOTIFICATION_ENDPOINT + "?limit=2"; path != ""; pages++ {
+		page, code := list(path)
+		assert.Equal(t, http.StatusOK, code)
+		listed = append(listed, urls(page)...)
+		path = page.Next
+	}
+	assert.Equal(t, 3, pages)
+	expected := []string{}
+	for _, webhook := range all {
+		expected = append(expected, webhook.URL)
+	}
+	assert.Equal(t, expected, listed)
+
+	page, _ := list(NOTIFICATION_ENDPOINT + "?sort=-created&limit=1")
+	assert.Equal(t, []string{all[4].URL}, urls(page))
+	assert.NotEmpty(t, page.Cursor)
+
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		{"?country=nor", []string{"http://example.com/a", "http://example.com/b", "http://example.com/e"}},
+		{"?country=", []string{"http://other.example.com/c"}},
+		{"?host=other.example.com", []string{"http://other.example.com/c"}},
+		{"?status=paused", []string{"http://example.com/b"}},
+		{"?status=active&country=NOR", []string{"http://example.com/a", "http://example.com/e"}},
+	}
+	for _, test := range tests {
+		page, code := list(NOTIFICATION_ENDPOINT + test.query)
+		assert.Equal(t, http.StatusOK, code, test.query)
+		assert.ElementsMatch(t, test.expected, urls(page), test.query)
+		assert.Empty(t, page.Next, test.query)
+	}
+
+	for _, query := range []string{"?limit=0", "?status=gone", "?sort=url", "?cursor=not-a-cursor"} {
+		_, code := list(NOTIFICATION_ENDPOINT + query)
+		assert.Equal(t, http.StatusBadRequest, code, query)
+	}
+
+	// Errors of the storage are returned, not fatal
+	w := httptest.NewRecorder()
+	NotificationHandler(failingStore{store}, testCountries, delivery.NewMemoryLog(0), testDataset(t), testSender(t), testPolicy(t))(
+		w, httptest.NewRequest(http.MethodGet, NOTIFICATION_ENDPOINT, nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestDeliveryResult(t *testing.T) {
+	store := webhooks.NewMemoryStore()
+	webhook, err := store.Create(webhooks.Webhook{URL: "http://example.com/hook", Calls: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := DeliveryResult(store, 3)
+	failed := &delivery.StatusError{StatusCode: http.StatusGone}
+
+	// A success in between starts the count over
+	result(delivery.Delivery{WebhookID: webhook.ID}, failed)
+	result(delivery.Delivery{WebhookID: webhook.ID}, failed)
+	result(delivery.Delivery{WebhookID: webhook.ID}, nil)
+	stored, _ := store.Get(webhook.ID)
+	assert.Equal(t, 0, stored.Failures)
+	assert.True(t, stored.Active())
+
+	for i := 0; i < 3; i++ {
+		result(delivery.Delivery{WebhookID: webhook.ID}, failed)
+	}
+	stored, _ = store.Get(webhook.ID)
+	assert.False(t, stored.Active())
+	registered := registeredWebhook(stored)
+	assert.Equal(t, webhooks.STATUS_DISABLED, registered.Status)
+	if assert.NotNil(t, registered.Disabled) {
+		assert.Equal(t, webhooks.EVENT_WEBHOOK_DISABLED, registered.Disabled.Event)
+		assert.Equal(t, 3, registered.Disabled.Failures)
+		assert.Equal(t, failed.Error(), registered.Disabled.Reason)
+	}
+
+	// Deliveries to deleted webhooks are ignored
+	result(delivery.Delivery{WebhookID: "deleted"}, failed)
+}
+
+// A store where a webhook is changed by another request right after it is read
+type changedAfterGet struct {
+	*webhooks.MemoryStore
+	change func(webhook *webhooks.Webhook)
+}
+
+func (s changedAfterGet) Get(id string) (webhooks.Webhook, error) {
+	webhook, err := s.MemoryStore.Get(id)
+	if err == nil {
+		s.MemoryStore.Modify(id, s.change)
+	}
+	return webhook, err
+}
+
+func TestUpdateKeepsState(t *testing.T) {
+	memory := webhooks.NewMemoryStore()
+	webhook, err := memory.Create(webhooks.Webhook{URL: "http://example.com/hook", Country: "NOR", Calls: 1, Failures: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Disabled by a failed delivery between the read and the write of the update
+	store := changedAfterGet{memory, func(webhook *webhooks.Webhook) {
+		webhook.Failures = 3
+		webhook.Disable(3, "the webhook responded with status 503")
+	}}
+	handler := NotificationHandler(store, testCountries, delivery.NewMemoryLog(0), testDataset(t), testSender(t), testPolicy(t))
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodPatch, NOTIFICATION_ENDPOINT+webhook.ID, strings.NewReader(`{"calls": 5}`)))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	stored, _ := memory.Get(webhook.ID)
+	assert.Equal(t, 5, stored.Calls)
+	assert.Equal(t, webhooks.STATUS_DISABLED, stored.Status)
+	assert.Equal(t, 3, stored.Failures)
+	if assert.NotNil(t, stored.Disabled) {
+		assert.Equal(t, 3, stored.Disabled.Failures)
+	}
+	registered := WebhookRegistered{}
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&registered))
+	assert.Equal(t, webhooks.STATUS_DISABLED, registered.Status)
+}
+
+func TestDeliveryResultKeepsChanges(t *testing.T) {
+	store := webhooks.NewMemoryStore()
+	webhook, err := store.Create(webhooks.Webhook{URL: "http://example.com/hook", Calls: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := DeliveryResult(store, 2)
+	failed := &delivery.StatusError{StatusCode: http.StatusServiceUnavailable}
+
+	// Paused and moved between two failed deliveries, only the count changes after
+	result(delivery.Delivery{WebhookID: webhook.ID}, failed)
+	stored, _ := store.Get(webhook.ID)
+	stored.Status = webhooks.STATUS_PAUSED
+	stored.URL = "http://example.com/moved"
+	_, err = store.Update(stored)
+	assert.NoError(t, err)
+	result(delivery.Delivery{WebhookID: webhook.ID}, failed)
+
+	stored, _ = store.Get(webhook.ID)
+	assert.Equal(t, webhooks.STATUS_PAUSED, stored.Status)
+	assert.Equal(t, "http://example.com/moved", stored.URL)
+	assert.Equal(t, 2, stored.Failures)
+	assert.Nil(t, stored.Disabled)
+}
@@ -1,18 +1,17 @@
 package handlers
 
 import (
+	"assignment-2/countries"
+	"assignment-2/dataset"
 	"encoding/json"
-	"errors"
-	"flag"
 	"fmt"
 	"log"
 	"net/http"
-	"net/http/httptest"
 	"strconv"
 	"strings"
 )
 
-func RenewCurrentHandler(csvData [][]string, years map[string]string, msg chan string) func(w http.ResponseWriter, r *http.Request) {
+func RenewCurrentHandler(data DatasetProvider, lookup CountryLookup, notifier Notifier) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Log requests
 		log.Println("Started", r.Method, "on", r.URL)
@@ -21,7 +20,8 @@ func RenewCurrentHandler(csvData [][]string, years map[string]string, msg chan s
 		// Check for HTTP method (only GET is allowed)
 		if r.Method != http.MethodGet {
 			log.Println("E: Invalid method for this endpoint")
-			http.Error(w, "Method not supported for this endpoint", http.StatusMethodNotAllowed)
+			methodNotAllowed(w, r, http.MethodGet)
+			return
 		}
 
 		// Parameters
@@ -49,21 +49,50 @@ func RenewCurrentHandler(csvData [][]string, years map[string]string, msg chan s
 			fmt.Printf("DEBUG: Neighbours parameter not set\n")
 		}
 
+		// Indicator, using the same version of the dataset for the whole request
+		ds, ok := selectIndicator(w, r, data.Get())
+		if !ok {
+			return
+		}
+
+		// Region
+		region, computed, ok := selectRegion(w, r, ds)
+		if !ok {
+			return
+		}
+		if region != nil && country != "" {
+			writeProblem(w, r, Problem{
+				Type:   PROBLEM_INVALID_PARAMETER,
+				Detail: "A country and a region can not be requested at the same time",
+				Param:  "region",
+				Value:  r.URL.Query().Get("region"),
+			})
+			return
+		}
+
 		fmt.Println("Building response data...")
 		// Build the response data
 		res := []RenewableDataEntry{}
 		// Check for parameters
 		if country != "" {
-			res = BuildResponse(csvData, years, country, neighbours)
+			res, err = BuildResponse(ds, lookup, country, neighbours)
+			if err != nil {
+				writeError(w, r, err, "country", country)
+				return
+			}
+		} else if region != nil {
+			res = BuildResponseRegion(ds, *region, computed)
 		} else {
-			res = BuildResponseAll(csvData, years)
+			res = BuildResponseAll(ds)
 		}
 
-		// Check if no data was found for the request
-		if country != "" && len(res) < 1 {
-			msg := fmt.Sprintf("Your request returned no data, this may be because your supplied country code is invalid or there are no data available for your country code!")
-			msg += fmt.Sprintf("\nYour query:\nCountry code = %s, Neighbour flag = %s", country, strconv.FormatBool(neighbours))
-			http.Error(w, msg, http.StatusNotFound)
+		if region != nil && len(res) < 1 {
+			writeProblem(w, r, Problem{
+				Type:   PROBLEM_NOT_FOUND,
+				Detail: "There are no data available for the region '" + region.Name + "'",
+				Param:  "region",
+				Value:  r.URL.Query().Get("region"),
+			})
 			return
 		}
 
@@ -78,257 +107,124 @@ func RenewCurrentHandler(csvData [][]string, years map[string]string, msg chan s
 
 		if err != nil {
 			log.Println("E: There was an error generating the JSON data")
-			http.Error(w, "Internal Server Error: There was an error generating the JSON data", http.StatusInternalServerError)
+			writeProblem(w, r, Problem{Type: PROBLEM_INTERNAL, Detail: "There was an error generating the JSON data"})
 			return
 		}
 
-		// Send messages only if a country was specified and not running tests
-		if country != "" && flag.Lookup("test.v") == nil {
-			// Send a message to the channel if a country was requested
-			msg <- strings.ToLower(country)
+		// Notify about the invocation if a country was requested
+		if country != "" {
+			notifier.Notify(country)
 		}
 	}
 
 }
 
-// Determine latest year for each country
-func GetLatestYears(data [][]string) (map[string]string, error) {
-
-	latestYear := make(map[string]string)
-
-	for idx, entry := range data {
-		// Skip title row
-		if idx == 0 {
-			continue
-		}
-
-		// Skip entities that doesn't have a code (non-countries)
-		if len(entry[CSV_COL_CODE]) != 3 {
-			continue
-		}
-
-		// Get latest year for entry
-		year, ok := latestYear[entry[CSV_COL_CODE]]
-		if ok {
-			// Get year in map and from CSV entry
-			year_int, err := strconv.Atoi(year)
-			if err != nil {
-				log.Println("E: Unable to convert year to integer")
-				return nil, errors.New("Unable to convert year to intege")
-			}
-			new_year, err := strconv.Atoi(entry[CSV_COL_YEAR])
-			if err != nil {
-				log.Println("E: Unable to convert year to integer")
-				return nil, errors.New("Unable to convert year to integer")
-			}
-			// Check if the new year found is larger
-			if new_year > year_int {
-				latestYear[strings.ToLower(entry[CSV_COL_CODE])] = entry[CSV_COL_YEAR]
-				latestYear[strings.ToLower(entry[CSV_COL_ENTITY])] = entry[CSV_COL_YEAR]
-			}
-		} else {
-			// Save a possible year
-			latestYear[strings.ToLower(entry[CSV_COL_CODE])] = entry[CSV_COL_YEAR]
-			latestYear[strings.ToLower(entry[CSV_COL_ENTITY])] = entry[CSV_COL_YEAR]
-		}
+// Create a response entry for the latest year of an entity
+func latestEntry(ds *dataset.Dataset, entity *dataset.Entity) (RenewableDataEntry, bool) {
+	latest, ok := entity.Latest()
+	if !ok {
+		return RenewableDataEntry{}, false
 	}
 
-	return latestYear, nil
-}
-
-// Determine country/code mapping
-func GetCountryCodeMapping(data [][]string) map[string]string {
-	mapping := make(map[string]string)
-	for _, entry := range data {
-		_, ok := mapping[strings.ToLower(entry[CSV_COL_ENTITY])]
-		if !ok {
-			mapping[strings.ToLower(entry[CSV_COL_ENTITY])] = strings.ToLower(entry[CSV_COL_CODE])
-		}
-	}
-	return mapping
-}
-
-// Function that gets the neighbour countries for a given country
-func GetNeighbours(country string, code bool) ([]string, error) {
-	var res *http.Response
-	var err error
-
-	if code {
-		// Get data from Countries API
-		if flag.Lookup("test.v") == nil {
-			res, err = http.Get(COUNTRY_API_BASE_ENDPOINT + "alpha/" + country)
-		} else {
-			req := httptest.NewRequest(http.MethodGet, "/"+country, nil)
-			w := httptest.NewRecorder()
-			CountriesStubHandler(w, req)
-			res = w.Result()
-		}
-	} else {
-		// Get data from Countries API
-		if flag.Lookup("test.v") == nil {
-			res, err = http.Get(COUNTRY_API_BASE_ENDPOINT + "name/" + country)
-		} else {
-			req := httptest.NewRequest(http.MethodGet, "/"+country, nil)
-			w := httptest.NewRecorder()
-			CountriesStubHandler(w, req)
-			res = w.Result()
-		}
-	}
-	if err != nil {
-		fmt.Println("E: There was an error contacting the Countries API")
-		return nil, err
-	}
-
-	// Check for status code
-	if res.StatusCode != http.StatusOK {
-		fmt.Println("E: Countries API returned " + strconv.Itoa(res.StatusCode))
-		return nil, errors.New("Countries API returned" + strconv.Itoa(res.StatusCode))
-	}
-
-	// Decode JSON to get neighbours
-	jsonData := json.NewDecoder(res.Body)
-
-	data := []CountriesAPICountry{}
-
-	err = jsonData.Decode(&data)
-	if err != nil {
-		fmt.Println("E: There was an error decoding the data from the Countries API")
-		return nil, err
-	}
-
-	if len(data) != 1 {
-		fmt.Printf("There should only be one country returned, %d countries was returned!", len(data))
-		return nil, errors.New("There should only be one country returned, " + strconv.Itoa(len(data)) + " countries was returned!")
-	}
-	return data[0].Borders, nil
+	return RenewableDataEntry{
+		Name:       entity.Name,
+		ISOCode:    entity.Code,
+		Year:       strconv.Itoa(latest.Year),
+		Percentage: latest.Value,
+		Indicator:  ds.Indicator().Name,
+		Unit:       ds.Indicator().Unit,
+	}, true
 }
 
 // Build response data (for all countries)
-func BuildResponseAll(csvData [][]string, years map[string]string) []RenewableDataEntry {
+func BuildResponseAll(ds *dataset.Dataset) []RenewableDataEntry {
 	// Generate the response data
 	data := []RenewableDataEntry{}
 
-	for idx, entry := range csvData {
-		// Skip title row
-		if idx == 0 {
-			continue
-		}
-
-		// Skip entities that doesn't have a code (non-countries)
-		if len(entry[CSV_COL_CODE]) != 3 {
+	// Only entities with a code (countries) are included
+	for _, entity := range ds.Countries() {
+		entry, ok := latestEntry(ds, entity)
+		if !ok {
 			continue
 		}
-
-		// Check if entry has data for latest year
-		if entry[CSV_COL_YEAR] == years[strings.ToLower(entry[CSV_COL_CODE])] {
-			fmt.Printf("Adding %s, %s...\n", entry[CSV_COL_ENTITY], entry[CSV_COL_YEAR])
-
-			// Parse float
-			renewablePercentage, err := strconv.ParseFloat(entry[CSV_COL_RENEWABLES], 64)
-			if err != nil {
-				log.Println("E: There was an error parsing renewable percentage, probably an error with the dataset")
-				// Try next entry
-				continue
-			}
-
-			// Create the response entry
-			newRenewableDataEntry := RenewableDataEntry{
-				Name:       entry[CSV_COL_ENTITY],
-				ISOCode:    entry[CSV_COL_CODE],
-				Year:       entry[CSV_COL_YEAR],
-				Percentage: renewablePercentage,
-			}
-
-			// Add it
-			data = append(data, newRenewableDataEntry)
-		}
+		data = append(data, entry)
 	}
 
 	return data
 }
 
 // Build response data for a single country (and possibly its neighbours)
-func BuildResponse(csvData [][]string, years map[string]string, country string, neighbours bool) []RenewableDataEntry {
+func BuildResponse(ds *dataset.Dataset, lookup CountryLookup, country string, neighbours bool) ([]RenewableDataEntry, error) {
 	// Generate the response data
 	data := []RenewableDataEntry{}
 	// Allowed countries
-	countries := []string{country}
+	names := []string{country}
 
 	if neighbours {
-		// Get the countries (main + neighbours)
-		var neighbourCountries []string
-		neighbourCountries, err := GetNeighbours(country, true)
-		// Try again, if retrieving using code was unsuccessful
+		// Get the countries (main + neighbours), by code or by name
+		neighbourCountries, err := lookup.Neighbours(country)
 		if err != nil {
-			println("E: Failed to retrieve neighbours for country with code")
-			neighbourCountries, err = GetNeighbours(country, false)
-			if err != nil {
-				println("E: Failed to retrieve neighbours for country with name")
-				// TODO: Implement proper error return
-				return nil
-			}
+			log.Println("E: Failed to retrieve neighbours for country. Error:", err.Error())
+			return nil, err
 		}
 
 		for _, country := range neighbourCountries {
-			countries = append(countries, country)
+			names = append(names, country)
 		}
 	}
 
-	// Start looking through the CSV data
-	for idx, entry := range csvData {
-		// Skip title row
-		if idx == 0 {
+	// Look up each of the countries, skipping entities that doesn't have a code (non-countries)
+	entities := []*dataset.Entity{}
+	seen := make(map[*dataset.Entity]bool)
+	for _, country := range names {
+		entity, ok := ds.Lookup(country)
+		if !ok || !entity.IsCountry() || seen[entity] {
 			continue
 		}
+		seen[entity] = true
+		entities = append(entities, entity)
+	}
 
-		// Skip entities that doesn't have a code (non-countries)
-		if len(entry[CSV_COL_CODE]) != 3 {
-			continue
-		}
+	// Keep the same ordering as the dataset
+	dataset.SortEntities(entities)
 
-		// Skip entity that doesn't match any of the countries
-		included := false
-		for _, country := range countries {
-			if strings.ToLower(entry[CSV_COL_CODE]) == strings.ToLower(country) {
-				included = true
-			} else if strings.ToLower(entry[CSV_COL_ENTITY]) == strings.ToLower(country) {
-				included = true
-			}
-		}
-		if !included {
+	for _, entity := range entities {
+		entry, ok := latestEntry(ds, entity)
+		if !ok {
 			continue
 		}
+		data = append(data, entry)
+	}
 
-		// Check if entry has data for latest year
-		if entry[CSV_COL_YEAR] == years[strings.ToLower(entry[CSV_COL_CODE])] ||
-			entry[CSV_COL_YEAR] == years[strings.ToLower(entry[CSV_COL_ENTITY])] {
-
-			fmt.Printf("Adding %s, %s...\n", entry[CSV_COL_ENTITY], entry[CSV_COL_YEAR])
-
-			// Parse float
-			renewablePercentage, err := strconv.ParseFloat(entry[CSV_COL_RENEWABLES], 64)
-			if err != nil {
-				log.Println("E: There was an error parsing renewable percentage, probably an error with the dataset")
-				// Try next entry
-				continue
-			}
+	// Check if no data was found for the request
+	if len(data) < 1 {
+		return nil, fmt.Errorf("%w: there are no data available for '%s'", countries.ErrUnknownCountry, country)
+	}
+	return data, nil
+}
 
-			// Create the response entry
-			newRenewableDataEntry := RenewableDataEntry{
-				Name:       entry[CSV_COL_ENTITY],
-				ISOCode:    entry[CSV_COL_CODE],
-				Year:       entry[CSV_COL_YEAR],
-				Percentage: renewablePercentage,
-			}
+// Build response data for a region (the OWID aggregate row or the mean of its member countries)
+func BuildResponseRegion(ds *dataset.Dataset, region dataset.Region, computed bool) []RenewableDataEntry {
+	data := []RenewableDataEntry{}
 
-			// Add it
-			data = append(data, newRenewableDataEntry)
+	aggregate, ok := ds.Aggregate(region, computed)
+	if !ok {
+		return data
+	}
 
-			// If there is enough entries, do an early return
-			if len(data) >= len(countries) {
-				return data
-			}
-		}
+	latest, ok := aggregate.Latest()
+	if !ok {
+		return data
 	}
-	return data
+
+	return append(data, RenewableDataEntry{
+		Name:       aggregate.Name,
+		ISOCode:    aggregate.Code,
+		Year:       strconv.Itoa(latest.Year),
+		Percentage: latest.Value,
+		Indicator:  ds.Indicator().Name,
+		Unit:       ds.Indicator().Unit,
+		Aggregate:  aggregate.Kind,
+		Countries:  latest.Countries,
+	})
 }
@@ -1,186 +1,115 @@
 package handlers
 
 import (
+	"assignment-2/countries"
+	"assignment-2/dataset"
 	"encoding/json"
 	"fmt"
+	"github.com/stretchr/testify/assert"
 	"net/http"
 	"net/http/httptest"
-	"strconv"
 	"testing"
 )
 
-func TestReadCSV(t *testing.T) {
-
-	csvData, err := ReadCSV(RENEWABLE_DATA_CSV)
-	if err != nil {
-		t.Error(err)
-	}
-
-	// Check if the CSV has the correct headers, these are hardcoded values that are expected to always stay the same
-	if csvData[0][CSV_COL_ENTITY] != "Entity" {
-		t.Error("Invalid header, column A! Expected: Entity")
-	}
-
-	if csvData[0][CSV_COL_CODE] != "Code" {
-		t.Error("Invalid header, column B! Expected: Code")
-	}
-
-	if csvData[0][CSV_COL_YEAR] != "Year" {
-		t.Error("Invalid header, column C! Expected: Year")
-	}
-
-	if csvData[0][CSV_COL_RENEWABLES] != "Renewables (% equivalent primary energy)" {
-		t.Error("Invalid header, column D! Expected: Renewables (% equivalent primary energy)")
+func TestLoadDataset(t *testing.T) {
+	ds, ok := loadTestStore(t).Get().Indicator(dataset.DEFAULT_INDICATOR)
+	if !ok {
+		t.Fatal("The data has no " + dataset.DEFAULT_INDICATOR + " column")
 	}
 
 	// Check for some entries
-	found := []RenewableDataEntry{}
-	for _, entry := range csvData {
-		if entry[CSV_COL_ENTITY] == "Norway" && entry[CSV_COL_YEAR] == "2021" {
-			percentage, err := strconv.ParseFloat(entry[CSV_COL_RENEWABLES], 64)
-			if err != nil {
-				t.Error("Failed to parse float for data entry")
-			}
-			found = append(found, RenewableDataEntry{
-				Name:       entry[CSV_COL_ENTITY],
-				ISOCode:    entry[CSV_COL_CODE],
-				Year:       entry[CSV_COL_YEAR],
-				Percentage: percentage,
-			})
-		}
-		if entry[CSV_COL_ENTITY] == "Sweden" && entry[CSV_COL_YEAR] == "2021" {
-			percentage, err := strconv.ParseFloat(entry[CSV_COL_RENEWABLES], 64)
-			if err != nil {
-				t.Error("Failed to parse float for data entry")
-			}
-			found = append(found, RenewableDataEntry{
-				Name:       entry[CSV_COL_ENTITY],
-				ISOCode:    entry[CSV_COL_CODE],
-				Year:       entry[CSV_COL_YEAR],
-				Percentage: percentage,
-			})
+	tests := []struct {
+		country string
+		year    int
+	}{
+		{"Norway", 2021},
+		{"Sweden", 2021},
+		{"France", 1990},
+		{"USA", 1980},
+	}
+	for _, test := range tests {
+		entity, ok := ds.Lookup(test.country)
+		if !ok {
+			t.Error("Unable to find " + test.country + " in the data")
+			continue
 		}
-		if entry[CSV_COL_ENTITY] == "France" && entry[CSV_COL_YEAR] == "1990" {
-			percentage, err := strconv.ParseFloat(entry[CSV_COL_RENEWABLES], 64)
-			if err != nil {
-				t.Error("Failed to parse float for data entry")
-			}
-			found = append(found, RenewableDataEntry{
-				Name:       entry[CSV_COL_ENTITY],
-				ISOCode:    entry[CSV_COL_CODE],
-				Year:       entry[CSV_COL_YEAR],
-				Percentage: percentage,
-			})
+		if _, ok := entity.Year(test.year); !ok {
+			t.Error(fmt.Sprintf("Unable to find %s in %d in the data", test.country, test.year))
 		}
-		if entry[CSV_COL_CODE] == "USA" && entry[CSV_COL_YEAR] == "1980" {
-			percentage, err := strconv.ParseFloat(entry[CSV_COL_RENEWABLES], 64)
-			if err != nil {
-				t.Error("Failed to parse float for data entry")
-			}
-			found = append(found, RenewableDataEntry{
-				Name:       entry[CSV_COL_ENTITY],
-				ISOCode:    entry[CSV_COL_CODE],
-				Year:       entry[CSV_COL_YEAR],
-				Percentage: percentage,
-			})
-		}
-	}
-	if len(found) != 4 {
-		t.Error(fmt.Sprintf("Unable to find the 4 test entries in the data, found %d entries", len(found)))
-		t.Error(found)
 	}
 }
 
-func TestGetCountryCodeMapping(t *testing.T) {
-	// Get CSV data
-	csvData, err := ReadCSV(RENEWABLE_DATA_CSV)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	// Get mapping
-	mapping := GetCountryCodeMapping(csvData)
+func TestCodeMapping(t *testing.T) {
+	mapping := loadTestStore(t).Get().CodeMapping()
 
-	// Test it
-	code := mapping["norway"]
-
-	if code != "nor" {
-		t.Error("Expected: nor, Got: " + code)
+	for name, expected := range map[string]string{"norway": "nor", "sweden": "swe", "germany": "deu", "ukraine": "ukr"} {
+		if code := mapping[name]; code != expected {
+			t.Error("Expected: " + expected + ", Got: " + code)
+		}
 	}
+}
 
-	code = mapping["sweden"]
-
-	if code != "swe" {
-		t.Error("Expected: swe, Got: " + code)
+func TestLatestYears(t *testing.T) {
+	ds, ok := loadTestStore(t).Get().Indicator(dataset.DEFAULT_INDICATOR)
+	if !ok {
+		t.Fatal("The data has no " + dataset.DEFAULT_INDICATOR + " column")
 	}
+	years := ds.LatestYears()
 
-	code = mapping["germany"]
-
-	if code != "deu" {
-		t.Error("Expected: deu, Got: " + code)
+	// Check if years are correct (all should have 2021 unless datafile has been changed)
+	for _, code := range []string{"nor", "swe", "deu", "ukr"} {
+		if y := years[code]; y != "2021" {
+			t.Error("Expected: 2021, Got: " + y)
+		}
 	}
+}
 
-	code = mapping["ukraine"]
-
-	if code != "ukr" {
-		t.Error("Expected: ukr, Got: " + code)
-	}
+// Stand-in for the Countries API, failing every lookup with err if it is set
+type fakeCountries struct {
+	countries []countries.Country
+	err       error
 }
 
-func TestGetLatestYears(t *testing.T) {
-	// Get CSV data
-	csvData, err := ReadCSV(RENEWABLE_DATA_CSV)
-	if err != nil {
-		t.Fatal(err)
-	}
+var testCountries = fakeCountries{countries: []countries.Country{
+	{Name: countries.Name{Common: "Norway"}, CCA2: "NO", CCA3: "NOR", Borders: []string{"FIN", "SWE", "RUS"}},
+}}
 
-	// Get latest years
-	years, err := GetLatestYears(csvData)
-	if err != nil {
-		t.Fatal(err)
+func (f fakeCountries) ByCode(code string) (countries.Country, error) {
+	if f.err != nil {
+		return countries.Country{}, f.err
 	}
-
-	// Check if years are correct (all should have 2021 unless datafile has been changed)
-	y := years["nor"]
-
-	if y != "2021" {
-		t.Error("Expected: 2021, Got: " + y)
+	for _, country := range f.countries {
+		if country.HasCode(code) {
+			return country, nil
+		}
 	}
+	return countries.Country{}, countries.ErrUnknownCountry
+}
 
-	y = years["swe"]
-
-	if y != "2021" {
-		t.Error("Expected: 2021, Got: " + y)
+func (f fakeCountries) Neighbours(name string) ([]string, error) {
+	if f.err != nil {
+		return nil, f.err
 	}
-
-	y = years["deu"]
-
-	if y != "2021" {
-		t.Error("Expected: 2021, Got: " + y)
+	for _, country := range f.countries {
+		if country.HasCode(name) || country.HasName(name) {
+			return country.Borders, nil
+		}
 	}
+	return nil, countries.ErrUnknownCountry
+}
 
-	y = years["ukr"]
-
-	if y != "2021" {
-		t.Error("Expected: 2021, Got: " + y)
+func (f fakeCountries) Status() int {
+	if f.err != nil {
+		return http.StatusServiceUnavailable
 	}
+	return http.StatusOK
 }
 
 func TestRenewCurrentHandler(t *testing.T) {
 	// Initialize data & handler
-	csvData, err := ReadCSV(RENEWABLE_DATA_CSV)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	years, err := GetLatestYears(csvData)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	msg := make(chan string)
+	msg := make(chan string, 10)
 
-	handler := RenewCurrentHandler(csvData, years, msg)
+	handler := RenewCurrentHandler(loadTestStore(t), testCountries, ChannelNotifier(msg))
 
 	// Setup server
 	server := httptest.NewServer(http.HandlerFunc(handler))
@@ -256,12 +185,64 @@ func TestRenewCurrentHandler(t *testing.T) {
 		t.Error("Unable to find expected: Finland, 2021 in returned data!")
 	}
 
-	// See if the correct message was sent
-	// TODO: Try to get this working
-	/*
-		m := <-msg
-		if m != "nor" {
-			t.Error(fmt.Sprintf("Request A: Channel, Expected: nor, Got: %s", m))
-		}
-	*/
+	// See if the correct messages were sent
+	m := <-msg
+	if m != "nor" {
+		t.Error(fmt.Sprintf("Request A: Channel, Expected: nor, Got: %s", m))
+	}
+	m = <-msg
+	if m != "norway" {
+		t.Error(fmt.Sprintf("Request B: Channel, Expected: norway, Got: %s", m))
+	}
+}
+
+func TestRenewCurrentHandlerErrors(t *testing.T) {
+	c, err := dataset.New([][]string{
+		{"Entity", "Code", "Year", "Renewables (% equivalent primary energy)"},
+		{"Norway", "NOR", "2021", "71.5"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		description string
+		lookup      fakeCountries
+		path        string
+		status      int
+		problem     string
+	}{
+		{"Unknown country", testCountries, "atlantis", http.StatusNotFound, PROBLEM_UNKNOWN_COUNTRY},
+		{"Unknown neighbours", testCountries, "atlantis?neighbours=true", http.StatusNotFound, PROBLEM_UNKNOWN_COUNTRY},
+		{"Countries API down", fakeCountries{err: countries.ErrUnavailable}, "nor?neighbours=true", http.StatusServiceUnavailable, PROBLEM_UPSTREAM_UNAVAILABLE},
+		{"Ambiguous country", fakeCountries{err: countries.ErrAmbiguousCountry}, "guinea?neighbours=true", http.StatusConflict, PROBLEM_AMBIGUOUS_COUNTRY},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			msg := make(chan string, 1)
+			handler := RenewCurrentHandler(dataset.NewStaticStore(c), test.lookup, ChannelNotifier(msg))
+
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest(http.MethodGet, RENEW_CURRENT_ENDPOINT+test.path, nil))
+
+			assert.Equal(t, test.status, w.Code)
+			problem := Problem{}
+			assert.NoError(t, json.NewDecoder(w.Body).Decode(&problem))
+			assert.Equal(t, PROBLEM_BASE_URI+test.problem, problem.Type)
+			// Failed requests are not counted as invocations
+			assert.Len(t, msg, 0)
+		})
+	}
+}
+
+func TestChannelNotifier(t *testing.T) {
+	msg := make(chan string, 1)
+	notifier := ChannelNotifier(msg)
+
+	// Left out instead of waiting when the channel is full
+	notifier.Notify("NOR")
+	notifier.Notify("SWE")
+	assert.Equal(t, "nor", <-msg)
+	assert.Empty(t, msg)
 }
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"assignment-2/webhooks"
 	"encoding/json"
 	"log"
 	"net/http"
@@ -17,47 +18,43 @@ func init() {
 	startTime = time.Now()
 }
 
-func statusCodeCountry() int {
-	r, err := http.Get(COUNTRY_API_ALL_ENDPOINT)
-	if err != nil {
-
-	}
-
-	return r.StatusCode
+func statusCodeCountry(lookup CountryLookup) int {
+	return lookup.Status()
 }
 
-func statusCodeNotificationDB() int {
-	cols := client.Collections(ctx)
-	_, err := cols.Next()
+func statusCodeNotificationDB(store webhooks.Store) int {
+	err := store.Ping()
 	if err != nil {
-		log.Println("Connection to the database is gone")
+		log.Println("Connection to the database is gone. Error:", err.Error())
 		return http.StatusInternalServerError
 	} else {
 		return http.StatusOK
 	}
 }
 
-func webhooksNotifcation() int {
-
-	alldocs, _ := client.Collection(WEBHOOKS_COLLECTION).Documents(ctx).GetAll()
-	return len(alldocs)
-
+func webhooksNotifcation(store webhooks.Store) int {
+	all, err := store.List()
+	if err != nil {
+		log.Println("Failed to count the webhooks. Error:", err.Error())
+	}
+	return len(all)
 }
 
-func StatusHandler(w http.ResponseWriter, r *http.Request) {
-
-	Diagnostics := Diagnostics{
-		CountriesApi:   statusCodeCountry(),
-		NotificationDb: statusCodeNotificationDB(),
-		Webhooks:       webhooksNotifcation(),
-		Version:        AppVersion,
-		Uptime:         uptime()}
-	w.Header().Add("content-type", "application/json")
-	encoder := json.NewEncoder(w)
-
-	err := encoder.Encode(Diagnostics)
-	if err != nil {
-		http.Error(w, "Error during encoding: "+err.Error(), http.StatusInternalServerError)
-		return
+func StatusHandler(lookup CountryLookup, store webhooks.Store) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		Diagnostics := Diagnostics{
+			CountriesApi:   statusCodeCountry(lookup),
+			NotificationDb: statusCodeNotificationDB(store),
+			Webhooks:       webhooksNotifcation(store),
+			Version:        AppVersion,
+			Uptime:         uptime()}
+		w.Header().Add("content-type", "application/json")
+		encoder := json.NewEncoder(w)
+
+		err := encoder.Encode(Diagnostics)
+		if err != nil {
+			writeProblem(w, r, Problem{Type: PROBLEM_INTERNAL, Detail: "Error during encoding: " + err.Error()})
+			return
+		}
 	}
 }
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"assignment-2/webhooks"
 	"encoding/json"
 	"github.com/stretchr/testify/assert"
 	"net/http"
@@ -23,7 +24,13 @@ func init() {
 
 func TestStatusHandler(t *testing.T) {
 
-	server := httptest.NewServer(http.HandlerFunc(StatusHandler))
+	store := webhooks.NewMemoryStore()
+	_, err := store.Create(webhooks.Webhook{URL: "http://example.com/hook", Country: "NOR", Calls: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(StatusHandler(testCountries, store)))
 	defer server.Close()
 
 	client := http.Client{}
@@ -33,16 +40,16 @@ func TestStatusHandler(t *testing.T) {
 	if err != nil {
 		t.Fatal("Get request to URL failed:", err.Error())
 	}
-	// Decode array
-	testStruct := []Diagnostics{}
+	// Decode the diagnostics
+	testStruct := Diagnostics{}
 	err2 := json.NewDecoder(res.Body).Decode(&testStruct)
 
 	if err2 != nil {
 		t.Fatal("Error during decoding:", err2.Error())
 	}
-	expected := []Diagnostics{
-		{CountriesApi: 200, NotificationDb: 200, Webhooks: webhooksNotifcation(), Version: "v1", Uptime: uptime()},
-	}
+	// The uptime keeps growing, so it can only be checked to be within the uptime before and after
+	assert.True(t, testStruct.Uptime > 0 && testStruct.Uptime <= uptime())
+	expected := Diagnostics{CountriesApi: 200, NotificationDb: 200, Webhooks: 1, Version: "v1", Uptime: testStruct.Uptime}
 
 	assert.EqualValues(t, expected, testStruct, "The expected and actual output should be the same")
 }
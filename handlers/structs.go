@@ -1,37 +1,114 @@
 package handlers
 
+import "encoding/json"
+
 // Used to hold each entry in output of renewable current endpoint
 type RenewableDataEntry struct {
 	Name       string  `json:"name"`
 	ISOCode    string  `json:"isoCode"`
 	Year       string  `json:"year"`
 	Percentage float64 `json:"percentage"`
+	Indicator  string  `json:"indicator"`
+	Unit       string  `json:"unit"`
+	// Set for regions, "owid" or "computed"
+	Aggregate string `json:"aggregate,omitempty"`
+	// Number of countries a computed aggregate is made from
+	Countries int `json:"countries,omitempty"`
 }
 
 // Holds the relevant Countries API data
 
-type CountriesAPICountry struct {
-	Borders []string `json:"borders"`
-}
-
 type history struct {
 	Entity     string  `json:"entity"`
 	Code       string  `json:"iso_code,omitempty"`
 	Year       int     `json:"year,omitempty"`
 	Percentage float64 `json:"percentage"`
+	Indicator  string  `json:"indicator"`
+	Unit       string  `json:"unit"`
+	Aggregate  string  `json:"aggregate,omitempty"`
+	Countries  int     `json:"countries,omitempty"`
 }
 
 type Webhook struct {
 	URL     string `json:"url"`
 	Country string `json:"country"`
 	Calls   int    `json:"calls"`
+	// Optional, generated when not given
+	Secret string `json:"secret"`
+	// "calls" (the default) or "threshold", with the indicator, condition and threshold of the latter
+	Trigger   string  `json:"trigger"`
+	Indicator string  `json:"indicator"`
+	Condition string  `json:"condition"`
+	Threshold float64 `json:"threshold"`
+	// Types of the events to be notified about, the notifications are then sent as an Event.
+	// Left out, the webhook gets the notification of its trigger alone.
+	Events []string `json:"events"`
+	// Send a challenge to the URL that the receiver has to echo before the webhook is saved
+	Verify bool `json:"verify"`
+	// Get the invocations as a digest every interval, calls is then not needed
+	Digest bool `json:"digest"`
+}
+
+// Body of a PATCH of a webhook, fields that are left out are not changed
+type WebhookPatch struct {
+	URL       *string   `json:"url"`
+	Country   *string   `json:"country"`
+	Calls     *int      `json:"calls"`
+	Secret    *string   `json:"secret"`
+	Trigger   *string   `json:"trigger"`
+	Indicator *string   `json:"indicator"`
+	Condition *string   `json:"condition"`
+	Threshold *float64  `json:"threshold"`
+	Events    *[]string `json:"events"`
+	Verify    bool      `json:"verify"`
+	Digest    *bool     `json:"digest"`
+}
+
+// Response to the registration of a webhook, the only time its secret is given
+type WebhookCreated struct {
+	WebhookID string `json:"webhook_id"`
+	Secret    string `json:"secret"`
+}
+
+// Response to the deletion of a webhook
+type WebhookDeleted struct {
+	WebhookID string `json:"webhook_id"`
+	Deleted   bool   `json:"deleted"`
 }
 
 type WebhookRegistered struct {
-	Webhook_id interface{} `json:"webhook_id"`
-	Url        interface{} `json:"url"`
-	Country    interface{} `json:"country"`
-	Calls      interface{} `json:"calls"`
+	Webhook_id string `json:"webhook_id"`
+	Url        string `json:"url"`
+	Country    string `json:"country"`
+	Calls      int    `json:"calls"`
+	// Only given for threshold webhooks
+	Trigger   string   `json:"trigger,omitempty"`
+	Indicator string   `json:"indicator,omitempty"`
+	Condition string   `json:"condition,omitempty"`
+	Threshold *float64 `json:"threshold,omitempty"`
+	// Only given for webhooks that subscribed to events
+	Events []string `json:"events,omitempty"`
+	// Whether the invocations are sent as a digest
+	Digest bool `json:"digest,omitempty"`
+	// Whether the receiver echoed the challenge sent to the URL
+	Verified bool `json:"verified,omitempty"`
+	// The owner of the API key the webhook was registered with
+	Owner string `json:"owner,omitempty"`
+	// Whether the webhook is notified, it is not while it is paused or disabled
+	Active bool   `json:"active"`
+	Status string `json:"status"`
+	// Deliveries that failed in a row
+	Failures int `json:"failures,omitempty"`
+	// Only given while the webhook is disabled
+	Disabled *DisabledRecord `json:"disabled,omitempty"`
+}
+
+// Why a webhook was disabled
+type DisabledRecord struct {
+	Event    string `json:"event"`
+	Time     string `json:"time"`
+	Reason   string `json:"reason"`
+	Failures int    `json:"failures"`
 }
 
 type Notification struct {
@@ -40,6 +117,118 @@ type Notification struct {
 	Calls     int    `json:"calls"`
 }
 
+// The invocations of the countries a webhook is registered to, counted since the digest before
+type DigestNotification struct {
+	WebhookID string `json:"webhook_id"`
+	From      string `json:"from"`
+	To        string `json:"to"`
+	// Invocations of all the countries, and of each country by ISO code
+	Invocations int            `json:"invocations"`
+	Countries   map[string]int `json:"countries"`
+}
+
+// A notification that could not be delivered
+type DeadLetter struct {
+	ID        string          `json:"id"`
+	WebhookID string          `json:"webhook_id"`
+	URL       string          `json:"url"`
+	Body      json.RawMessage `json:"body"`
+	Attempts  int             `json:"attempts"`
+	LastError string          `json:"last_error"`
+	Created   string          `json:"created"`
+	Failed    string          `json:"failed"`
+}
+
+// One attempt at delivering a notification to a webhook
+type DeliveryAttempt struct {
+	DeliveryID string `json:"delivery_id"`
+	Country    string `json:"country"`
+	Calls      int    `json:"calls"`
+	Attempt    int    `json:"attempt"`
+	// 0 if the receiver did not answer
+	StatusCode int     `json:"status_code"`
+	LatencyMs  float64 `json:"latency_ms"`
+	Error      string  `json:"error,omitempty"`
+	Time       string  `json:"time"`
+}
+
+// A page of the registered webhooks
+type WebhookPage struct {
+	Webhooks []WebhookRegistered `json:"webhooks"`
+	Limit    int                 `json:"limit"`
+	// The cursor and path of the next page, empty on the last page
+	Cursor string `json:"cursor,omitempty"`
+	Next   string `json:"next,omitempty"`
+}
+
+// A page of the delivery attempts of a webhook, newest first
+type DeliveryPage struct {
+	WebhookID  string            `json:"webhook_id"`
+	Total      int               `json:"total"`
+	Offset     int               `json:"offset"`
+	Limit      int               `json:"limit"`
+	Deliveries []DeliveryAttempt `json:"deliveries"`
+	// The path of the next page, empty on the last page
+	Next string `json:"next,omitempty"`
+}
+
+// Result of replaying dead letters
+type Replayed struct {
+	Replayed int `json:"replayed"`
+}
+
+// Sent to a threshold webhook when its condition becomes true
+type ThresholdNotification struct {
+	WebhookID string  `json:"webhook_id"`
+	Country   string  `json:"country"`
+	Indicator string  `json:"indicator"`
+	Condition string  `json:"condition"`
+	Threshold float64 `json:"threshold"`
+	Year      int     `json:"year"`
+	Value     float64 `json:"value"`
+	// Only given for the change conditions
+	Change *float64 `json:"change,omitempty"`
+}
+
+// Sent when a test of a webhook is asked for
+type TestNotification struct {
+	WebhookID string `json:"webhook_id"`
+	Country   string `json:"country"`
+	Test      bool   `json:"test"`
+}
+
+// What the receiver of a webhook answered to a test notification
+type TestResult struct {
+	WebhookID string `json:"webhook_id"`
+	// Whether the receiver answered with a 2xx status code
+	Delivered bool `json:"delivered"`
+	// 0 if the receiver did not answer
+	StatusCode int     `json:"status_code"`
+	LatencyMs  float64 `json:"latency_ms"`
+	// The start of the body of the response
+	Response string `json:"response"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Challenge sent to the URL of a webhook, the receiver answers with the challenge as the body,
+// either alone or as this object
+type Verification struct {
+	Type      string `json:"type,omitempty"`
+	Challenge string `json:"challenge"`
+}
+
+// Envelope of the notifications sent to webhooks that subscribed to events
+type Event struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	// When the event happened
+	Timestamp string `json:"timestamp"`
+	// Version of the envelope and of the data of each type, raised when a change would break receivers
+	SchemaVersion int `json:"schema_version"`
+	// A Notification, ThresholdNotification or DatasetInfo depending on the type
+	Data interface{} `json:"data"`
+}
+
 type Diagnostics struct {
 	CountriesApi   int     `json:"countriesapi"`
 	NotificationDb int     `json:"notification_db"`
@@ -47,3 +236,25 @@ type Diagnostics struct {
 	Version        string  `json:"version"`
 	Uptime         float64 `json:"uptime"`
 }
+
+// Information about the dataset currently being served
+type DatasetInfo struct {
+	Entities   int      `json:"entities"`
+	Countries  int      `json:"countries"`
+	Indicators []string `json:"indicators"`
+	LoadedAt   string   `json:"loaded_at"`
+	// Rows left out of the dataset, see the quality report for details
+	Rejected int `json:"rejected_rows"`
+}
+
+// Problem is the body of every error response, following RFC 7807 (application/problem+json)
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	// The request parameter or body field the problem is about, and the value given for it
+	Param string `json:"param,omitempty"`
+	Value string `json:"value,omitempty"`
+}
@@ -1,28 +1,85 @@
 package handlers
 
 import (
-	"encoding/csv"
-	"log"
-	"os"
+	"assignment-2/dataset"
+	"net/http"
+	"strings"
 )
 
-// Read the CSV data
-func ReadCSV(filename string) ([][]string, error) {
-	file, err := os.Open(filename)
+// Select the dataset of the indicator asked for with the 'indicator' parameter (renewables by default)
+func selectIndicator(w http.ResponseWriter, r *http.Request, c *dataset.Collection) (*dataset.Dataset, bool) {
+	name := r.URL.Query().Get("indicator")
+	if name == "" {
+		name = dataset.DEFAULT_INDICATOR
+	}
+
+	if _, ok := dataset.FindIndicator(name); !ok {
+		writeProblem(w, r, Problem{
+			Type:   PROBLEM_INVALID_PARAMETER,
+			Detail: "Invalid indicator, must be one of: " + strings.Join(dataset.IndicatorNames(), ", "),
+			Param:  "indicator",
+			Value:  name,
+		})
+		return nil, false
+	}
 
-	if err != nil {
-		log.Println("E: Failed to read data file")
-		return nil, err
+	ds, ok := c.Indicator(name)
+	if !ok {
+		writeProblem(w, r, Problem{
+			Type:   PROBLEM_NOT_FOUND,
+			Detail: "There are no data available for the indicator '" + name + "'",
+			Param:  "indicator",
+			Value:  name,
+		})
+		return nil, false
 	}
 
-	csvData := csv.NewReader(file)
+	return ds, true
+}
 
-	data, err := csvData.ReadAll()
+// Select the region asked for with the 'region' parameter, a continent or another aggregate row of the dataset, nil if there is none.
+// The 'aggregate' parameter asks for the OWID aggregate row (default) or a computed one, which only continents have.
+func selectRegion(w http.ResponseWriter, r *http.Request, ds *dataset.Dataset) (*dataset.Region, bool, bool) {
+	name := r.URL.Query().Get("region")
+	if name == "" {
+		return nil, false, true
+	}
+
+	region, ok := ds.FindRegion(name)
+	if !ok {
+		writeProblem(w, r, Problem{
+			Type:   PROBLEM_INVALID_PARAMETER,
+			Detail: "Invalid region, must be one of: " + strings.Join(dataset.RegionNames(), ", ") + ", or the name of another aggregate in the data, like world",
+			Param:  "region",
+			Value:  name,
+		})
+		return nil, false, false
+	}
 
-	if err != nil {
-		log.Println("E: Failed to parse data file")
-		return nil, err
+	computed := false
+	aggregate := r.URL.Query().Get("aggregate")
+	switch aggregate {
+	case "", dataset.AGGREGATE_OWID:
+	case dataset.AGGREGATE_COMPUTED:
+		computed = true
+		if !region.IsContinent() {
+			writeProblem(w, r, Problem{
+				Type:   PROBLEM_INVALID_PARAMETER,
+				Detail: "Only continents can be computed, '" + region.Name + "' is only available as the '" + dataset.AGGREGATE_OWID + "' aggregate",
+				Param:  "aggregate",
+				Value:  aggregate,
+			})
+			return nil, false, false
+		}
+	default:
+		writeProblem(w, r, Problem{
+			Type:   PROBLEM_INVALID_PARAMETER,
+			Detail: "Invalid aggregate, must be either '" + dataset.AGGREGATE_OWID + "' or '" + dataset.AGGREGATE_COMPUTED + "'",
+			Param:  "aggregate",
+			Value:  aggregate,
+		})
+		return nil, false, false
 	}
 
-	return data, nil
+	return &region, computed, true
 }
@@ -0,0 +1,133 @@
+// Package signature signs the notifications sent to webhooks, and verifies them on the receiving side.
+//
+// Every notification carries the header
+//
+//	X-Webhook-Signature: t=<unix seconds>,v1=<hex HMAC-SHA256>
+//
+// where the HMAC is computed with the secret of the webhook over "<unix seconds>.<request body>".
+// A receiver written in Go can check a request with Verify:
+//
+//	body, _ := io.ReadAll(r.Body)
+//	err := signature.Verify(secret, body, r.Header.Get(signature.HEADER), signature.DEFAULT_TOLERANCE)
+//	if err != nil {
+//		http.Error(w, "invalid signature", http.StatusUnauthorized)
+//		return
+//	}
+//
+// The package only uses the standard library, so it can be copied into a receiver as it is.
+package signature
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HEADER The header the signature is sent in
+const HEADER = "X-Webhook-Signature"
+
+// DEFAULT_TOLERANCE How old a signature may be before it is refused, limiting replays of captured notifications
+const DEFAULT_TOLERANCE = 5 * time.Minute
+
+// MIN_SECRET_LENGTH The shortest secret that may be supplied when a webhook is registered
+const MIN_SECRET_LENGTH = 16
+
+// The version of the signature scheme, given as the key of the signature in the header
+const scheme = "v1"
+
+// ErrInvalidHeader is returned when the header is missing or not in the expected format
+var ErrInvalidHeader = errors.New("invalid signature header")
+
+// ErrMismatch is returned when the signature does not match the body and secret
+var ErrMismatch = errors.New("signature does not match")
+
+// ErrExpired is returned when the timestamp of the signature is outside the tolerance
+var ErrExpired = errors.New("signature timestamp outside the tolerance")
+
+// NewSecret generates a random secret of 32 bytes, hex encoded
+func NewSecret() (string, error) {
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+// Compute the HMAC of a body signed at a timestamp
+func compute(secret string, body []byte, timestamp int64) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// Sign returns the value of the signature header of a body sent at a time
+func Sign(secret string, body []byte, at time.Time) string {
+	timestamp := at.Unix()
+	return "t=" + strconv.FormatInt(timestamp, 10) + "," + scheme + "=" + hex.EncodeToString(compute(secret, body, timestamp))
+}
+
+// Verify checks that the signature header was made with the secret over the body,
+// no longer than tolerance ago (or ahead, for clocks that differ)
+func Verify(secret string, body []byte, header string, tolerance time.Duration) error {
+	return verifyAt(secret, body, header, tolerance, time.Now())
+}
+
+func verifyAt(secret string, body []byte, header string, tolerance time.Duration, now time.Time) error {
+	var timestamp int64
+	var signatures [][]byte
+	found := false
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return ErrInvalidHeader
+		}
+		switch key {
+		case "t":
+			t, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return ErrInvalidHeader
+			}
+			timestamp = t
+			found = true
+		case scheme:
+			signature, err := hex.DecodeString(value)
+			if err != nil {
+				return ErrInvalidHeader
+			}
+			signatures = append(signatures, signature)
+		}
+	}
+	if !found || len(signatures) == 0 {
+		return ErrInvalidHeader
+	}
+
+	age := now.Sub(time.Unix(timestamp, 0))
+	if age > tolerance || age < -tolerance {
+		return ErrExpired
+	}
+
+	// Several signatures are accepted so the secret can be changed without refusing notifications on the way
+	expected := compute(secret, body, timestamp)
+	for _, signature := range signatures {
+		if hmac.Equal(expected, signature) {
+			return nil
+		}
+	}
+	return ErrMismatch
+}
+
+// strings.Cut is not available in Go 1.17
+func cut(s, sep string) (before, after string, found bool) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
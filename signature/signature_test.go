@@ -0,0 +1,47 @@
+package signature
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignVerify(t *testing.T) {
+	secret, err := NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, secret, 64)
+
+	body := []byte(`{"webhook_id":"abc","country":"NOR","calls":2}`)
+	at := time.Unix(1700000000, 0)
+	header := Sign(secret, body, at)
+	assert.True(t, strings.HasPrefix(header, "t=1700000000,v1="))
+
+	tests := []struct {
+		description string
+		secret      string
+		body        []byte
+		header      string
+		now         time.Time
+		err         error
+	}{
+		{"Valid", secret, body, header, at.Add(time.Minute), nil},
+		{"Other secret", "another secret", body, header, at, ErrMismatch},
+		{"Changed body", secret, []byte(`{"webhook_id":"abc","country":"SWE","calls":2}`), header, at, ErrMismatch},
+		{"Too old", secret, body, header, at.Add(DEFAULT_TOLERANCE + time.Second), ErrExpired},
+		{"Too far ahead", secret, body, header, at.Add(-DEFAULT_TOLERANCE - time.Second), ErrExpired},
+		{"Empty", secret, body, "", at, ErrInvalidHeader},
+		{"No timestamp", secret, body, strings.SplitN(header, ",", 2)[1], at, ErrInvalidHeader},
+		{"Not hex", secret, body, "t=1700000000,v1=xyz", at, ErrInvalidHeader},
+		{"Rotated secret", secret, body, header + ",v1=" + strings.Repeat("0", 64), at, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			err := verifyAt(test.secret, test.body, test.header, DEFAULT_TOLERANCE, test.now)
+			assert.ErrorIs(t, err, test.err)
+		})
+	}
+}
@@ -0,0 +1,256 @@
+// Package urlpolicy decides which URLs notifications may be sent to, so webhooks can not be used to
+// reach the service itself, cloud metadata endpoints or other hosts on internal networks.
+//
+// URLs are checked when webhooks are registered, and the addresses connected to are checked again
+// when notifications are sent, so a host name can not be pointed at an internal address afterwards.
+package urlpolicy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DEFAULT_SCHEMES Schemes URLs may use when none have been set
+var DEFAULT_SCHEMES = []string{"http", "https"}
+
+// ErrForbidden is returned for URLs and addresses notifications may not be sent to
+var ErrForbidden = errors.New("the URL is not allowed")
+
+// Networks that are not reachable from the internet, or reach the service itself, beyond those the net package knows
+var reservedNetworks = mustParseNetworks(
+	"0.0.0.0/8",     // This network
+	"100.64.0.0/10", // Shared address space (carrier-grade NAT)
+	"192.0.0.0/24",  // IETF protocol assignments
+	"198.18.0.0/15", // Benchmarking
+	"240.0.0.0/4",   // Reserved, and the broadcast address
+	"64:ff9b::/96",  // IPv4 translated to IPv6, may reach any of the above
+)
+
+func mustParseNetworks(cidrs ...string) []*net.IPNet {
+	networks := []*net.IPNet{}
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// Config of a policy
+type Config struct {
+	// Schemes URLs may use, DEFAULT_SCHEMES if empty
+	Schemes []string
+	// Hosts and networks that are allowed even though they are internal, e.g. "hooks.internal", "*.example.com", "10.1.0.0/16" or "10.1.2.3"
+	Allow []string
+	// Hosts and networks that are never allowed, in the same format. They win over Allow.
+	Deny []string
+	// Resolver of host names, net.DefaultResolver if nil
+	Resolver *net.Resolver
+}
+
+// A list of hosts and networks
+type rules struct {
+	// Host names, and suffixes starting with "." for "*.example.com"
+	hosts    []string
+	networks []*net.IPNet
+}
+
+func parseRules(entries []string) (rules, error) {
+	parsed := rules{}
+	for _, entry := range entries {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		switch {
+		case entry == "":
+			continue
+		case strings.Contains(entry, "/"):
+			_, network, err := net.ParseCIDR(entry)
+			if err != nil {
+				return rules{}, err
+			}
+			parsed.networks = append(parsed.networks, network)
+		case net.ParseIP(entry) != nil:
+			ip := net.ParseIP(entry)
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+			parsed.networks = append(parsed.networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+		default:
+			parsed.hosts = append(parsed.hosts, strings.TrimPrefix(entry, "*"))
+		}
+	}
+	return parsed, nil
+}
+
+func (r rules) matchesHost(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for _, rule := range r.hosts {
+		if host == rule || (strings.HasPrefix(rule, ".") && strings.HasSuffix(host, rule)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r rules) matchesIP(ip net.IP) bool {
+	for _, network := range r.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Policy checks URLs and the addresses connected to
+type Policy struct {
+	schemes  []string
+	allow    rules
+	deny     rules
+	resolver *net.Resolver
+	dialer   *net.Dialer
+}
+
+// New creates a policy, failing if a network in the lists is not valid
+func New(config Config) (*Policy, error) {
+	allow, err := parseRules(config.Allow)
+	if err != nil {
+		return nil, fmt.Errorf("invalid allowed network: %w", err)
+	}
+	deny, err := parseRules(config.Deny)
+	if err != nil {
+		return nil, fmt.Errorf("invalid denied network: %w", err)
+	}
+	policy := &Policy{
+		schemes:  DEFAULT_SCHEMES,
+		allow:    allow,
+		deny:     deny,
+		resolver: config.Resolver,
+		dialer:   &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second},
+	}
+	if len(config.Schemes) > 0 {
+		policy.schemes = []string{}
+		for _, scheme := range config.Schemes {
+			policy.schemes = append(policy.schemes, strings.ToLower(strings.TrimSpace(scheme)))
+		}
+	}
+	if policy.resolver == nil {
+		policy.resolver = net.DefaultResolver
+	}
+	return policy, nil
+}
+
+// Internal reports whether an address is not reachable from the internet, or reaches the service itself
+func Internal(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return true
+	}
+	for _, network := range reservedNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckIP returns ErrForbidden for denied and internal addresses that are not allowed
+func (p *Policy) CheckIP(ip net.IP) error {
+	if p.deny.matchesIP(ip) {
+		return fmt.Errorf("%w: the address %s is denied", ErrForbidden, ip)
+	}
+	if !p.allow.matchesIP(ip) && Internal(ip) {
+		return fmt.Errorf("%w: the address %s is internal", ErrForbidden, ip)
+	}
+	return nil
+}
+
+// Check the host of a URL by its name, then the addresses it resolves to unless it is allowed by name
+func (p *Policy) checkHost(ctx context.Context, host string) ([]net.IP, error) {
+	if host == "" {
+		return nil, fmt.Errorf("%w: the URL has no host", ErrForbidden)
+	}
+	if p.deny.matchesHost(host) {
+		return nil, fmt.Errorf("%w: the host %s is denied", ErrForbidden, host)
+	}
+	if p.allow.matchesHost(host) {
+		return nil, nil
+	}
+
+	ips := []net.IP{}
+	if ip := net.ParseIP(host); ip != nil {
+		ips = append(ips, ip)
+	} else {
+		addresses, err := p.resolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		for _, address := range addresses {
+			ips = append(ips, address.IP)
+		}
+	}
+	// Every address has to be allowed, as any of them may be the one connected to
+	for _, ip := range ips {
+		err := p.CheckIP(ip)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ips, nil
+}
+
+// CheckURL returns ErrForbidden if notifications may not be sent to a URL, or an error if its host can not be resolved
+func (p *Policy) CheckURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrForbidden, err.Error())
+	}
+	allowed := false
+	for _, scheme := range p.schemes {
+		allowed = allowed || strings.ToLower(u.Scheme) == scheme
+	}
+	if !allowed {
+		return fmt.Errorf("%w: the scheme has to be one of %s", ErrForbidden, strings.Join(p.schemes, ", "))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err = p.checkHost(ctx, u.Hostname())
+	return err
+}
+
+// DialContext connects to an address only if it is allowed, for the transport of the HTTP client sending notifications.
+// The host is resolved once and the checked address is the one connected to, so it can not change in between.
+func (p *Policy) DialContext(ctx context.Context, network string, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := p.checkHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	// Allowed by name
+	if ips == nil {
+		return p.dialer.DialContext(ctx, network, address)
+	}
+
+	var conn net.Conn
+	for _, ip := range ips {
+		conn, err = p.dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+	}
+	if err == nil {
+		err = fmt.Errorf("no addresses found for %s", host)
+	}
+	return nil, err
+}
@@ -0,0 +1,74 @@
+package urlpolicy
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCheckURL(t *testing.T) {
+	policy, err := New(Config{Allow: []string{"10.1.0.0/16", "hooks.internal"}, Deny: []string{"10.1.2.3", "*.blocked.example"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		url     string
+		allowed bool
+	}{
+		{"https://8.8.8.8/hook", true},
+		{"http://[2001:4860:4860::8888]:8080/hook", true},
+		{"ftp://8.8.8.8/hook", false},
+		{"file:///etc/passwd", false},
+		{"http://127.0.0.1:8080/energy/v1/status/", false},
+		{"http://[::1]/", false},
+		{"http://169.254.169.254/latest/meta-data/", false},
+		{"http://192.168.1.1/", false},
+		{"http://100.64.0.1/", false},
+		{"http://0.0.0.0/", false},
+		{"http://[::ffff:127.0.0.1]/", false},
+		{"http://10.1.9.9/hook", true},
+		{"http://10.1.2.3/hook", false},
+		{"http://10.2.0.1/hook", false},
+		// Allowed and denied by name, without looking them up
+		{"http://hooks.internal/hook", true},
+		{"https://api.blocked.example/hook", false},
+		{"http:///hook", false},
+	}
+
+	for _, test := range tests {
+		err := policy.CheckURL(test.url)
+		if test.allowed {
+			assert.NoError(t, err, test.url)
+		} else {
+			assert.ErrorIs(t, err, ErrForbidden, test.url)
+		}
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	_, err := New(Config{Allow: []string{"10.0.0.0/33"}})
+	assert.Error(t, err)
+}
+
+func TestDialContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	address := strings.TrimPrefix(server.URL, "http://")
+
+	policy, _ := New(Config{})
+	_, err := policy.DialContext(context.Background(), "tcp", address)
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	// The test server can be reached when loopback is allowed
+	policy, _ = New(Config{Allow: []string{"127.0.0.0/8"}})
+	conn, err := policy.DialContext(context.Background(), "tcp", address)
+	if assert.NoError(t, err) {
+		conn.Close()
+	}
+	assert.True(t, Internal(net.ParseIP("fd00::1")))
+}
@@ -0,0 +1,33 @@
+package webhooks
+
+import (
+	"strings"
+	"time"
+)
+
+// Digest is the invocations counted for a webhook that gets digests, since the digest sent to it before
+type Digest struct {
+	WebhookID string `json:"webhook_id"`
+	// When the counting started, when the digest before was taken or the first invocation of the webhook was counted
+	Since time.Time `json:"since"`
+	// When the digest was taken, and the next one started counting. Not set until it is taken.
+	Until time.Time `json:"until,omitempty"`
+	// Invocations of each country (upper-case ISO code)
+	Countries map[string]int `json:"countries"`
+}
+
+// Due reports whether a digest has invocations and started counting at or before a time
+func (d Digest) Due(due time.Time) bool {
+	return len(d.Countries) > 0 && !d.Since.After(due)
+}
+
+// Count an invocation of a country in a digest, starting it at now if it has not started
+func (d *Digest) count(country string, now time.Time) {
+	if d.Since.IsZero() {
+		d.Since = now
+	}
+	if d.Countries == nil {
+		d.Countries = make(map[string]int)
+	}
+	d.Countries[strings.ToUpper(country)]++
+}
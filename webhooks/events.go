@@ -0,0 +1,54 @@
+package webhooks
+
+// Types of the events webhooks can subscribe to
+const EVENT_COUNTRY_INVOKED = "country.invoked"
+const EVENT_THRESHOLD_CROSSED = "threshold.crossed"
+const EVENT_DATASET_RELOADED = "dataset.reloaded"
+const EVENT_WEBHOOK_TEST = "webhook.test"
+
+// EVENT_COUNTRY_DIGEST Type of the digests of the invocations sent to the webhooks of country.invoked that asked for them.
+// It can not be subscribed to itself.
+const EVENT_COUNTRY_DIGEST = "country.digest"
+
+// EventTypes lists the types of events webhooks can subscribe to
+var EventTypes = []string{EVENT_COUNTRY_INVOKED, EVENT_THRESHOLD_CROSSED, EVENT_DATASET_RELOADED, EVENT_WEBHOOK_TEST}
+
+// IsEventType reports whether an event type is one of the EventTypes
+func IsEventType(eventType string) bool {
+	for _, known := range EventTypes {
+		if eventType == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Enveloped reports whether the webhook subscribed to event types, and gets its notifications
+// wrapped in an event. Webhooks registered without event types get the data alone, as before events existed.
+func (w Webhook) Enveloped() bool {
+	return len(w.Events) > 0
+}
+
+// Subscribes reports whether the webhook is to be notified about events of a type.
+// Webhooks without event types get the event of their trigger. Every webhook gets the tests asked for.
+func (w Webhook) Subscribes(eventType string) bool {
+	if eventType == EVENT_WEBHOOK_TEST {
+		return true
+	}
+	if !w.Enveloped() {
+		switch eventType {
+		case EVENT_THRESHOLD_CROSSED:
+			return w.IsThreshold()
+		case EVENT_COUNTRY_INVOKED:
+			return !w.IsThreshold()
+		default:
+			return false
+		}
+	}
+	for _, subscribed := range w.Events {
+		if subscribed == eventType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,21 @@
+package webhooks
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSubscribes(t *testing.T) {
+	calls := Webhook{Calls: 1}
+	threshold := Webhook{Trigger: TRIGGER_THRESHOLD}
+	events := Webhook{Calls: 1, Events: []string{EVENT_COUNTRY_INVOKED, EVENT_DATASET_RELOADED}}
+
+	for _, eventType := range EventTypes {
+		assert.Equal(t, eventType == EVENT_COUNTRY_INVOKED || eventType == EVENT_WEBHOOK_TEST, calls.Subscribes(eventType), eventType)
+		assert.Equal(t, eventType == EVENT_THRESHOLD_CROSSED || eventType == EVENT_WEBHOOK_TEST, threshold.Subscribes(eventType), eventType)
+		assert.Equal(t, eventType != EVENT_THRESHOLD_CROSSED, events.Subscribes(eventType), eventType)
+	}
+	assert.False(t, calls.Enveloped())
+	assert.True(t, events.Enveloped())
+	assert.False(t, IsEventType("country.deleted"))
+}
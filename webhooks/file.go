@@ -0,0 +1,289 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// FILE_SAVE_INTERVAL How often the file store saves the invocations counted since it last saved
+const FILE_SAVE_INTERVAL = time.Second
+
+// FileStore keeps webhooks, invocation counts and digests in memory and writes all of them to a JSON file. Changes to
+// webhooks are written right away. Invocations, counted on every request, are written at most every FILE_SAVE_INTERVAL
+// and when the store is closed, so those counted in the interval before the service stops without closing it are lost.
+type FileStore struct {
+	filename string
+	// Held while changing and saving, so the file always matches the memory
+	mu     sync.Mutex
+	memory *MemoryStore
+	// Whether invocations have been counted since the file was saved
+	dirty bool
+	// Closed to stop saving the invocations, saving is done when done is closed
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Content of the file
+type fileContent struct {
+	Webhooks    []Webhook      `json:"webhooks"`
+	Invocations map[string]int `json:"invocations"`
+	Digests     []Digest       `json:"digests,omitempty"`
+}
+
+// NewFileStore opens the store of a file, the file is created on the first change if it does not exist
+func NewFileStore(filename string) (*FileStore, error) {
+	s := &FileStore{filename: filename, memory: NewMemoryStore(), stop: make(chan struct{}), done: make(chan struct{})}
+
+	content, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		go s.saveEvery(FILE_SAVE_INTERVAL)
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read the webhook file: %w", err)
+	}
+
+	stored := fileContent{}
+	err = json.Unmarshal(content, &stored)
+	if err != nil {
+		// Files written before invocations were counted only have the array of webhooks
+		err = json.Unmarshal(content, &stored.Webhooks)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not decode the webhook file %s: %w", filename, err)
+	}
+	for _, webhook := range stored.Webhooks {
+		s.memory.webhooks[webhook.ID] = webhook
+	}
+	for country, invocations := range stored.Invocations {
+		s.memory.invocations[country] = invocations
+	}
+	for _, digest := range stored.Digests {
+		s.memory.digests[digest.WebhookID] = digest
+	}
+	go s.saveEvery(FILE_SAVE_INTERVAL)
+	return s, nil
+}
+
+// Save the invocations counted since the file was saved at every interval, until the store is closed
+func (s *FileStore) saveEvery(interval time.Duration) {
+	defer close(s.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			err := s.saveCounts()
+			if err != nil {
+				log.Println("E: Failed to save the invocations counted in the webhook file, trying again. Error:", err.Error())
+			}
+		}
+	}
+}
+
+// Save the file if invocations have been counted since it was saved
+func (s *FileStore) saveCounts() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.dirty {
+		return nil
+	}
+	return s.save()
+}
+
+// Write all webhooks to a temporary file and move it in place, so a crash never leaves half a file.
+// The invocations counted are written with them.
+func (s *FileStore) save() error {
+	webhooks, _ := s.memory.List()
+	s.memory.mu.RLock()
+	digests := []Digest{}
+	for _, digest := range s.memory.digests {
+		digests = append(digests, digest)
+	}
+	sort.Slice(digests, func(i, j int) bool { return digests[i].WebhookID < digests[j].WebhookID })
+	content, err := json.MarshalIndent(fileContent{Webhooks: webhooks, Invocations: s.memory.invocations, Digests: digests}, "", "  ")
+	s.memory.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.filename), filepath.Base(s.filename)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("could not write the webhook file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("could not write the webhook file: %w", err)
+	}
+	err = os.Rename(tmp.Name(), s.filename)
+	if err != nil {
+		return err
+	}
+	s.dirty = false
+	return nil
+}
+
+func (s *FileStore) Create(webhook Webhook) (Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	webhook, err := s.memory.Create(webhook)
+	if err != nil {
+		return Webhook{}, err
+	}
+	err = s.save()
+	if err != nil {
+		s.memory.Delete(webhook.ID)
+		return Webhook{}, err
+	}
+	return webhook, nil
+}
+
+func (s *FileStore) Get(id string) (Webhook, error) {
+	return s.memory.Get(id)
+}
+
+func (s *FileStore) List() ([]Webhook, error) {
+	return s.memory.List()
+}
+
+func (s *FileStore) ListByCountry(country string) ([]Webhook, error) {
+	return s.memory.ListByCountry(country)
+}
+
+func (s *FileStore) Page(query Query) (Page, error) {
+	return s.memory.Page(query)
+}
+
+func (s *FileStore) Update(webhook Webhook) (Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, err := s.memory.Get(webhook.ID)
+	if err != nil {
+		return Webhook{}, err
+	}
+	webhook, err = s.memory.Update(webhook)
+	if err != nil {
+		return Webhook{}, err
+	}
+	err = s.save()
+	if err != nil {
+		s.memory.Update(previous)
+		return Webhook{}, err
+	}
+	return webhook, nil
+}
+
+func (s *FileStore) Modify(id string, change func(webhook *Webhook)) (Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, err := s.memory.Get(id)
+	if err != nil {
+		return Webhook{}, err
+	}
+	webhook, err := s.memory.Modify(id, change)
+	if err != nil {
+		return Webhook{}, err
+	}
+	err = s.save()
+	if err != nil {
+		s.memory.Update(previous)
+		return Webhook{}, err
+	}
+	return webhook, nil
+}
+
+func (s *FileStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	webhook, err := s.memory.Get(id)
+	if err != nil {
+		return err
+	}
+	digests := s.memory.copyDigests()
+	s.memory.Delete(id)
+	err = s.save()
+	if err != nil {
+		s.memory.mu.Lock()
+		s.memory.webhooks[id] = webhook
+		s.memory.digests = digests
+		s.memory.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (s *FileStore) Increment(country string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Saved with the next save
+	invocations, _ := s.memory.Increment(country)
+	s.dirty = true
+	return invocations, nil
+}
+
+func (s *FileStore) CountDigest(webhookID string, country string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Saved with the next save
+	err := s.memory.CountDigest(webhookID, country)
+	if err != nil {
+		return err
+	}
+	s.dirty = true
+	return nil
+}
+
+func (s *FileStore) TakeDigests(due time.Time) ([]Digest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	digests := s.memory.copyDigests()
+	taken, _ := s.memory.TakeDigests(due)
+	if len(taken) == 0 {
+		return taken, nil
+	}
+	err := s.save()
+	if err != nil {
+		s.memory.restoreDigests(digests)
+		return nil, err
+	}
+	return taken, nil
+}
+
+// Ping checks that the directory of the file can still be written to
+func (s *FileStore) Ping() error {
+	_, err := os.Stat(filepath.Dir(s.filename))
+	return err
+}
+
+// Close saves the invocations counted since the file was saved, and stops saving them
+func (s *FileStore) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.stop)
+		<-s.done
+	})
+	return s.saveCounts()
+}
@@ -0,0 +1,632 @@
+package webhooks
+
+import (
+	"cloud.google.com/go/firestore"
+	"context"
+	"errors"
+	firebase "firebase.google.com/go"
+	"fmt"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"strings"
+	"time"
+)
+
+// WEBHOOKS_COLLECTION The collection that stores all registered webhooks
+const WEBHOOKS_COLLECTION = "webhooks"
+
+// INVOCATIONS_COLLECTION The collection that stores the number of invocations of each country
+const INVOCATIONS_COLLECTION = "invocations"
+
+// DIGESTS_COLLECTION The collection that stores the digests of the webhooks that get them, by webhook ID
+const DIGESTS_COLLECTION = "digests"
+
+// ALL_COUNTRIES_COLLECTION The collection that stores the webhooks not registered to any country
+const ALL_COUNTRIES_COLLECTION = "all-countries"
+
+// FirestoreStore keeps webhooks in Firestore. Every webhook is in the webhooks collection,
+// and also in the collection of its country (or the all-countries collection) for invocations.
+type FirestoreStore struct {
+	ctx    context.Context
+	client *firestore.Client
+}
+
+// Document of a webhook, the field names are the ones used since the first version
+type firestoreWebhook struct {
+	URL       string    `firestore:"URL"`
+	Country   string    `firestore:"Country"`
+	Calls     int64     `firestore:"Calls"`
+	Secret    string    `firestore:"Secret,omitempty"`
+	Trigger   string    `firestore:"Trigger,omitempty"`
+	Indicator string    `firestore:"Indicator,omitempty"`
+	Condition string    `firestore:"Condition,omitempty"`
+	Threshold float64   `firestore:"Threshold,omitempty"`
+	Met       bool      `firestore:"Met,omitempty"`
+	Events    []string  `firestore:"Events,omitempty"`
+	Digest    bool      `firestore:"Digest,omitempty"`
+	Verified  bool      `firestore:"Verified,omitempty"`
+	Owner     string    `firestore:"Owner,omitempty"`
+	Status    string    `firestore:"Status,omitempty"`
+	Failures  int       `firestore:"Failures,omitempty"`
+	Disabled  *Disabled `firestore:"Disabled,omitempty"`
+	Created   time.Time `firestore:"Created,omitempty"`
+}
+
+// NewFirestoreStore connects to Firestore with the credentials file of a service account
+func NewFirestoreStore(credentials string) (*FirestoreStore, error) {
+	ctx := context.Background()
+
+	app, err := firebase.NewApp(ctx, nil, option.WithCredentialsFile(credentials))
+	if err != nil {
+		return nil, fmt.Errorf("could not initialize Firebase: %w", err)
+	}
+
+	client, err := app.Firestore(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to Firestore: %w", err)
+	}
+
+	return &FirestoreStore{ctx: ctx, client: client}, nil
+}
+
+// The collection a webhook is stored in besides the webhooks collection
+func countryCollection(country string) string {
+	if country == "" {
+		return ALL_COUNTRIES_COLLECTION
+	}
+	return strings.ToUpper(country)
+}
+
+func fromDocument(doc *firestore.DocumentSnapshot) (Webhook, error) {
+	data := firestoreWebhook{}
+	err := doc.DataTo(&data)
+	if err != nil {
+		return Webhook{}, err
+	}
+	// Webhooks registered by the first versions were not given a creation time
+	if data.Created.IsZero() {
+		data.Created = doc.CreateTime.UTC()
+	}
+	return Webhook{
+		ID:        doc.Ref.ID,
+		URL:       data.URL,
+		Country:   data.Country,
+		Calls:     int(data.Calls),
+		Secret:    data.Secret,
+		Trigger:   data.Trigger,
+		Indicator: data.Indicator,
+		Condition: data.Condition,
+		Threshold: data.Threshold,
+		Met:       data.Met,
+		Events:    data.Events,
+		Digest:    data.Digest,
+		Verified:  data.Verified,
+		Owner:     data.Owner,
+		Status:    data.Status,
+		Failures:  data.Failures,
+		Disabled:  data.Disabled,
+		Created:   data.Created,
+	}, nil
+}
+
+func toDocument(webhook Webhook) firestoreWebhook {
+	return firestoreWebhook{
+		URL:       webhook.URL,
+		Country:   webhook.Country,
+		Calls:     int64(webhook.Calls),
+		Secret:    webhook.Secret,
+		Trigger:   webhook.Trigger,
+		Indicator: webhook.Indicator,
+		Condition: webhook.Condition,
+		Threshold: webhook.Threshold,
+		Met:       webhook.Met,
+		Events:    webhook.Events,
+		Digest:    webhook.Digest,
+		Verified:  webhook.Verified,
+		Owner:     webhook.Owner,
+		Status:    webhook.Status,
+		Failures:  webhook.Failures,
+		Disabled:  webhook.Disabled,
+		Created:   webhook.Created,
+	}
+}
+
+func (s *FirestoreStore) Create(webhook Webhook) (Webhook, error) {
+	webhook.Country = strings.ToUpper(webhook.Country)
+	webhook.Created = time.Now().UTC()
+	data := toDocument(webhook)
+
+	// Add the webhook to the 'webhooks' collection which has all registered webhooks, and to the collection
+	// of its country (or the 'all' collection if it is not registered to one), both or neither
+	ref := s.client.Collection(WEBHOOKS_COLLECTION).NewDoc()
+	err := s.client.RunTransaction(s.ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		err := tx.Create(ref, data)
+		if err != nil {
+			return err
+		}
+		return tx.Create(s.client.Collection(countryCollection(webhook.Country)).Doc(ref.ID), data)
+	})
+	if err != nil {
+		return Webhook{}, fmt.Errorf("could not add the webhook: %w", err)
+	}
+	webhook.ID = ref.ID
+	return webhook, nil
+}
+
+func (s *FirestoreStore) Get(id string) (Webhook, error) {
+	doc, err := s.client.Collection(WEBHOOKS_COLLECTION).Doc(id).Get(s.ctx)
+	if status.Code(err) == codes.NotFound {
+		return Webhook{}, ErrNotFound
+	}
+	if err != nil {
+		return Webhook{}, err
+	}
+	return fromDocument(doc)
+}
+
+// Read all webhooks of a collection
+func (s *FirestoreStore) list(collection string) ([]Webhook, error) {
+	iter := s.client.Collection(collection).Documents(s.ctx)
+	defer iter.Stop()
+
+	webhooks := []Webhook{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not read the %s collection: %w", collection, err)
+		}
+		webhook, err := fromDocument(doc)
+		if err != nil {
+			return nil, fmt.Errorf("could not read the webhook %s: %w", doc.Ref.ID, err)
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	sortWebhooks(webhooks)
+	return webhooks, nil
+}
+
+func (s *FirestoreStore) List() ([]Webhook, error) {
+	return s.list(WEBHOOKS_COLLECTION)
+}
+
+func (s *FirestoreStore) ListByCountry(country string) ([]Webhook, error) {
+	return s.list(countryCollection(country))
+}
+
+// Page reads the webhooks collection in the order of the query from the cursor on, filtering the documents as they
+// are read so no composite index is needed. Only webhooks with a creation time are found, see Reconcile.
+func (s *FirestoreStore) Page(query Query) (Page, error) {
+	direction := firestore.Asc
+	if query.Descending {
+		direction = firestore.Desc
+	}
+	ordered := s.client.Collection(WEBHOOKS_COLLECTION).OrderBy("Created", direction).OrderBy(firestore.DocumentID, direction)
+	if query.Cursor != "" {
+		position, err := decodeCursor(query.Cursor)
+		if err != nil {
+			return Page{}, err
+		}
+		ordered = ordered.StartAfter(position.Created, position.ID)
+	}
+
+	iter := ordered.Documents(s.ctx)
+	defer iter.Stop()
+
+	p := pager{query: query, page: Page{Webhooks: []Webhook{}}}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return Page{}, fmt.Errorf("could not read the %s collection: %w", WEBHOOKS_COLLECTION, err)
+		}
+		webhook, err := fromDocument(doc)
+		if err != nil {
+			return Page{}, fmt.Errorf("could not read the webhook %s: %w", doc.Ref.ID, err)
+		}
+		if p.add(webhook) {
+			break
+		}
+	}
+	return p.page, nil
+}
+
+func (s *FirestoreStore) Update(webhook Webhook) (Webhook, error) {
+	return s.Modify(webhook.ID, func(stored *Webhook) {
+		created := stored.Created
+		*stored = webhook
+		stored.Created = created
+	})
+}
+
+func (s *FirestoreStore) Modify(id string, change func(webhook *Webhook)) (Webhook, error) {
+	// Read and update both copies in a transaction, moving the copy to the collection of the new country if it has
+	// changed. The transaction is retried, calling change again, if the webhook is changed before it is committed.
+	ref := s.client.Collection(WEBHOOKS_COLLECTION).Doc(id)
+	webhook := Webhook{}
+	err := s.client.RunTransaction(s.ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if status.Code(err) == codes.NotFound {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		stored, err := fromDocument(doc)
+		if err != nil {
+			return err
+		}
+		webhook = stored
+		change(&webhook)
+		webhook.ID = id
+		webhook.Country = strings.ToUpper(webhook.Country)
+		webhook.Created = stored.Created
+
+		data := toDocument(webhook)
+		if countryCollection(stored.Country) != countryCollection(webhook.Country) {
+			err = tx.Delete(s.client.Collection(countryCollection(stored.Country)).Doc(webhook.ID))
+			if err != nil {
+				return err
+			}
+		}
+		err = tx.Set(s.client.Collection(countryCollection(webhook.Country)).Doc(webhook.ID), data)
+		if err != nil {
+			return err
+		}
+		return tx.Set(ref, data)
+	})
+	if errors.Is(err, ErrNotFound) {
+		return Webhook{}, ErrNotFound
+	}
+	if err != nil {
+		return Webhook{}, fmt.Errorf("could not update the webhook: %w", err)
+	}
+	return webhook, nil
+}
+
+func (s *FirestoreStore) Delete(id string) error {
+	// Delete the webhook from the 'webhooks' collection and the collection of its country, both or neither
+	ref := s.client.Collection(WEBHOOKS_COLLECTION).Doc(id)
+	err := s.client.RunTransaction(s.ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if status.Code(err) == codes.NotFound {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		webhook, err := fromDocument(doc)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Delete(s.client.Collection(countryCollection(webhook.Country)).Doc(id))
+		if err != nil {
+			return err
+		}
+		err = tx.Delete(s.client.Collection(DIGESTS_COLLECTION).Doc(id))
+		if err != nil {
+			return err
+		}
+		return tx.Delete(ref)
+	})
+	if errors.Is(err, ErrNotFound) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("could not delete the webhook: %w", err)
+	}
+	return nil
+}
+
+// Reconcile repairs webhooks left in only one of their collections, by webhooks written before
+// registration and deletion were transactional, or by changes made to the database by hand.
+// The 'webhooks' collection is taken as the truth. Webhooks without a creation time are given one.
+func (s *FirestoreStore) Reconcile() (Repairs, error) {
+	// Find where webhooks have been placed, in every collection that can hold the webhooks of a country.
+	// This is read before the registered webhooks, so a webhook registered in between is found registered
+	// without its copy rather than as a copy without a webhook.
+	placed := make(map[string][]string)
+	collections := s.client.Collections(s.ctx)
+	for {
+		collection, err := collections.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return Repairs{}, fmt.Errorf("could not list the collections: %w", err)
+		}
+		if !isCountryCollection(collection.ID) {
+			continue
+		}
+
+		refs, err := collection.DocumentRefs(s.ctx).GetAll()
+		if err != nil {
+			return Repairs{}, fmt.Errorf("could not read the %s collection: %w", collection.ID, err)
+		}
+		for _, ref := range refs {
+			placed[collection.ID] = append(placed[collection.ID], ref.ID)
+		}
+	}
+
+	registered, err := s.List()
+	if err != nil {
+		return Repairs{}, err
+	}
+
+	// Webhooks may have been registered, changed or deleted since they were read, so every repair
+	// is checked again in the transaction making it, and only those still needed are made
+	planned := planRepairs(registered, placed)
+	repairs := Repairs{}
+	for _, webhook := range planned.Restored {
+		restored, err := s.restore(webhook.ID)
+		if err != nil {
+			return repairs, fmt.Errorf("could not restore the webhook %s: %w", webhook.ID, err)
+		}
+		if restored != nil {
+			repairs.Restored = append(repairs.Restored, *restored)
+		}
+	}
+	for _, orphan := range planned.Removed {
+		removed, err := s.remove(orphan)
+		if err != nil {
+			return repairs, fmt.Errorf("could not remove the orphaned webhook %s: %w", orphan.ID, err)
+		}
+		if removed {
+			repairs.Removed = append(repairs.Removed, orphan)
+		}
+	}
+
+	repairs.Dated, err = s.date()
+	return repairs, err
+}
+
+// Copy a registered webhook to the collection of its country if it is still registered and not there,
+// and return the webhook copied, nil if nothing had to be done
+func (s *FirestoreStore) restore(id string) (*Webhook, error) {
+	var restored *Webhook
+	err := s.client.RunTransaction(s.ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		restored = nil
+		doc, err := tx.Get(s.client.Collection(WEBHOOKS_COLLECTION).Doc(id))
+		if status.Code(err) == codes.NotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		webhook, err := fromDocument(doc)
+		if err != nil {
+			return err
+		}
+
+		ref := s.client.Collection(countryCollection(webhook.Country)).Doc(id)
+		_, err = tx.Get(ref)
+		if err == nil {
+			return nil
+		}
+		if status.Code(err) != codes.NotFound {
+			return err
+		}
+		restored = &webhook
+		return tx.Set(ref, toDocument(webhook))
+	})
+	return restored, err
+}
+
+// Delete a copy of a webhook if it is still not registered, or registered to another country, and report whether it was
+func (s *FirestoreStore) remove(orphan Placement) (bool, error) {
+	removed := false
+	err := s.client.RunTransaction(s.ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		removed = false
+		doc, err := tx.Get(s.client.Collection(WEBHOOKS_COLLECTION).Doc(orphan.ID))
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if err == nil {
+			webhook, err := fromDocument(doc)
+			if err != nil {
+				return err
+			}
+			if countryCollection(webhook.Country) == orphan.Collection {
+				return nil
+			}
+		}
+		removed = true
+		return tx.Delete(s.client.Collection(orphan.Collection).Doc(orphan.ID))
+	})
+	return removed, err
+}
+
+// Give the webhooks registered before they had a creation time the time their document was created,
+// as documents without the field are left out of the pages sorted by it
+func (s *FirestoreStore) date() ([]string, error) {
+	iter := s.client.Collection(WEBHOOKS_COLLECTION).Documents(s.ctx)
+	defer iter.Stop()
+
+	dated := []string{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return dated, fmt.Errorf("could not read the %s collection: %w", WEBHOOKS_COLLECTION, err)
+		}
+		if _, ok := doc.Data()["Created"]; ok {
+			continue
+		}
+		webhook, err := fromDocument(doc)
+		if err != nil {
+			return dated, fmt.Errorf("could not read the webhook %s: %w", doc.Ref.ID, err)
+		}
+
+		created := []firestore.Update{{Path: "Created", Value: webhook.Created}}
+		batch := s.client.Batch()
+		batch.Update(doc.Ref, created)
+		batch.Update(s.client.Collection(countryCollection(webhook.Country)).Doc(webhook.ID), created)
+		_, err = batch.Commit(s.ctx)
+		if err != nil {
+			return dated, fmt.Errorf("could not date the webhook %s: %w", webhook.ID, err)
+		}
+		dated = append(dated, webhook.ID)
+	}
+	return dated, nil
+}
+
+// Document of the invocations of a country
+type firestoreInvocations struct {
+	Calls int64 `firestore:"Calls"`
+}
+
+// Increment counts in a transaction, so instances invoking the same country at once each get their own number
+func (s *FirestoreStore) Increment(country string) (int, error) {
+	ref := s.client.Collection(INVOCATIONS_COLLECTION).Doc(strings.ToUpper(country))
+	invocations := firestoreInvocations{}
+	err := s.client.RunTransaction(s.ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		invocations = firestoreInvocations{}
+		doc, err := tx.Get(ref)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if err == nil {
+			err = doc.DataTo(&invocations)
+			if err != nil {
+				return err
+			}
+		}
+		invocations.Calls++
+		return tx.Set(ref, invocations)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("could not count the invocation of %s: %w", country, err)
+	}
+	return int(invocations.Calls), nil
+}
+
+// Document of the digest of a webhook
+type firestoreDigest struct {
+	Since     time.Time        `firestore:"Since"`
+	Countries map[string]int64 `firestore:"Countries"`
+}
+
+func fromDigestDocument(doc *firestore.DocumentSnapshot) (Digest, error) {
+	stored := firestoreDigest{}
+	err := doc.DataTo(&stored)
+	if err != nil {
+		return Digest{}, err
+	}
+	digest := Digest{WebhookID: doc.Ref.ID, Since: stored.Since, Countries: make(map[string]int)}
+	for country, invocations := range stored.Countries {
+		digest.Countries[country] = int(invocations)
+	}
+	return digest, nil
+}
+
+func toDigestDocument(digest Digest) firestoreDigest {
+	stored := firestoreDigest{Since: digest.Since, Countries: make(map[string]int64)}
+	for country, invocations := range digest.Countries {
+		stored.Countries[country] = int64(invocations)
+	}
+	return stored
+}
+
+func (s *FirestoreStore) CountDigest(webhookID string, country string) error {
+	webhookRef := s.client.Collection(WEBHOOKS_COLLECTION).Doc(webhookID)
+	ref := s.client.Collection(DIGESTS_COLLECTION).Doc(webhookID)
+	err := s.client.RunTransaction(s.ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		// Not counted for a webhook deleted in the meantime, as the digest would never be deleted
+		_, err := tx.Get(webhookRef)
+		if status.Code(err) == codes.NotFound {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		digest := Digest{WebhookID: webhookID}
+		doc, err := tx.Get(ref)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if err == nil {
+			digest, err = fromDigestDocument(doc)
+			if err != nil {
+				return err
+			}
+		}
+		digest.count(country, time.Now().UTC())
+		return tx.Set(ref, toDigestDocument(digest))
+	})
+	if errors.Is(err, ErrNotFound) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("could not count the invocation of %s for the digest of %s: %w", country, webhookID, err)
+	}
+	return nil
+}
+
+func (s *FirestoreStore) TakeDigests(due time.Time) ([]Digest, error) {
+	iter := s.client.Collection(DIGESTS_COLLECTION).Where("Since", "<=", due).Documents(s.ctx)
+	defer iter.Stop()
+
+	digests := []Digest{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return digests, fmt.Errorf("could not list the digests: %w", err)
+		}
+
+		// Read again in a transaction, so a digest taken by another instance in the meantime is not taken twice
+		taken := (*Digest)(nil)
+		err = s.client.RunTransaction(s.ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+			taken = nil
+			current, err := tx.Get(doc.Ref)
+			if status.Code(err) == codes.NotFound {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			digest, err := fromDigestDocument(current)
+			if err != nil {
+				return err
+			}
+			if !digest.Due(due) {
+				return nil
+			}
+			digest.Until = time.Now().UTC()
+			taken = &digest
+			return tx.Set(doc.Ref, toDigestDocument(Digest{Since: digest.Until}))
+		})
+		if err != nil {
+			return digests, fmt.Errorf("could not take the digest of %s: %w", doc.Ref.ID, err)
+		}
+		if taken != nil {
+			digests = append(digests, *taken)
+		}
+	}
+	return digests, nil
+}
+
+// Ping lists the collections, which fails if the database can not be reached
+func (s *FirestoreStore) Ping() error {
+	_, err := s.client.Collections(s.ctx).Next()
+	if err == iterator.Done {
+		return nil
+	}
+	return err
+}
+
+func (s *FirestoreStore) Close() error {
+	return s.client.Close()
+}
@@ -0,0 +1,191 @@
+package webhooks
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps webhooks in memory, they are lost when the service stops
+type MemoryStore struct {
+	mu       sync.RWMutex
+	webhooks map[string]Webhook
+	// Invocations of each country (upper-case ISO code)
+	invocations map[string]int
+	// Digests of the webhooks that get them, by webhook ID
+	digests map[string]Digest
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{webhooks: make(map[string]Webhook), invocations: make(map[string]int), digests: make(map[string]Digest)}
+}
+
+func (s *MemoryStore) Create(webhook Webhook) (Webhook, error) {
+	id, err := newID()
+	if err != nil {
+		return Webhook{}, err
+	}
+	webhook.ID = id
+	webhook.Country = strings.ToUpper(webhook.Country)
+	webhook.Created = time.Now().UTC()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.webhooks[webhook.ID] = webhook
+	return webhook, nil
+}
+
+func (s *MemoryStore) Get(id string) (Webhook, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	webhook, ok := s.webhooks[id]
+	if !ok {
+		return Webhook{}, ErrNotFound
+	}
+	return webhook, nil
+}
+
+func (s *MemoryStore) List() ([]Webhook, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	webhooks := []Webhook{}
+	for _, webhook := range s.webhooks {
+		webhooks = append(webhooks, webhook)
+	}
+	sortWebhooks(webhooks)
+	return webhooks, nil
+}
+
+func (s *MemoryStore) ListByCountry(country string) ([]Webhook, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	webhooks := []Webhook{}
+	for _, webhook := range s.webhooks {
+		if strings.EqualFold(webhook.Country, country) {
+			webhooks = append(webhooks, webhook)
+		}
+	}
+	sortWebhooks(webhooks)
+	return webhooks, nil
+}
+
+func (s *MemoryStore) Page(query Query) (Page, error) {
+	webhooks, _ := s.List()
+	return pageOf(webhooks, query)
+}
+
+func (s *MemoryStore) Update(webhook Webhook) (Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.webhooks[webhook.ID]
+	if !ok {
+		return Webhook{}, ErrNotFound
+	}
+	webhook.Country = strings.ToUpper(webhook.Country)
+	webhook.Created = stored.Created
+	s.webhooks[webhook.ID] = webhook
+	return webhook, nil
+}
+
+func (s *MemoryStore) Modify(id string, change func(webhook *Webhook)) (Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	webhook, ok := s.webhooks[id]
+	if !ok {
+		return Webhook{}, ErrNotFound
+	}
+	change(&webhook)
+	webhook.ID = id
+	webhook.Country = strings.ToUpper(webhook.Country)
+	webhook.Created = s.webhooks[id].Created
+	s.webhooks[id] = webhook
+	return webhook, nil
+}
+
+func (s *MemoryStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.webhooks[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.webhooks, id)
+	delete(s.digests, id)
+	return nil
+}
+
+func (s *MemoryStore) Increment(country string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	country = strings.ToUpper(country)
+	s.invocations[country]++
+	return s.invocations[country], nil
+}
+
+func (s *MemoryStore) CountDigest(webhookID string, country string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.webhooks[webhookID]; !ok {
+		return ErrNotFound
+	}
+	digest := s.digests[webhookID]
+	digest.WebhookID = webhookID
+	digest.count(country, time.Now().UTC())
+	s.digests[webhookID] = digest
+	return nil
+}
+
+func (s *MemoryStore) TakeDigests(due time.Time) ([]Digest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	digests := []Digest{}
+	for id, digest := range s.digests {
+		if !digest.Due(due) {
+			continue
+		}
+		digest.Until = now
+		digests = append(digests, digest)
+		s.digests[id] = Digest{WebhookID: id, Since: now}
+	}
+	return digests, nil
+}
+
+// Copy of the digests, to put back with restoreDigests when a change can not be saved
+func (s *MemoryStore) copyDigests() map[string]Digest {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	digests := make(map[string]Digest, len(s.digests))
+	for id, digest := range s.digests {
+		countries := make(map[string]int, len(digest.Countries))
+		for country, invocations := range digest.Countries {
+			countries[country] = invocations
+		}
+		digest.Countries = countries
+		digests[id] = digest
+	}
+	return digests
+}
+
+func (s *MemoryStore) restoreDigests(digests map[string]Digest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.digests = digests
+}
+
+func (s *MemoryStore) Ping() error {
+	return nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
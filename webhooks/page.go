@@ -0,0 +1,141 @@
+package webhooks
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCursor is returned when the cursor of a query was not made by a page
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Query selects a page of the webhooks, sorted by creation time and by ID when created at the same time
+type Query struct {
+	// Only the webhooks of this owner, of any owner if nil
+	Owner *string
+	// Only the webhooks registered to this country, or to any country if it is empty. Of every country if nil.
+	Country *string
+	// Only the webhooks whose URL has this host name, of any host if empty
+	Host string
+	// Only the webhooks with this status, one of the STATUS_ constants, or with any status if empty
+	Status string
+	// Newest first instead of oldest first
+	Descending bool
+	// Where the page starts, the Next of the page before. The first page if empty.
+	Cursor string
+	// Highest number of webhooks in the page, all of them if 0
+	Limit int
+}
+
+// Page is a part of the webhooks selected by a query
+type Page struct {
+	Webhooks []Webhook
+	// Cursor of the next page, empty if this is the last one
+	Next string
+}
+
+// Position of a webhook in the sort order, encoded in cursors
+type cursor struct {
+	Created time.Time `json:"c"`
+	ID      string    `json:"i"`
+}
+
+func encodeCursor(webhook Webhook) string {
+	content, _ := json.Marshal(cursor{Created: webhook.Created, ID: webhook.ID})
+	return base64.RawURLEncoding.EncodeToString(content)
+}
+
+func decodeCursor(encoded string) (cursor, error) {
+	position := cursor{}
+	content, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err == nil {
+		err = json.Unmarshal(content, &position)
+	}
+	if err != nil || position.ID == "" {
+		return cursor{}, ErrInvalidCursor
+	}
+	return position, nil
+}
+
+// Whether a webhook comes after the position in the order of the query
+func (c cursor) followedBy(webhook Webhook, descending bool) bool {
+	if !webhook.Created.Equal(c.Created) {
+		return webhook.Created.After(c.Created) != descending
+	}
+	if webhook.ID == c.ID {
+		return false
+	}
+	return (webhook.ID > c.ID) != descending
+}
+
+// Matches reports whether a webhook passes the filters of the query
+func (q Query) Matches(webhook Webhook) bool {
+	if q.Owner != nil && webhook.Owner != *q.Owner {
+		return false
+	}
+	if q.Country != nil && !strings.EqualFold(webhook.Country, *q.Country) {
+		return false
+	}
+	if q.Host != "" {
+		parsed, err := url.Parse(webhook.URL)
+		if err != nil || !strings.EqualFold(parsed.Hostname(), q.Host) {
+			return false
+		}
+	}
+	if q.Status != "" && webhook.Status != q.Status && !(q.Status == STATUS_ACTIVE && webhook.Active()) {
+		return false
+	}
+	return true
+}
+
+// Collects the webhooks of a page as they are read in the order of the query
+type pager struct {
+	query Query
+	page  Page
+	last  Webhook
+}
+
+// Add a webhook read after the cursor, and report whether the page is full.
+// The page is only known to have a next one when a matching webhook is read after it is full.
+func (p *pager) add(webhook Webhook) bool {
+	if !p.query.Matches(webhook) {
+		return false
+	}
+	if p.query.Limit > 0 && len(p.page.Webhooks) == p.query.Limit {
+		p.page.Next = encodeCursor(p.last)
+		return true
+	}
+	p.page.Webhooks = append(p.page.Webhooks, webhook)
+	p.last = webhook
+	return false
+}
+
+// Page through webhooks already sorted oldest first
+func pageOf(webhooks []Webhook, query Query) (Page, error) {
+	var position *cursor
+	if query.Cursor != "" {
+		decoded, err := decodeCursor(query.Cursor)
+		if err != nil {
+			return Page{}, err
+		}
+		position = &decoded
+	}
+
+	p := pager{query: query, page: Page{Webhooks: []Webhook{}}}
+	for i := range webhooks {
+		webhook := webhooks[i]
+		if query.Descending {
+			webhook = webhooks[len(webhooks)-1-i]
+		}
+		if position != nil && !position.followedBy(webhook, query.Descending) {
+			continue
+		}
+		if p.add(webhook) {
+			break
+		}
+	}
+	return p.page, nil
+}
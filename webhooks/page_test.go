@@ -0,0 +1,74 @@
+package webhooks
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestPageOf(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	owner := "team-a"
+	// Two of them were created at the same time
+	webhooks := []Webhook{
+		{ID: "a", URL: "http://example.com/a", Country: "NOR", Owner: owner, Created: start},
+		{ID: "b", URL: "http://example.com/b", Country: "NOR", Created: start.Add(time.Second)},
+		{ID: "c", URL: "http://example.com/c", Owner: owner, Status: STATUS_PAUSED, Created: start.Add(time.Second)},
+		{ID: "d", URL: "https://other.example.com/d", Country: "SWE", Owner: owner, Created: start.Add(2 * time.Second)},
+	}
+	ids := func(page Page) []string {
+		listed := []string{}
+		for _, webhook := range page.Webhooks {
+			listed = append(listed, webhook.ID)
+		}
+		return listed
+	}
+
+	for descending, expected := range map[bool][]string{false: {"a", "b", "c", "d"}, true: {"d", "c", "b", "a"}} {
+		listed := []string{}
+		query := Query{Descending: descending, Limit: 3}
+		for {
+			page, err := pageOf(webhooks, query)
+			assert.NoError(t, err)
+			listed = append(listed, ids(page)...)
+			if page.Next == "" {
+				break
+			}
+			query.Cursor = page.Next
+		}
+		assert.Equal(t, expected, listed)
+	}
+
+	empty := ""
+	nor := "nor"
+	tests := []struct {
+		description string
+		query       Query
+		expected    []string
+	}{
+		{"Every webhook", Query{}, []string{"a", "b", "c", "d"}},
+		{"Of an owner", Query{Owner: &owner}, []string{"a", "c", "d"}},
+		{"Without an owner", Query{Owner: &empty}, []string{"b"}},
+		{"Of a country", Query{Country: &nor}, []string{"a", "b"}},
+		{"Of any country", Query{Country: &empty}, []string{"c"}},
+		{"Of a host", Query{Host: "OTHER.example.com"}, []string{"d"}},
+		{"Active", Query{Status: STATUS_ACTIVE}, []string{"a", "b", "d"}},
+		{"Paused", Query{Status: STATUS_PAUSED, Owner: &owner}, []string{"c"}},
+	}
+	for _, test := range tests {
+		page, err := pageOf(webhooks, test.query)
+		assert.NoError(t, err, test.description)
+		assert.Equal(t, test.expected, ids(page), test.description)
+		assert.Empty(t, page.Next, test.description)
+	}
+
+	// The last page is only known to be the last one when nothing after it matches
+	page, _ := pageOf(webhooks, Query{Owner: &owner, Limit: 2})
+	assert.Equal(t, []string{"a", "c"}, ids(page))
+	page, _ = pageOf(webhooks, Query{Owner: &owner, Limit: 2, Cursor: page.Next})
+	assert.Equal(t, []string{"d"}, ids(page))
+	assert.Empty(t, page.Next)
+
+	_, err := pageOf(webhooks, Query{Cursor: "not a cursor"})
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
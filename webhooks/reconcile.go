@@ -0,0 +1,98 @@
+package webhooks
+
+import (
+	"log"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// Reconciler is implemented by stores that keep a webhook in more than one place,
+// and can repair webhooks found in only some of them
+type Reconciler interface {
+	Reconcile() (Repairs, error)
+}
+
+// Placement is where a copy of a webhook was found
+type Placement struct {
+	Collection string
+	ID         string
+}
+
+// Repairs made by a reconciliation
+type Repairs struct {
+	// Webhooks that were missing from the collection of their country
+	Restored []Webhook
+	// Copies without a registered webhook, or in the collection of another country
+	Removed []Placement
+	// IDs of the webhooks given the creation time of their document, as they were registered without one
+	Dated []string
+}
+
+// Empty reports whether nothing had to be repaired
+func (r Repairs) Empty() bool {
+	return len(r.Restored) == 0 && len(r.Removed) == 0 && len(r.Dated) == 0
+}
+
+// Collections holding the webhooks of a country are named by its code, or ALL_COUNTRIES_COLLECTION
+var countryCollectionPattern = regexp.MustCompile(`^[A-Z]{2,3}$`)
+
+func isCountryCollection(name string) bool {
+	return name == ALL_COUNTRIES_COLLECTION || countryCollectionPattern.MatchString(name)
+}
+
+// Compare the registered webhooks with the IDs found in each country collection
+func planRepairs(registered []Webhook, placed map[string][]string) Repairs {
+	repairs := Repairs{}
+
+	found := make(map[Placement]bool)
+	for collection, ids := range placed {
+		for _, id := range ids {
+			found[Placement{Collection: collection, ID: id}] = true
+		}
+	}
+
+	expected := make(map[Placement]bool)
+	for _, webhook := range registered {
+		placement := Placement{Collection: countryCollection(webhook.Country), ID: webhook.ID}
+		expected[placement] = true
+		if !found[placement] {
+			repairs.Restored = append(repairs.Restored, webhook)
+		}
+	}
+
+	for placement := range found {
+		if !expected[placement] {
+			repairs.Removed = append(repairs.Removed, placement)
+		}
+	}
+	sort.Slice(repairs.Removed, func(i, j int) bool {
+		if repairs.Removed[i].Collection != repairs.Removed[j].Collection {
+			return repairs.Removed[i].Collection < repairs.Removed[j].Collection
+		}
+		return repairs.Removed[i].ID < repairs.Removed[j].ID
+	})
+	return repairs
+}
+
+// ReconcileEvery reconciles the store right away and then at every interval, until stop is closed
+func ReconcileEvery(r Reconciler, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		repairs, err := r.Reconcile()
+		if err != nil {
+			log.Println("E: Failed to reconcile the webhooks. Error:", err.Error())
+		} else if !repairs.Empty() {
+			log.Printf("Reconciled the webhooks, restored %d, removed %d orphaned copies and dated %d\n",
+				len(repairs.Restored), len(repairs.Removed), len(repairs.Dated))
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package webhooks
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPlanRepairs(t *testing.T) {
+	norway := Webhook{ID: "a", URL: "http://example.com/a", Country: "NOR", Calls: 1}
+	all := Webhook{ID: "b", URL: "http://example.com/b", Calls: 1}
+	sweden := Webhook{ID: "c", URL: "http://example.com/c", Country: "SWE", Calls: 1}
+
+	repairs := planRepairs([]Webhook{norway, all, sweden}, map[string][]string{
+		"NOR":                    {"a", "d"},
+		ALL_COUNTRIES_COLLECTION: {"b", "c"},
+	})
+
+	assert.Equal(t, []Webhook{sweden}, repairs.Restored)
+	assert.Equal(t, []Placement{{"NOR", "d"}, {ALL_COUNTRIES_COLLECTION, "c"}}, repairs.Removed)
+
+	repairs = planRepairs([]Webhook{norway, all}, map[string][]string{
+		"NOR":                    {"a"},
+		ALL_COUNTRIES_COLLECTION: {"b"},
+	})
+	assert.True(t, repairs.Empty())
+}
+
+func TestIsCountryCollection(t *testing.T) {
+	assert.True(t, isCountryCollection("NOR"))
+	assert.True(t, isCountryCollection("NO"))
+	assert.True(t, isCountryCollection(ALL_COUNTRIES_COLLECTION))
+	assert.False(t, isCountryCollection(WEBHOOKS_COLLECTION))
+	assert.False(t, isCountryCollection("nor"))
+}
@@ -0,0 +1,50 @@
+package webhooks
+
+import "time"
+
+// States of a webhook, only active webhooks are notified
+const STATUS_ACTIVE = "active"
+const STATUS_PAUSED = "paused"
+const STATUS_DISABLED = "disabled"
+
+// Statuses lists the states a webhook can be in
+var Statuses = []string{STATUS_ACTIVE, STATUS_PAUSED, STATUS_DISABLED}
+
+// IsStatus reports whether a status is one of the Statuses
+func IsStatus(status string) bool {
+	for _, known := range Statuses {
+		if status == known {
+			return true
+		}
+	}
+	return false
+}
+
+// EVENT_WEBHOOK_DISABLED Type of the record kept on a webhook that was disabled. It is not sent to the webhook, as its receiver is failing.
+const EVENT_WEBHOOK_DISABLED = "webhook.disabled"
+
+// Disabled records why a webhook was disabled
+type Disabled struct {
+	Event    string    `json:"event" firestore:"Event"`
+	Time     time.Time `json:"time" firestore:"Time"`
+	Reason   string    `json:"reason" firestore:"Reason"`
+	Failures int       `json:"failures" firestore:"Failures"`
+}
+
+// Active reports whether the webhook is notified, webhooks stored before they could be paused are active
+func (w Webhook) Active() bool {
+	return w.Status == "" || w.Status == STATUS_ACTIVE
+}
+
+// Disable stops notifying the webhook after failures deliveries in a row have failed, the last one with reason
+func (w *Webhook) Disable(failures int, reason string) {
+	w.Status = STATUS_DISABLED
+	w.Disabled = &Disabled{Event: EVENT_WEBHOOK_DISABLED, Time: time.Now().UTC(), Reason: reason, Failures: failures}
+}
+
+// Resume notifies a paused or disabled webhook again, starting over the count of failures
+func (w *Webhook) Resume() {
+	w.Status = STATUS_ACTIVE
+	w.Failures = 0
+	w.Disabled = nil
+}
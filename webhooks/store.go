@@ -0,0 +1,134 @@
+package webhooks
+
+import (
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Storage backends a store can be opened with
+const BACKEND_FIRESTORE = "firestore"
+const BACKEND_MEMORY = "memory"
+const BACKEND_FILE = "file"
+
+// ErrNotFound is returned when there is no webhook with the ID asked for
+var ErrNotFound = errors.New("webhook not found")
+
+// Webhook is a registered webhook
+type Webhook struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+	// ISO code (upper-case) of the country the webhook is notified about, empty for any country
+	Country string `json:"country"`
+	// A notification is sent for every Calls invocations
+	Calls int `json:"calls"`
+	// Key the notifications to the webhook are signed with
+	Secret string `json:"secret"`
+	// TRIGGER_CALLS (also when empty) or TRIGGER_THRESHOLD
+	Trigger string `json:"trigger,omitempty"`
+	// The indicator, condition and value of threshold webhooks
+	Indicator string  `json:"indicator,omitempty"`
+	Condition string  `json:"condition,omitempty"`
+	Threshold float64 `json:"threshold,omitempty"`
+	// Whether the condition was met the last time it was checked, it is notified when this becomes true
+	Met bool `json:"met,omitempty"`
+	// Types of the events the webhook subscribed to, empty for webhooks registered before events
+	Events []string `json:"events,omitempty"`
+	// Whether the invocations are sent as a digest every interval, instead of a notification every Calls invocations
+	Digest bool `json:"digest,omitempty"`
+	// Whether the receiver echoed a challenge sent to the URL
+	Verified bool `json:"verified,omitempty"`
+	// The owner of the API key the webhook was registered with, empty for webhooks registered before keys
+	Owner string `json:"owner,omitempty"`
+	// STATUS_ACTIVE (also when empty), STATUS_PAUSED or STATUS_DISABLED
+	Status string `json:"status,omitempty"`
+	// Deliveries that failed in a row since the last one that succeeded
+	Failures int `json:"failures,omitempty"`
+	// Why the webhook was disabled, only set while it is
+	Disabled *Disabled `json:"disabled,omitempty"`
+	Created  time.Time `json:"created"`
+}
+
+// Store keeps the registered webhooks
+type Store interface {
+	// Create stores a new webhook and returns it with its ID and creation time set
+	Create(webhook Webhook) (Webhook, error)
+	Get(id string) (Webhook, error)
+	// List returns all webhooks, oldest first
+	List() ([]Webhook, error)
+	// ListByCountry returns the webhooks registered to a country, or to any country if country is empty
+	ListByCountry(country string) ([]Webhook, error)
+	// Page returns the webhooks selected by a query, ErrInvalidCursor if its cursor can not be read
+	Page(query Query) (Page, error)
+	// Update replaces the webhook with the ID of the one given, keeping its creation time, and returns it as stored
+	Update(webhook Webhook) (Webhook, error)
+	// Modify changes the stored webhook with a function and returns it as stored, so fields changed by other
+	// requests in the meantime are kept. Nothing else can change the webhook until it is stored again. The function
+	// may be called more than once, with the webhook as stored each time, and may not change the ID nor creation time.
+	Modify(id string, change func(webhook *Webhook)) (Webhook, error)
+	Delete(id string) error
+	// Increment adds one to the number of invocations of a country, shared by every instance using the storage,
+	// and returns the new number
+	Increment(country string) (int, error)
+	// CountDigest adds an invocation of a country to the digest of a webhook, shared by every instance using the storage
+	CountDigest(webhookID string, country string) error
+	// TakeDigests returns the digests that are due at a time, with Until set to now, and starts each of them over
+	// from then. Each digest is only returned once, also when several instances take them at the same time.
+	TakeDigests(due time.Time) ([]Digest, error)
+	// Ping checks that the storage can be reached
+	Ping() error
+	Close() error
+}
+
+// Config of the store to open
+type Config struct {
+	// One of the BACKEND_ constants
+	Backend string
+	// The file of the file backend
+	File string
+	// The credentials file of the Firestore backend
+	Credentials string
+}
+
+// Open opens the store of the backend in the config
+func Open(config Config) (Store, error) {
+	switch config.Backend {
+	case BACKEND_MEMORY:
+		return NewMemoryStore(), nil
+	case BACKEND_FILE:
+		return NewFileStore(config.File)
+	case BACKEND_FIRESTORE:
+		return NewFirestoreStore(config.Credentials)
+	default:
+		return nil, errors.New("unknown webhook store '" + config.Backend + "', must be one of: " +
+			strings.Join([]string{BACKEND_FIRESTORE, BACKEND_MEMORY, BACKEND_FILE}, ", "))
+	}
+}
+
+const idCharacters = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+
+// Generate a random ID, in the same format as Firestore document IDs
+func newID() (string, error) {
+	id := make([]byte, 20)
+	for i := range id {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(idCharacters))))
+		if err != nil {
+			return "", err
+		}
+		id[i] = idCharacters[n.Int64()]
+	}
+	return string(id), nil
+}
+
+// Sort webhooks oldest first, by ID when created at the same time
+func sortWebhooks(webhooks []Webhook) {
+	sort.Slice(webhooks, func(i, j int) bool {
+		if !webhooks[i].Created.Equal(webhooks[j].Created) {
+			return webhooks[i].Created.Before(webhooks[j].Created)
+		}
+		return webhooks[i].ID < webhooks[j].ID
+	})
+}
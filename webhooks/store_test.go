@@ -0,0 +1,240 @@
+package webhooks
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Behaviour every store has to have
+func testStore(t *testing.T, store Store) {
+	norway, err := store.Create(Webhook{URL: "http://example.com/a", Country: "nor", Calls: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, norway.ID, 20)
+	assert.Equal(t, "NOR", norway.Country)
+	assert.False(t, norway.Created.IsZero())
+
+	all, err := store.Create(Webhook{URL: "http://example.com/b", Calls: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	webhook, err := store.Get(norway.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, norway, webhook)
+
+	webhooks, err := store.List()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []Webhook{norway, all}, webhooks)
+
+	webhooks, err = store.ListByCountry("NOR")
+	assert.NoError(t, err)
+	assert.Equal(t, []Webhook{norway}, webhooks)
+
+	webhooks, err = store.ListByCountry("")
+	assert.NoError(t, err)
+	assert.Equal(t, []Webhook{all}, webhooks)
+
+	page, err := store.Page(Query{Limit: 1})
+	assert.NoError(t, err)
+	assert.Len(t, page.Webhooks, 1)
+	assert.NotEmpty(t, page.Next)
+	country := "NOR"
+	page, err = store.Page(Query{Country: &country})
+	assert.NoError(t, err)
+	assert.Equal(t, Page{Webhooks: []Webhook{norway}}, page)
+
+	// Moving a webhook to another country
+	updated, err := store.Update(Webhook{ID: norway.ID, URL: "http://example.com/c", Country: "swe", Calls: 3, Secret: "s"})
+	assert.NoError(t, err)
+	assert.Equal(t, Webhook{ID: norway.ID, URL: "http://example.com/c", Country: "SWE", Calls: 3, Secret: "s", Created: norway.Created}, updated)
+	webhooks, err = store.ListByCountry("NOR")
+	assert.NoError(t, err)
+	assert.Empty(t, webhooks)
+	webhooks, err = store.ListByCountry("SWE")
+	assert.NoError(t, err)
+	assert.Equal(t, []Webhook{updated}, webhooks)
+	_, err = store.Update(Webhook{ID: "unknown", URL: "http://example.com/d", Calls: 1})
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// Only the fields changed by the function are changed
+	modified, err := store.Modify(norway.ID, func(webhook *Webhook) {
+		webhook.Met = true
+		webhook.ID = "other"
+	})
+	assert.NoError(t, err)
+	updated.Met = true
+	assert.Equal(t, updated, modified)
+	webhook, err = store.Get(norway.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, updated, webhook)
+	_, err = store.Modify("unknown", func(webhook *Webhook) {})
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	assert.NoError(t, store.Delete(norway.ID))
+	_, err = store.Get(norway.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.ErrorIs(t, store.Delete(norway.ID), ErrNotFound)
+
+	webhooks, err = store.ListByCountry("swe")
+	assert.NoError(t, err)
+	assert.Empty(t, webhooks)
+
+	for i := 1; i <= 3; i++ {
+		invocations, err := store.Increment("nor")
+		assert.NoError(t, err)
+		assert.Equal(t, i, invocations)
+	}
+	invocations, err := store.Increment("SWE")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, invocations)
+
+	// Digests are counted for each webhook, and taken once when due
+	assert.NoError(t, store.CountDigest(all.ID, "nor"))
+	assert.NoError(t, store.CountDigest(all.ID, "NOR"))
+	assert.NoError(t, store.CountDigest(all.ID, "swe"))
+	assert.ErrorIs(t, store.CountDigest(norway.ID, "NOR"), ErrNotFound)
+	digests, err := store.TakeDigests(time.Now().UTC().Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.Empty(t, digests)
+	digests, err = store.TakeDigests(time.Now().UTC())
+	assert.NoError(t, err)
+	if assert.Len(t, digests, 1) {
+		assert.Equal(t, all.ID, digests[0].WebhookID)
+		assert.Equal(t, map[string]int{"NOR": 2, "SWE": 1}, digests[0].Countries)
+	}
+	digests, err = store.TakeDigests(time.Now().UTC())
+	assert.NoError(t, err)
+	assert.Empty(t, digests)
+
+	// Deleted with the webhook
+	deleted, err := store.Create(Webhook{URL: "http://example.com/e", Digest: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, store.CountDigest(deleted.ID, "NOR"))
+	assert.NoError(t, store.Delete(deleted.ID))
+	digests, err = store.TakeDigests(time.Now().UTC())
+	assert.NoError(t, err)
+	assert.Empty(t, digests)
+
+	assert.NoError(t, store.Ping())
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestFileStore(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "webhooks.json")
+	store, err := NewFileStore(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, store)
+
+	// The webhooks are still there when the file is opened again
+	created, err := store.Create(Webhook{URL: "http://example.com/c", Country: "SWE", Calls: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, store.CountDigest(created.ID, "SWE"))
+	// Invocations are saved in the background, and at the latest when the store is closed
+	assert.NoError(t, store.Close())
+	reopened, err := NewFileStore(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	webhooks, err := reopened.ListByCountry("SWE")
+	assert.NoError(t, err)
+	assert.Len(t, webhooks, 1)
+	assert.Equal(t, created.ID, webhooks[0].ID)
+	assert.True(t, created.Created.Equal(webhooks[0].Created))
+	invocations, err := reopened.Increment("NOR")
+	assert.NoError(t, err)
+	assert.Equal(t, 4, invocations)
+	digests, err := reopened.TakeDigests(time.Now().UTC())
+	assert.NoError(t, err)
+	if assert.Len(t, digests, 1) {
+		assert.Equal(t, map[string]int{"SWE": 1}, digests[0].Countries)
+	}
+
+	// Changes that can not be saved are not kept
+	assert.NoError(t, os.Chmod(filepath.Dir(filename), 0500))
+	defer os.Chmod(filepath.Dir(filename), 0700)
+	if os.Geteuid() != 0 {
+		_, err = reopened.Create(Webhook{URL: "http://example.com/d", Calls: 1})
+		assert.Error(t, err)
+		webhooks, _ = reopened.List()
+		assert.Len(t, webhooks, 2)
+	}
+}
+
+func TestFileStoreSavesCounts(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "webhooks.json")
+	store, err := NewFileStore(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	for i := 0; i < 3; i++ {
+		_, err = store.Increment("NOR")
+		assert.NoError(t, err)
+	}
+
+	// Not written for every invocation, but within the interval
+	_, err = os.Stat(filename)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	time.Sleep(FILE_SAVE_INTERVAL + FILE_SAVE_INTERVAL/2)
+	reopened, err := NewFileStore(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	invocations, _ := reopened.Increment("NOR")
+	assert.Equal(t, 4, invocations)
+}
+
+func TestFileStoreInvalid(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "webhooks.json")
+	assert.NoError(t, os.WriteFile(filename, []byte("not json"), 0644))
+
+	_, err := NewFileStore(filename)
+	assert.Error(t, err)
+}
+
+func TestFileStoreArray(t *testing.T) {
+	// Files written before invocations were counted
+	filename := filepath.Join(t.TempDir(), "webhooks.json")
+	assert.NoError(t, os.WriteFile(filename, []byte(`[{"id": "a", "url": "http://example.com", "country": "NOR", "calls": 1}]`), 0644))
+
+	store, err := NewFileStore(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	webhooks, _ := store.ListByCountry("NOR")
+	assert.Len(t, webhooks, 1)
+	invocations, err := store.Increment("NOR")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, invocations)
+}
+
+func TestOpen(t *testing.T) {
+	store, err := Open(Config{Backend: BACKEND_MEMORY})
+	assert.NoError(t, err)
+	assert.IsType(t, &MemoryStore{}, store)
+
+	store, err = Open(Config{Backend: BACKEND_FILE, File: filepath.Join(t.TempDir(), "webhooks.json")})
+	assert.NoError(t, err)
+	assert.IsType(t, &FileStore{}, store)
+	assert.NoError(t, store.Close())
+
+	_, err = Open(Config{Backend: "postgres"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,83 @@
+package webhooks
+
+import (
+	"assignment-2/dataset"
+	"strings"
+)
+
+// How a webhook is triggered
+const TRIGGER_CALLS = "calls"
+const TRIGGER_THRESHOLD = "threshold"
+
+// Conditions of threshold webhooks, on the latest value of the country or its change from the year before
+const CONDITION_ABOVE = "above"
+const CONDITION_BELOW = "below"
+const CONDITION_CHANGE_ABOVE = "change_above"
+const CONDITION_CHANGE_BELOW = "change_below"
+
+// Conditions lists the conditions threshold webhooks can have
+var Conditions = []string{CONDITION_ABOVE, CONDITION_BELOW, CONDITION_CHANGE_ABOVE, CONDITION_CHANGE_BELOW}
+
+// IsCondition reports whether a condition is one of the Conditions
+func IsCondition(condition string) bool {
+	for _, known := range Conditions {
+		if condition == known {
+			return true
+		}
+	}
+	return false
+}
+
+// IsThreshold reports whether the webhook is triggered by the values in the dataset rather than by invocations
+func (w Webhook) IsThreshold() bool {
+	return w.Trigger == TRIGGER_THRESHOLD
+}
+
+// Reading is the value a threshold webhook was checked against
+type Reading struct {
+	Year  int
+	Value float64
+	// Change from the year before, only set for the change conditions
+	Change float64
+}
+
+// Evaluate checks the condition of a threshold webhook against the latest value of its country.
+// The condition is not met if the country, or for the change conditions the year before, is not in the dataset.
+func (w Webhook) Evaluate(c *dataset.Collection) (Reading, bool) {
+	indicator := w.Indicator
+	if indicator == "" {
+		indicator = dataset.DEFAULT_INDICATOR
+	}
+	ds, ok := c.Indicator(indicator)
+	if !ok {
+		return Reading{}, false
+	}
+	entity, ok := ds.ByCode(strings.ToLower(w.Country))
+	if !ok {
+		return Reading{}, false
+	}
+	latest, ok := entity.Latest()
+	if !ok {
+		return Reading{}, false
+	}
+	reading := Reading{Year: latest.Year, Value: latest.Value}
+
+	switch w.Condition {
+	case CONDITION_ABOVE:
+		return reading, latest.Value > w.Threshold
+	case CONDITION_BELOW:
+		return reading, latest.Value < w.Threshold
+	case CONDITION_CHANGE_ABOVE, CONDITION_CHANGE_BELOW:
+		previous, ok := entity.Year(latest.Year - 1)
+		if !ok {
+			return reading, false
+		}
+		reading.Change = latest.Value - previous.Value
+		if w.Condition == CONDITION_CHANGE_ABOVE {
+			return reading, reading.Change > w.Threshold
+		}
+		return reading, reading.Change < w.Threshold
+	default:
+		return reading, false
+	}
+}
@@ -0,0 +1,47 @@
+package webhooks
+
+import (
+	"assignment-2/dataset"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestEvaluate(t *testing.T) {
+	c, err := dataset.New([][]string{
+		{"Entity", "Code", "Year", "Renewables (% equivalent primary energy)", "Solar (% equivalent primary energy)"},
+		{"Norway", "NOR", "2020", "70", "0.1"},
+		{"Norway", "NOR", "2021", "71.5", "0.2"},
+		{"Sweden", "SWE", "2021", "50", "1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		description string
+		webhook     Webhook
+		met         bool
+		reading     Reading
+	}{
+		{"Above", Webhook{Country: "NOR", Condition: CONDITION_ABOVE, Threshold: 71}, true, Reading{Year: 2021, Value: 71.5}},
+		{"Not above", Webhook{Country: "nor", Condition: CONDITION_ABOVE, Threshold: 72}, false, Reading{Year: 2021, Value: 71.5}},
+		{"Below", Webhook{Country: "SWE", Condition: CONDITION_BELOW, Threshold: 60}, true, Reading{Year: 2021, Value: 50}},
+		{"Change above", Webhook{Country: "NOR", Condition: CONDITION_CHANGE_ABOVE, Threshold: 1}, true, Reading{Year: 2021, Value: 71.5, Change: 1.5}},
+		{"Change not below", Webhook{Country: "NOR", Condition: CONDITION_CHANGE_BELOW, Threshold: -1}, false, Reading{Year: 2021, Value: 71.5, Change: 1.5}},
+		{"No year before", Webhook{Country: "SWE", Condition: CONDITION_CHANGE_BELOW, Threshold: 100}, false, Reading{Year: 2021, Value: 50}},
+		{"Other indicator", Webhook{Country: "SWE", Indicator: "solar", Condition: CONDITION_ABOVE, Threshold: 0.5}, true, Reading{Year: 2021, Value: 1}},
+		{"Indicator not in the dataset", Webhook{Country: "SWE", Indicator: "wind", Condition: CONDITION_ABOVE}, false, Reading{}},
+		{"Country not in the dataset", Webhook{Country: "DNK", Condition: CONDITION_ABOVE}, false, Reading{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			test.webhook.Trigger = TRIGGER_THRESHOLD
+			reading, met := test.webhook.Evaluate(c)
+			assert.Equal(t, test.met, met)
+			assert.Equal(t, test.reading.Year, reading.Year)
+			assert.InDelta(t, test.reading.Value, reading.Value, 1e-9)
+			assert.InDelta(t, test.reading.Change, reading.Change, 1e-9)
+		})
+	}
+}